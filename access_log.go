@@ -0,0 +1,254 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// AccessLogCombined is the Apache Combined Log Format.
+	AccessLogCombined = "combined"
+	// AccessLogJSON writes a JSON object per request.
+	AccessLogJSON = "json"
+)
+
+type (
+	// AccessLogConfig contains the access log options.
+	AccessLogConfig struct {
+		// Format is AccessLogCombined (default), AccessLogJSON or a text/template
+		// executed with an AccessLogEntry, f.e. "{{.Method}} {{.Path}} {{.Status}} {{.Latency}}".
+		Format string
+		// Output is the log destination, os.Stdout by default.
+		Output io.Writer
+		// SkipPaths are not logged. A path ending with * matches as prefix (f.e. "/assets/*").
+		SkipPaths []string
+		// SkipStatic disables the logging of files served from the public directory.
+		SkipStatic bool
+	}
+
+	// AccessLogEntry contains the request information.
+	AccessLogEntry struct {
+		Time      time.Time
+		Method    string
+		Path      string
+		URI       string
+		Proto     string
+		Status    int
+		Bytes     int
+		Latency   time.Duration
+		IP        string
+		User      string
+		UserAgent string
+		Referer   string
+		RequestID string
+	}
+
+	// accessLogger writes the entries to the configured output.
+	accessLogger struct {
+		mu       sync.Mutex
+		config   AccessLogConfig
+		template *template.Template
+	}
+)
+
+// AccessLog returns a middleware logging each request.
+// Register it as the first global middleware to measure the whole request:
+//
+//	framework.Use(framework.AccessLog(framework.AccessLogConfig{
+//		Format:    framework.AccessLogJSON,
+//		SkipPaths: []string{"/metrics", "/assets/*"},
+//	}))
+//
+// The access_log config key (combined, json or a template) enables it on Init,
+// access_log_skip lists the paths to skip.
+// It panics if Format is an invalid template.
+func AccessLog(config AccessLogConfig) HandlerFunc {
+	al := &accessLogger{config: config}
+
+	if al.config.Output == nil {
+		al.config.Output = os.Stdout
+	}
+
+	switch al.config.Format {
+	case "", AccessLogCombined, AccessLogJSON:
+	default:
+		al.template = template.Must(template.New("access_log").Parse(al.config.Format))
+	}
+
+	return func(c *Context) {
+		if al.skip(c.Request.URL.Path) {
+			return
+		}
+
+		// Path and query are rewritten by the router, keep the original values.
+		e := &AccessLogEntry{
+			Time:      time.Now(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			URI:       c.Request.RequestURI,
+			Proto:     c.Request.Proto,
+			IP:        c.Request.IP(),
+			UserAgent: c.Request.UserAgent(),
+			Referer:   c.Request.Referer(),
+		}
+		if e.URI == "" {
+			e.URI = c.Request.URL.RequestURI()
+		}
+		if user, _, ok := c.Request.BasicAuth(); ok {
+			e.User = user
+		}
+
+		c.After(func(c *Context) {
+			if al.config.SkipStatic && c.static {
+				return
+			}
+
+			e.Latency = time.Since(e.Time)
+			e.Status = c.Response.Status()
+			e.Bytes = responseSize(c.Response)
+			e.RequestID = c.RequestID()
+
+			// The status is implicit when the body is written without WriteHeader.
+			if e.Status == 0 {
+				e.Status = http.StatusOK
+			}
+
+			al.write(e)
+		})
+	}
+}
+
+// skip reports whether path must not be logged.
+func (al *accessLogger) skip(path string) bool {
+	for _, skip := range al.config.SkipPaths {
+		if strings.HasSuffix(skip, "*") {
+			if strings.HasPrefix(path, skip[:len(skip)-1]) {
+				return true
+			}
+		} else if path == skip {
+			return true
+		}
+	}
+	return false
+}
+
+// write formats the entry and writes it as a single line.
+func (al *accessLogger) write(e *AccessLogEntry) {
+	buf := logBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	switch {
+	case al.template != nil:
+		if err := al.template.Execute(buf, e); err != nil {
+			logBuffers.Put(buf)
+			Log.Error(err)
+			return
+		}
+		if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	case al.config.Format == AccessLogJSON:
+		e.writeJSON(buf)
+	default:
+		e.writeCombined(buf)
+	}
+
+	al.mu.Lock()
+	_, _ = al.config.Output.Write(buf.Bytes())
+	al.mu.Unlock()
+
+	logBuffers.Put(buf)
+}
+
+// writeCombined writes the entry using the Apache Combined Log Format:
+// %h - %u [%t] "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func (e *AccessLogEntry) writeCombined(buf *bytes.Buffer) {
+	var tmp [64]byte
+
+	buf.WriteString(e.IP)
+	buf.WriteString(" - ")
+	buf.WriteString(dash(e.User))
+	buf.WriteString(" [")
+	buf.Write(e.Time.AppendFormat(tmp[:0], "02/Jan/2006:15:04:05 -0700"))
+	buf.WriteString(`] "`)
+	buf.WriteString(e.Method)
+	buf.WriteByte(' ')
+	buf.WriteString(e.URI)
+	buf.WriteByte(' ')
+	buf.WriteString(e.Proto)
+	buf.WriteString(`" `)
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteByte(' ')
+	if e.Bytes > 0 {
+		buf.WriteString(strconv.Itoa(e.Bytes))
+	} else {
+		buf.WriteByte('-')
+	}
+	buf.WriteString(` "`)
+	buf.WriteString(escapeCombined(dash(e.Referer)))
+	buf.WriteString(`" "`)
+	buf.WriteString(escapeCombined(dash(e.UserAgent)))
+	buf.WriteString("\"\n")
+}
+
+// writeJSON writes the entry as a JSON line.
+func (e *AccessLogEntry) writeJSON(buf *bytes.Buffer) {
+	var tmp [64]byte
+
+	buf.WriteString(`{"time":"`)
+	buf.Write(e.Time.AppendFormat(tmp[:0], time.RFC3339Nano))
+	buf.WriteString(`","method":`)
+	writeJSONString(buf, e.Method)
+	buf.WriteString(`,"path":`)
+	writeJSONString(buf, e.Path)
+	buf.WriteString(`,"uri":`)
+	writeJSONString(buf, e.URI)
+	buf.WriteString(`,"proto":`)
+	writeJSONString(buf, e.Proto)
+	buf.WriteString(`,"status":`)
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteString(`,"bytes":`)
+	buf.WriteString(strconv.Itoa(e.Bytes))
+	buf.WriteString(`,"latency_ms":`)
+	buf.WriteString(strconv.FormatFloat(float64(e.Latency)/float64(time.Millisecond), 'f', 3, 64))
+	buf.WriteString(`,"ip":`)
+	writeJSONString(buf, e.IP)
+	buf.WriteString(`,"user":`)
+	writeJSONString(buf, e.User)
+	buf.WriteString(`,"user_agent":`)
+	writeJSONString(buf, e.UserAgent)
+	buf.WriteString(`,"referer":`)
+	writeJSONString(buf, e.Referer)
+	buf.WriteString(`,"request_id":`)
+	writeJSONString(buf, e.RequestID)
+	buf.WriteString("}\n")
+}
+
+// dash returns "-" for empty values.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeCombined escapes quotes and control characters of a quoted Combined field.
+func escapeCombined(s string) string {
+	if !strings.ContainsAny(s, "\"\\\r\n\t") {
+		return s
+	}
+
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// serveWithMiddlewares serves req with the given global middlewares.
+func serveWithMiddlewares(r Router, req *http.Request, middlewares ...HandlerFunc) *httptest.ResponseRecorder {
+	saved := App.middlewares
+	App.middlewares = middlewares
+	defer func() {
+		App.middlewares = saved
+	}()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAccessLog(t *testing.T) {
+	r := NewRouter()
+	r.Add("/user/:id", "GET", func(c *Context) {
+		c.Plain(http.StatusCreated, "hello")
+	})
+	r.Add("/healthz", "GET", func(c *Context) {
+		c.Plain(http.StatusOK, "ok")
+	})
+
+	newRequest := func(path string) *http.Request {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RequestURI = path
+		req.RemoteAddr = "203.0.113.1:1234"
+		req.Header.Set("User-Agent", `agent "1"`)
+		req.Header.Set(HeaderRequestID, "req-1")
+		return req
+	}
+
+	// Combined
+	buf := &bytes.Buffer{}
+	serveWithMiddlewares(r, newRequest("/user/1?x=1"), AccessLog(AccessLogConfig{Output: buf}))
+
+	combined := regexp.MustCompile(`^203\.0\.113\.1 - - \[[^\]]+\] "GET /user/1\?x=1 HTTP/1\.1" 201 5 "-" "agent \\"1\\""\n$`)
+	if !combined.MatchString(buf.String()) {
+		t.Fatalf("unexpected combined line %q", buf.String())
+	}
+
+	// JSON with request ID
+	buf.Reset()
+	serveWithMiddlewares(r, newRequest("/user/1"), AccessLog(AccessLogConfig{Format: AccessLogJSON, Output: buf}), RequestID())
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+	if entry["status"] != float64(201) || entry["bytes"] != float64(5) || entry["path"] != "/user/1" ||
+		entry["request_id"] != "req-1" || entry["ip"] != "203.0.113.1" || entry["latency_ms"] == nil {
+		t.Fatalf("unexpected JSON entry %v", entry)
+	}
+
+	// Template and skipped paths
+	buf.Reset()
+	config := AccessLogConfig{Format: "{{.Method}} {{.Path}} {{.Status}}", Output: buf, SkipPaths: []string{"/healthz"}}
+	serveWithMiddlewares(r, newRequest("/healthz"), AccessLog(config))
+	serveWithMiddlewares(r, newRequest("/missing"), AccessLog(config))
+
+	if buf.String() != "GET /missing 404\n" {
+		t.Fatalf("unexpected template output %q", buf.String())
+	}
+}
@@ -1,7 +1,12 @@
 package cache
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,23 +15,54 @@ type (
 	Cache interface {
 		// Init initialize the cache adapter with provided config string.
 		Init(string) error
-		// Get cached value by key.
+		// Get cached value by key, nil when missing.
 		Get(string) interface{}
+		// Lookup returns the cached value by key and whether it was found,
+		// f.e. to tell a cached nil or empty string from a miss.
+		Lookup(string) (interface{}, bool)
 		// GetMulti values of Get.
 		GetMulti([]string) []interface{}
-		// Put sets the cache value with key and timeout.
+		// Put sets the cache value with key and timeout, NoExpiration never expires.
 		Put(string, interface{}, time.Duration) error
+		// PutMulti sets the values of Put with the same timeout.
+		PutMulti(map[string]interface{}, time.Duration) error
+		// Add sets the cache value only if key is missing, it reports whether it was set.
+		Add(string, interface{}, time.Duration) (bool, error)
+		// Increment adds delta to the integer value of key and returns the new value.
+		// A missing key is set to delta without expiration.
+		Increment(string, int64) (int64, error)
+		// Decrement subtracts delta from the integer value of key, see Increment.
+		Decrement(string, int64) (int64, error)
+		// Touch sets a new timeout to key, it reports whether key was found.
+		Touch(string, time.Duration) (bool, error)
+		// TTL returns the remaining timeout of key (NoExpiration without timeout)
+		// and whether key was found.
+		TTL(string) (time.Duration, bool)
 		// Delete cached value by key.
 		Delete(string) error
+		// DeleteMulti values of Delete.
+		DeleteMulti([]string) error
 		// Exists check if cached value exists.
 		Exists(string) bool
 		// ClearAll removes all cached values.
 		ClearAll() error
+		// PutWithTags sets the cache value like Put and tags it, see PutWithTags.
+		PutWithTags(string, interface{}, time.Duration, ...string) error
+		// InvalidateTag deletes the values tagged with tag.
+		InvalidateTag(string) error
+		// Namespace returns a view with the keys prefixed by name, see NewNamespace.
+		Namespace(string) Cache
 	}
 	// Adapter is the cache instance.
 	Adapter func() Cache
 )
 
+// NoExpiration is the timeout of the values cached until deleted or evicted.
+const NoExpiration time.Duration = 0
+
+// ErrNotInteger is returned by Increment and Decrement when the cached value isn't an integer.
+var ErrNotInteger = errors.New("cache: value is not an integer")
+
 var adapters = make(map[string]Adapter)
 
 // Register adds the cache adapter by name
@@ -63,3 +99,128 @@ func NewCache(name, config string) (Cache, error) {
 
 	return adapter, nil
 }
+
+// Duration is a cache_config duration, a string like "1m30s" or a number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON decodes "1m30s" or 90.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("cache: invalid duration %s", v)
+		}
+		*d = Duration(dur)
+	case nil:
+		*d = 0
+	default:
+		return fmt.Errorf("cache: invalid duration %s", b)
+	}
+	return nil
+}
+
+// FileMode is a cache_config permission, an octal string like "0640" or a number.
+type FileMode os.FileMode
+
+// UnmarshalJSON decodes "0640" or 416.
+func (m *FileMode) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case float64:
+		*m = FileMode(v)
+	case string:
+		n, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return fmt.Errorf("cache: invalid permission %s", v)
+		}
+		*m = FileMode(n)
+	default:
+		return fmt.Errorf("cache: invalid permission %s", b)
+	}
+	if *m&^FileMode(os.ModePerm) != 0 {
+		return fmt.Errorf("cache: invalid permission %s", b)
+	}
+	return nil
+}
+
+// parseConfig decodes the JSON config string into v, an empty config keeps the defaults.
+func parseConfig(config string, v interface{}) error {
+	if strings.TrimSpace(config) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(config), v); err != nil {
+		return fmt.Errorf("cache: invalid config: %v", err)
+	}
+	return nil
+}
+
+// toInt64 converts the integer values for Increment, f.e. the float64 decoded from JSON.
+func toInt64(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), nil
+		}
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	case []byte:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, ErrNotInteger
+}
+
+// remaining returns the TTL of a value expiring at expire, NoExpiration for the zero time.
+func remaining(expire time.Time) time.Duration {
+	if expire.IsZero() {
+		return NoExpiration
+	}
+	if d := time.Until(expire); d > 0 {
+		return d
+	}
+	// Expiring now, but still found.
+	return time.Nanosecond
+}
+
+// expiration returns the expire time of a value cached at now, the zero time for NoExpiration.
+func expiration(now time.Time, timeout time.Duration) time.Time {
+	if timeout <= NoExpiration {
+		return time.Time{}
+	}
+	return now.Add(timeout)
+}
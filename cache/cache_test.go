@@ -1,15 +1,22 @@
 package cache
 
 import (
+	"os"
 	"testing"
 	"time"
 )
 
+func TestMain(m *testing.M) {
+	_ = Register("file", NewFileCache)
+	_ = Register("memory", NewMemoryCache)
+	_ = Register("redis", NewRedisCache)
+	_ = Register("tiered", NewTieredCache)
+	os.Exit(m.Run())
+}
+
 func TestFileCache(t *testing.T) {
-	c, err := NewCache("file", "")
-	if err != nil {
-		t.Errorf("Unable to init FileCache: %v\n", err)
-	}
+	c := newTestFileCache(t, "")
+	var err error
 
 	// Test PUT
 	if err = c.Put("test", "test", 10*time.Second); err != nil {
@@ -49,8 +56,11 @@ func TestFileCache(t *testing.T) {
 		t.Error("GetMulti: unable to retreive cached values")
 	}
 
-	// Remove tests
+	// Remove tests, the directory is kept
 	c.ClearAll()
+	if !fileExists(c.Path) {
+		t.Error("ClearAll: cache directory removed")
+	}
 }
 
 func TestMemoryCache(t *testing.T) {
@@ -100,3 +110,17 @@ func TestMemoryCache(t *testing.T) {
 	// Remove tests
 	c.ClearAll()
 }
+
+func TestCacheStats(t *testing.T) {
+	c := NewMemoryCache()
+	_ = c.Put("a", 1, time.Minute)
+
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+
+	stats := c.(interface{ Stats() Stats }).Stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type (
+	// Codec encodes the values of the adapters storing bytes, f.e. redis.
+	Codec interface {
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte) (interface{}, error)
+	}
+
+	// GobCodec encodes the values with encoding/gob, they keep their Go type.
+	// The types are registered with gob.Register on their first Marshal, the reading process
+	// must register them too (f.e. with gob.Register) to decode them before writing.
+	GobCodec struct{}
+
+	// JSONCodec encodes the values as JSON, they're decoded as the encoding/json
+	// interface{} values (float64, string, bool, []interface{} and map[string]interface{}).
+	JSONCodec struct{}
+
+	// gobValue wraps the values, gob encodes the interface type name.
+	gobValue struct {
+		Value interface{}
+	}
+)
+
+var (
+	// gobTypes are the types registered with gob.Register by GobCodec.
+	gobTypes sync.Map
+
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"gob":  GobCodec{},
+		"json": JSONCodec{},
+	}
+)
+
+// RegisterCodec adds the codec by name, it can be selected with the "codec" adapter config.
+func RegisterCodec(name string, codec Codec) error {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if name == "" || codec == nil {
+		return fmt.Errorf("cache register codec: name is empty or codec is nil")
+	}
+	if _, ok := codecs[name]; ok {
+		return fmt.Errorf("cache register codec: codec %s already registered", name)
+	}
+
+	codecs[name] = codec
+	return nil
+}
+
+// codec returns the codec by name, gob when empty.
+func codec(name string) (Codec, error) {
+	if name == "" {
+		name = "gob"
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("cache: unknown codec %s", name)
+	}
+	return c, nil
+}
+
+// Marshal encodes v with gob, registering its type on first use.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var rerr error
+	if v != nil {
+		if _, ok := gobTypes.LoadOrStore(reflect.TypeOf(v), true); !ok {
+			rerr = registerGob(v)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(gobValue{Value: v}); err != nil {
+		if rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// registerGob registers the type of v with gob.Register, which panics when the type or
+// its name is already registered, f.e. T before *T or by the application with RegisterName.
+// The type can still be encodable, under the registered name.
+func registerGob(v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cache: gob register %T: %v", v, r)
+		}
+	}()
+	gob.Register(v)
+	return nil
+}
+
+// Unmarshal decodes a value encoded by Marshal.
+func (GobCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v gobValue
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v.Value, nil
+}
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data.
+func (JSONCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+type gobItem struct{ Name string }
+
+type gobNamed struct{ Name string }
+
+func TestGobCodecRegister(t *testing.T) {
+	var codec GobCodec
+
+	// T then *T share the registration, gob.Register panics on *T.
+	if _, err := codec.Marshal(gobItem{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := codec.Marshal(&gobItem{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := codec.Unmarshal(data); err != nil || v.(gobItem).Name != "b" {
+		t.Fatalf("unexpected value %v, %v", v, err)
+	}
+
+	// Registered by the application under another name.
+	gob.RegisterName("app.named", gobNamed{})
+	if _, err := codec.Marshal(gobNamed{"c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A local type with the name of gobItem can't be registered nor encoded.
+	type gobItem struct{ Name string }
+	if _, err := codec.Marshal(gobItem{"d"}); err == nil || !strings.Contains(err.Error(), "register") {
+		t.Fatalf("expected a register error, got %v", err)
+	}
+}
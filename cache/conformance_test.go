@@ -0,0 +1,247 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCacheConformance checks the Cache contract, every adapter must pass it.
+func testCacheConformance(t *testing.T, newCache func(t *testing.T) Cache) {
+	t.Run("Lookup", func(t *testing.T) {
+		c := newCache(t)
+
+		if v, ok := c.Lookup("missing"); ok || v != nil {
+			t.Fatalf("unexpected miss %v %v", v, ok)
+		}
+		if v := c.Get("missing"); v != nil {
+			t.Fatalf("Get miss returned %#v", v)
+		}
+
+		_ = c.Put("empty", "", time.Minute)
+		if v, ok := c.Lookup("empty"); !ok || v != "" {
+			t.Fatalf("cached empty string not found %v %v", v, ok)
+		}
+	})
+
+	t.Run("Multi", func(t *testing.T) {
+		c := newCache(t)
+
+		if err := c.PutMulti(map[string]interface{}{"a": "1", "b": "2"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		vv := c.GetMulti([]string{"a", "b", "c"})
+		if len(vv) != 3 || vv[0] != "1" || vv[1] != "2" || vv[2] != nil {
+			t.Fatalf("unexpected values %v", vv)
+		}
+
+		if err := c.DeleteMulti([]string{"a", "b", "c"}); err != nil {
+			t.Fatal(err)
+		}
+		if c.Exists("a") || c.Exists("b") {
+			t.Fatal("values not deleted")
+		}
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		c := newCache(t)
+
+		_ = c.Put("short", "v", 20*time.Millisecond)
+		_ = c.Put("forever", "v", NoExpiration)
+
+		if ttl, ok := c.TTL("short"); !ok || ttl <= 0 || ttl > 20*time.Millisecond {
+			t.Fatalf("unexpected TTL %v %v", ttl, ok)
+		}
+		if ttl, ok := c.TTL("forever"); !ok || ttl != NoExpiration {
+			t.Fatalf("unexpected TTL %v %v", ttl, ok)
+		}
+
+		time.Sleep(40 * time.Millisecond)
+
+		if c.Exists("short") || c.Get("short") != nil {
+			t.Fatal("expired value found")
+		}
+		if _, ok := c.TTL("short"); ok {
+			t.Fatal("TTL of an expired value")
+		}
+		if !c.Exists("forever") {
+			t.Fatal("value without expiration not found")
+		}
+	})
+
+	t.Run("Add", func(t *testing.T) {
+		c := newCache(t)
+
+		if ok, err := c.Add("key", "first", 20*time.Millisecond); !ok || err != nil {
+			t.Fatalf("Add of a missing key %v %v", ok, err)
+		}
+		if ok, _ := c.Add("key", "second", time.Minute); ok || c.Get("key") != "first" {
+			t.Fatal("Add replaced an existing key")
+		}
+
+		time.Sleep(40 * time.Millisecond)
+		if ok, _ := c.Add("key", "third", time.Minute); !ok || c.Get("key") != "third" {
+			t.Fatal("Add of an expired key")
+		}
+	})
+
+	t.Run("Increment", func(t *testing.T) {
+		c := newCache(t)
+
+		if n, err := c.Increment("counter", 5); n != 5 || err != nil {
+			t.Fatalf("Increment of a missing key %d %v", n, err)
+		}
+		if n, _ := c.Increment("counter", 2); n != 7 {
+			t.Fatalf("unexpected value %d", n)
+		}
+		if n, _ := c.Decrement("counter", 10); n != -3 {
+			t.Fatalf("unexpected value %d", n)
+		}
+
+		_ = c.Put("int", 10, time.Minute)
+		if n, _ := c.Increment("int", 1); n != 11 {
+			t.Fatalf("unexpected value %d", n)
+		}
+		if ttl, ok := c.TTL("int"); !ok || ttl == NoExpiration {
+			t.Fatal("Increment removed the timeout")
+		}
+
+		_ = c.Put("string", "abc", time.Minute)
+		if _, err := c.Increment("string", 1); err != ErrNotInteger {
+			t.Fatalf("expected ErrNotInteger, got %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					_, _ = c.Increment("concurrent", 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if n, _ := c.Increment("concurrent", 0); n != 200 {
+			t.Fatalf("lost increments, got %d", n)
+		}
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		c := newCache(t)
+
+		if ok, _ := c.Touch("missing", time.Minute); ok {
+			t.Fatal("Touch of a missing key")
+		}
+
+		_ = c.Put("key", "v", 20*time.Millisecond)
+		if ok, err := c.Touch("key", time.Minute); !ok || err != nil {
+			t.Fatalf("Touch failed %v %v", ok, err)
+		}
+
+		time.Sleep(40 * time.Millisecond)
+		if ttl, ok := c.TTL("key"); !ok || ttl < 30*time.Second {
+			t.Fatalf("unexpected TTL %v %v", ttl, ok)
+		}
+
+		_, _ = c.Touch("key", NoExpiration)
+		if ttl, _ := c.TTL("key"); ttl != NoExpiration {
+			t.Fatalf("unexpected TTL %v", ttl)
+		}
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		c := newCache(t)
+
+		if err := c.PutWithTags("product:1:price", "10", time.Minute, "product:1"); err != nil {
+			t.Fatal(err)
+		}
+		_ = c.PutWithTags("product:1:page", "<p>", time.Minute, "product:1", "pages")
+		_ = c.PutWithTags("product:2:page", "<p>", time.Minute, "product:2", "pages")
+		_ = c.Put("other", "v", time.Minute)
+
+		if err := c.InvalidateTag("product:1"); err != nil {
+			t.Fatal(err)
+		}
+		if c.Exists("product:1:price") || c.Exists("product:1:page") {
+			t.Fatal("tagged values not invalidated")
+		}
+		if !c.Exists("product:2:page") || !c.Exists("other") {
+			t.Fatal("untagged values invalidated")
+		}
+
+		_ = c.InvalidateTag("pages")
+		if c.Exists("product:2:page") {
+			t.Fatal("tagged value not invalidated")
+		}
+		if err := c.InvalidateTag("missing"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Namespace", func(t *testing.T) {
+		c := newCache(t)
+
+		users := c.Namespace("users")
+		admins := users.Namespace("admins")
+		_ = users.Put("1", "ann", time.Minute)
+		_ = admins.Put("1", "bob", time.Minute)
+		_ = c.Put("1", "root", time.Minute)
+
+		if users.Get("1") != "ann" || admins.Get("1") != "bob" || c.Get("users:1") != "ann" {
+			t.Fatal("unexpected namespace values")
+		}
+
+		_ = users.PutWithTags("2", "tim", time.Minute, "team")
+		_ = c.PutWithTags("team", "v", time.Minute, "team")
+		_ = users.InvalidateTag("team")
+		if users.Exists("2") || !c.Exists("team") {
+			t.Fatal("namespace tag not scoped")
+		}
+
+		if err := users.ClearAll(); err != nil {
+			t.Fatal(err)
+		}
+		if users.Exists("1") || admins.Exists("1") {
+			t.Fatal("namespace not cleared")
+		}
+		if c.Get("1") != "root" {
+			t.Fatal("ClearAll of a namespace removed other values")
+		}
+	})
+
+	t.Run("ClearAll", func(t *testing.T) {
+		c := newCache(t)
+
+		_ = c.Put("a", "1", time.Minute)
+		if err := c.ClearAll(); err != nil {
+			t.Fatal(err)
+		}
+		if c.Exists("a") {
+			t.Fatal("value not cleared")
+		}
+	})
+}
+
+func TestMemoryCacheConformance(t *testing.T) {
+	testCacheConformance(t, func(t *testing.T) Cache {
+		return newTestMemoryCache(t, "")
+	})
+}
+
+func TestNamespaceConformance(t *testing.T) {
+	testCacheConformance(t, func(t *testing.T) Cache {
+		return newTestMemoryCache(t, "").Namespace("ns")
+	})
+}
+
+func TestFileCacheConformance(t *testing.T) {
+	for _, codec := range []string{"gob", "json"} {
+		t.Run(codec, func(t *testing.T) {
+			testCacheConformance(t, func(t *testing.T) Cache {
+				return newTestFileCache(t, fmt.Sprintf(`{"levels": 2, "codec": %q}`, codec))
+			})
+		})
+	}
+}
@@ -1,41 +1,184 @@
 package cache
 
 import (
-	"bytes"
 	"crypto/md5"
-	"encoding/gob"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
+// fileMagic starts the cache files, followed by the expire time and the encoded value.
+const fileMagic = "FCv1"
+
+// fileHeaderSize is the size of the magic and of the expire time, in Unix nanoseconds (0 never expires).
+const fileHeaderSize = len(fileMagic) + 8
+
+// fileTempPrefix starts the files being written, renamed once complete.
+const fileTempPrefix = ".tmp-"
+
+// fileTagDir is the directory of the tag indexes in the cache directory: a directory per tag
+// with a marker file per tagged key, see TagKeys.
+const fileTagDir = ".tags"
+
+// errFileCorrupted is reported for the files without a valid header.
+var errFileCorrupted = errors.New("cache: corrupted file")
+
 type (
+	// FileCacheConfig is the JSON config of the FileCache, f.e.
+	// {"path": "/var/cache/app", "dir_perm": "0750", "file_perm": "0640", "levels": 2, "codec": "json", "every": "10m"}
+	FileCacheConfig struct {
+		// Path is the cache directory, "cache" by default.
+		Path string `json:"path"`
+		// Ext is the extension of the cache files, ".bin" by default.
+		Ext string `json:"ext"`
+		// DirPerm and FilePerm are the permissions of the created directories
+		// and files, 0755 and 0644 by default.
+		DirPerm  FileMode `json:"dir_perm"`
+		FilePerm FileMode `json:"file_perm"`
+		// Levels is the number of subdirectories, named by two characters of the
+		// hashed key, spreading the files; 1 by default, at most 8.
+		Levels int `json:"levels"`
+		// Codec encodes the values, gob (default), json or a name registered with RegisterCodec.
+		Codec string `json:"codec"`
+		// Every is the interval between the removals of the expired files, 10 minutes by default.
+		// A negative value disables the GC, the expired files are removed when read.
+		Every Duration `json:"every"`
+	}
+
 	// FileCacheItem contains the cached data and expire time.
 	FileCacheItem struct {
 		Content interface{}
 		Expire  time.Time
 	}
 
-	// FileCache is the file cache adapter.
+	// FileCache is the file cache adapter, a file per key.
+	// The files are written to a temporary file then renamed, so they're never read partially.
 	FileCache struct {
+		counters
+		loader adapterLoader
+		mu     sync.Mutex
+
 		Path string
 		Ext  string
+
+		config  FileCacheConfig
+		codec   Codec
+		onError func(key string, err error)
+		stop    chan struct{}
+		closeMu sync.Mutex
 	}
 )
 
+// DefaultFileCacheConfig is used for the missing FileCache config values.
+var DefaultFileCacheConfig = FileCacheConfig{
+	Path:     "cache",
+	Ext:      ".bin",
+	DirPerm:  0755,
+	FilePerm: 0644,
+	Levels:   1,
+	Codec:    "gob",
+	Every:    Duration(10 * time.Minute),
+}
+
 // NewFileCache instantiate a new FileCache.
 func NewFileCache() Cache {
 	return &FileCache{}
 }
 
-// Hash the file name with MD5
-func (fc *FileCache) getMD5Hash(name string) string {
-	m := md5.New()
-	m.Write([]byte(name))
-	return filepath.Join(fc.Path, fmt.Sprintf("%s", hex.EncodeToString(m.Sum(nil))))
+// Init initialize the cache adapter with provided config string, see FileCacheConfig.
+// It creates the cache directory and starts the GC.
+func (fc *FileCache) Init(config string) error {
+	c := DefaultFileCacheConfig
+	if err := parseConfig(config, &c); err != nil {
+		return err
+	}
+	if c.Path == "" {
+		return fmt.Errorf("cache: invalid file path %q", c.Path)
+	}
+	if c.DirPerm == 0 || c.FilePerm == 0 {
+		return fmt.Errorf("cache: invalid file permissions %o %o", c.DirPerm, c.FilePerm)
+	}
+	if c.Levels < 0 || c.Levels > 8 {
+		return fmt.Errorf("cache: invalid file levels %d", c.Levels)
+	}
+
+	codec, err := codec(c.Codec)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Path, os.FileMode(c.DirPerm)); err != nil {
+		return fmt.Errorf("cache: %v", err)
+	}
+
+	_ = fc.Close()
+
+	fc.config, fc.codec = c, codec
+	fc.Path, fc.Ext = c.Path, c.Ext
+
+	if c.Every > 0 {
+		fc.closeMu.Lock()
+		fc.stop = make(chan struct{})
+		go fc.janitor(time.Duration(c.Every), fc.stop)
+		fc.closeMu.Unlock()
+	}
+	return nil
+}
+
+// OnError sets fn, called with the errors of the corrupted files, which are removed.
+func (fc *FileCache) OnError(fn func(key string, err error)) {
+	fc.closeMu.Lock()
+	fc.onError = fn
+	fc.closeMu.Unlock()
+}
+
+func (fc *FileCache) error(key string, err error) {
+	fc.closeMu.Lock()
+	fn := fc.onError
+	fc.closeMu.Unlock()
+
+	if fn != nil {
+		fn(key, err)
+	}
+}
+
+// Close stops the GC.
+func (fc *FileCache) Close() error {
+	fc.closeMu.Lock()
+	if fc.stop != nil {
+		close(fc.stop)
+		fc.stop = nil
+	}
+	fc.closeMu.Unlock()
+	return nil
+}
+
+// filename returns the file of key: the MD5 hash of key, in the Levels subdirectories.
+func (fc *FileCache) filename(key string) string {
+	sum := md5.Sum([]byte(key))
+	name := hex.EncodeToString(sum[:])
+
+	parts := []string{fc.Path}
+	for i := 0; i < fc.config.Levels; i++ {
+		parts = append(parts, name[i*2:i*2+2])
+	}
+	return filepath.Join(append(parts, name+fc.Ext)...)
+}
+
+// encoder returns the codec, gob when not initialized.
+func (fc *FileCache) encoder() Codec {
+	if fc.codec == nil {
+		return GobCodec{}
+	}
+	return fc.codec
 }
 
 func fileExists(file string) bool {
@@ -45,54 +188,158 @@ func fileExists(file string) bool {
 	return true
 }
 
-func gobEncode(data interface{}) ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
-	err := gob.NewEncoder(buf).Encode(data)
-	if err != nil {
-		return nil, err
+// fileExpire returns the expire time of a file header.
+func fileExpire(header []byte) (time.Time, error) {
+	if len(header) < fileHeaderSize || string(header[:len(fileMagic)]) != fileMagic {
+		return time.Time{}, errFileCorrupted
 	}
-	return buf.Bytes(), nil
+
+	nsec := int64(binary.BigEndian.Uint64(header[len(fileMagic):fileHeaderSize]))
+	if nsec == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, nsec), nil
 }
 
-func gobDecode(data []byte, item *FileCacheItem) error {
-	buf := bytes.NewBuffer(data)
-	return gob.NewDecoder(buf).Decode(&item)
+func expired(expire time.Time, now time.Time) bool {
+	return !expire.IsZero() && !expire.After(now)
 }
 
-// Init initialize the cache adapter with provided config string.
-func (fc *FileCache) Init(config string) error {
+// Get cached value by key, nil when missing.
+func (fc *FileCache) Get(key string) interface{} {
+	v, _ := fc.Lookup(key)
+	return v
+}
+
+// Lookup returns the cached value by key and whether it was found.
+func (fc *FileCache) Lookup(key string) (interface{}, bool) {
+	item, ok := fc.read(key)
+	fc.record(ok)
+	if !ok {
+		return nil, false
+	}
+	return item.Content, true
+}
 
-	fc.Path = "cache"
-	fc.Ext = ".bin"
+// read returns the item of key, the expired and corrupted files are removed.
+func (fc *FileCache) read(key string) (*FileCacheItem, bool) {
+	filename := fc.filename(key)
 
-	// Check if file cache path exists
-	if ok := fileExists(fc.Path); !ok {
-		_ = os.MkdirAll(fc.Path, os.ModePerm)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, false
 	}
 
-	return nil
+	expire, err := fileExpire(data)
+	if err != nil {
+		fc.corrupted(key, filename, err)
+		return nil, false
+	}
+	if expired(expire, time.Now()) {
+		fc.remove(filename)
+		return nil, false
+	}
+
+	content, err := fc.encoder().Unmarshal(data[fileHeaderSize:])
+	if err != nil {
+		fc.corrupted(key, filename, err)
+		return nil, false
+	}
+	return &FileCacheItem{Content: content, Expire: expire}, true
 }
 
-// Get cached value by key.
-func (fc *FileCache) Get(key string) interface{} {
-	filename := fc.getMD5Hash(key) + fc.Ext
+// readExpire returns the expire time of key from the file header, without decoding the value.
+func (fc *FileCache) readExpire(key string) (time.Time, bool) {
+	filename := fc.filename(key)
 
-	// Read file content
-	data, err := ioutil.ReadFile(filename)
+	f, err := os.Open(filename)
 	if err != nil {
-		return nil
+		return time.Time{}, false
+	}
+	header := make([]byte, fileHeaderSize)
+	_, err = io.ReadFull(f, header)
+	f.Close()
+
+	expire, ferr := fileExpire(header)
+	if err != nil || ferr != nil {
+		fc.corrupted(key, filename, errFileCorrupted)
+		return time.Time{}, false
+	}
+	if expired(expire, time.Now()) {
+		fc.remove(filename)
+		return time.Time{}, false
+	}
+	return expire, true
+}
+
+// corrupted removes a file which can't be read and reports err.
+func (fc *FileCache) corrupted(key, filename string, err error) {
+	os.Remove(filename)
+	fc.error(key, fmt.Errorf("cache: file %s: %v", filename, err))
+}
+
+// remove deletes an expired file.
+func (fc *FileCache) remove(filename string) {
+	if err := os.Remove(filename); err == nil {
+		fc.recordEviction(Expired)
+	}
+}
+
+// write stores the item of key in a temporary file renamed once complete.
+func (fc *FileCache) write(key string, item FileCacheItem) error {
+	data, err := fc.encoder().Marshal(item.Content)
+	if err != nil {
+		return err
 	}
 
-	var item FileCacheItem
-	gobDecode(data, &item)
+	header := make([]byte, fileHeaderSize)
+	copy(header, fileMagic)
+	if !item.Expire.IsZero() {
+		binary.BigEndian.PutUint64(header[len(fileMagic):], uint64(item.Expire.UnixNano()))
+	}
 
-	// If expired, removes the file and return an empty string
-	if item.Expire.Before(time.Now()) {
-		os.Remove(filename)
-		return ""
+	filename := fc.filename(key)
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, fc.dirPerm()); err != nil {
+		return err
 	}
 
-	return item.Content
+	f, err := ioutil.TempFile(dir, fileTempPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(header)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Chmod(fc.filePerm())
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (fc *FileCache) dirPerm() os.FileMode {
+	if fc.config.DirPerm == 0 {
+		return os.FileMode(DefaultFileCacheConfig.DirPerm)
+	}
+	return os.FileMode(fc.config.DirPerm)
+}
+
+func (fc *FileCache) filePerm() os.FileMode {
+	if fc.config.FilePerm == 0 {
+		return os.FileMode(DefaultFileCacheConfig.FilePerm)
+	}
+	return os.FileMode(fc.config.FilePerm)
 }
 
 // GetMulti values of Get.
@@ -104,46 +351,384 @@ func (fc *FileCache) GetMulti(keys []string) []interface{} {
 	return out
 }
 
-// Put sets the cache value with key and timeout.
+// Put sets the cache value with key and timeout, NoExpiration never expires.
 func (fc *FileCache) Put(key string, value interface{}, timeout time.Duration) error {
-	gob.Register(value)
+	return fc.write(key, FileCacheItem{Content: value, Expire: expiration(time.Now(), timeout)})
+}
+
+// PutMulti sets the values of Put with the same timeout.
+func (fc *FileCache) PutMulti(values map[string]interface{}, timeout time.Duration) error {
+	for key, value := range values {
+		if err := fc.Put(key, value, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	item := FileCacheItem{Content: value}
-	item.Expire = time.Now().Add(timeout)
+// Add sets the cache value only if key is missing, it reports whether it was set.
+// It's atomic only within the process.
+func (fc *FileCache) Add(key string, value interface{}, timeout time.Duration) (bool, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
 
-	data, err := gobEncode(item)
-	if err != nil {
-		return err
+	if _, ok := fc.readExpire(key); ok {
+		return false, nil
+	}
+
+	if err := fc.Put(key, value, timeout); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Increment adds delta to the integer value of key and returns the new value.
+// A missing key is set to delta without expiration, the value is stored as int64.
+// It's atomic only within the process.
+func (fc *FileCache) Increment(key string, delta int64) (int64, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	item, ok := fc.read(key)
+	if !ok {
+		item = &FileCacheItem{}
+	}
+
+	var n int64
+	if ok {
+		current, err := toInt64(item.Content)
+		if err != nil {
+			return 0, err
+		}
+		n = current
+	}
+	n += delta
+
+	item.Content = n
+	return n, fc.write(key, *item)
+}
+
+// Decrement subtracts delta from the integer value of key, see Increment.
+func (fc *FileCache) Decrement(key string, delta int64) (int64, error) {
+	return fc.Increment(key, -delta)
+}
+
+// Touch sets a new timeout to key, it reports whether key was found.
+func (fc *FileCache) Touch(key string, timeout time.Duration) (bool, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	item, ok := fc.read(key)
+	if !ok {
+		return false, nil
 	}
 
-	return ioutil.WriteFile(fc.getMD5Hash(key)+fc.Ext, data, 0644)
+	item.Expire = expiration(time.Now(), timeout)
+	return true, fc.write(key, *item)
+}
+
+// TTL returns the remaining timeout of key (NoExpiration without timeout) and whether key was found.
+func (fc *FileCache) TTL(key string) (time.Duration, bool) {
+	expire, ok := fc.readExpire(key)
+	if !ok {
+		return 0, false
+	}
+	return remaining(expire), true
 }
 
 // Delete cached value by key.
 func (fc *FileCache) Delete(key string) error {
-	filename := fc.getMD5Hash(key) + fc.Ext
-	if ok := fileExists(filename); ok {
-		return os.Remove(filename)
+	err := os.Remove(fc.filename(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteMulti values of Delete.
+func (fc *FileCache) DeleteMulti(keys []string) error {
+	for _, key := range keys {
+		if err := fc.Delete(key); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Exists check if cached value exists.
+// Exists check if cached value exists and isn't expired.
 func (fc *FileCache) Exists(key string) bool {
-	return fileExists(fc.getMD5Hash(key) + fc.Ext)
+	_, ok := fc.readExpire(key)
+	return ok
 }
 
-// ClearAll removes all cached values.
+// ClearAll removes all cached values and the tag indexes, the cache directory is kept.
 func (fc *FileCache) ClearAll() error {
-	files, err := filepath.Glob(fc.Path + "/*" + fc.Ext)
+	err := fc.walk(func(path string, info os.FileInfo) error {
+		if strings.HasPrefix(info.Name(), fileTempPrefix) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	return os.RemoveAll(filepath.Join(fc.Path, fileTagDir))
+}
 
-	for _, file := range files {
-		os.Remove(file)
+// PutWithTags sets the cache value with key and timeout and tags it, see PutWithTags.
+func (fc *FileCache) PutWithTags(key string, value interface{}, timeout time.Duration, tags ...string) error {
+	return PutWithTags(fc, key, value, timeout, tags...)
+}
+
+// InvalidateTag deletes the values tagged with tag.
+func (fc *FileCache) InvalidateTag(tag string) error {
+	return InvalidateTag(fc, tag)
+}
+
+// TagKeys adds keys to the index of each tag, see TagIndexer. An index is a directory with
+// a marker file per key, named by the MD5 hash of the key and containing the key, so adding
+// a key doesn't rewrite the index and is safe across the processes sharing the directory.
+// The markers of the missing keys are removed by DeleteExpired.
+func (fc *FileCache) TagKeys(keys []string, timeout time.Duration, tags ...string) error {
+	for _, tag := range tags {
+		dir := fc.tagDirname(tag)
+		for _, key := range keys {
+			if err := fc.writeMarker(dir, key); err != nil {
+				return fmt.Errorf("cache: tag %s: %v", tag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// TakeTag deletes the index of tag and returns its keys, see TagIndexer. The index directory is
+// renamed first, so the keys tagged meanwhile are added to a new index.
+func (fc *FileCache) TakeTag(tag string) ([]string, error) {
+	root := filepath.Join(fc.Path, fileTagDir)
+	if err := os.MkdirAll(root, fc.dirPerm()); err != nil {
+		return nil, fmt.Errorf("cache: tag %s: %v", tag, err)
+	}
+	tmp, err := ioutil.TempDir(root, fileTempPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("cache: tag %s: %v", tag, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "tag")
+	if err := os.Rename(fc.tagDirname(tag), dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cache: tag %s: %v", tag, err)
+	}
+
+	var keys []string
+	err = fc.walkMarkers(dir, func(path, key string) {
+		keys = append(keys, key)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cache: tag %s: %v", tag, err)
 	}
+	return keys, nil
+}
+
+// tagDirname returns the index directory of tag, named by the MD5 hash of tag.
+func (fc *FileCache) tagDirname(tag string) string {
+	sum := md5.Sum([]byte(tag))
+	return filepath.Join(fc.Path, fileTagDir, hex.EncodeToString(sum[:]))
+}
 
-	os.Remove(fc.Path)
+// writeMarker adds the marker of key to the index dir, in a temporary file renamed once complete.
+// It's retried when the directory is taken meanwhile by TakeTag, the marker goes in the new index.
+func (fc *FileCache) writeMarker(dir, key string) error {
+	sum := md5.Sum([]byte(key))
+	filename := filepath.Join(dir, hex.EncodeToString(sum[:]))
+
+	var err error
+	for i := 0; i < 8; i++ {
+		if err = os.MkdirAll(dir, fc.dirPerm()); err != nil {
+			return err
+		}
+
+		var f *os.File
+		if f, err = ioutil.TempFile(dir, fileTempPrefix); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		_, err = f.WriteString(key)
+		if err == nil {
+			err = f.Chmod(fc.filePerm())
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), filename)
+		}
+		if err == nil {
+			return nil
+		}
+		os.Remove(f.Name())
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// walkMarkers calls fn with the path and the key of the markers in the index dir.
+func (fc *FileCache) walkMarkers(dir string, fn func(path, key string)) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), fileTempPrefix) {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		key, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		fn(path, string(key))
+	}
 	return nil
 }
+
+// pruneTags removes the markers of the missing keys, the temporary files and directories
+// left by the interrupted TagKeys and TakeTag, and the empty indexes.
+func (fc *FileCache) pruneTags(now time.Time) {
+	root := filepath.Join(fc.Path, fileTagDir)
+	dirs, err := ioutil.ReadDir(root)
+	if err != nil {
+		return
+	}
+
+	for _, info := range dirs {
+		path := filepath.Join(root, info.Name())
+		if strings.HasPrefix(info.Name(), fileTempPrefix) {
+			if now.Sub(info.ModTime()) > time.Hour {
+				os.RemoveAll(path)
+			}
+			continue
+		}
+		if !info.IsDir() {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if strings.HasPrefix(file.Name(), fileTempPrefix) && now.Sub(file.ModTime()) > time.Hour {
+				os.Remove(filepath.Join(path, file.Name()))
+			}
+		}
+		_ = fc.walkMarkers(path, func(marker, key string) {
+			if !fc.Exists(key) {
+				os.Remove(marker)
+			}
+		})
+		// Kept unless empty, writeMarker recreates it meanwhile.
+		os.Remove(path)
+	}
+}
+
+// Namespace returns a view with the keys prefixed by name, see NewNamespace.
+func (fc *FileCache) Namespace(name string) Cache {
+	return NewNamespace(fc, name)
+}
+
+// Loader returns the Loader shared by the GetOrLoad calls, see LoaderOf.
+func (fc *FileCache) Loader() *Loader {
+	return fc.loader.get(fc)
+}
+
+// DeleteExpired removes the expired files and the temporary files left by
+// interrupted writes, it's called periodically by the GC.
+func (fc *FileCache) DeleteExpired() {
+	now := time.Now()
+
+	_ = fc.walk(func(path string, info os.FileInfo) error {
+		if strings.HasPrefix(info.Name(), fileTempPrefix) {
+			// Still written when recent.
+			if now.Sub(info.ModTime()) > time.Hour {
+				os.Remove(path)
+			}
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		header := make([]byte, fileHeaderSize)
+		_, err = io.ReadFull(f, header)
+		f.Close()
+
+		expire, ferr := fileExpire(header)
+		if err != nil || ferr != nil {
+			fc.corrupted("", path, errFileCorrupted)
+		} else if expired(expire, now) {
+			fc.remove(path)
+		}
+		return nil
+	})
+
+	fc.pruneTags(now)
+}
+
+// walk calls fn with the cache files and the temporary files, out of the tag indexes.
+func (fc *FileCache) walk(fn func(path string, info os.FileInfo) error) error {
+	tags := filepath.Join(fc.Path, fileTagDir)
+	err := filepath.Walk(fc.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path == tags {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := info.Name()
+		if strings.HasPrefix(name, fileTempPrefix) || (strings.HasSuffix(name, fc.Ext) && len(name) == md5.Size*2+len(fc.Ext)) {
+			return fn(path, info)
+		}
+		return nil
+	})
+	return err
+}
+
+// janitor removes the expired files every interval until stop is closed.
+func (fc *FileCache) janitor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fc.DeleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestFileCache returns a FileCache in a temporary directory, config is merged
+// with the path and the GC is disabled unless set.
+func newTestFileCache(t *testing.T, config string) *FileCache {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	c := map[string]interface{}{"every": -1}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c["path"] = filepath.Join(dir, "cache")
+	b, _ := json.Marshal(c)
+
+	fc, err := NewCache("file", string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fc.(*FileCache).Close() })
+	return fc.(*FileCache)
+}
+
+func TestFileCacheConfig(t *testing.T) {
+	fc := newTestFileCache(t, `{"levels": 2, "ext": ".cache", "dir_perm": "0700", "file_perm": "0600"}`)
+
+	if err := fc.Put("key", "v", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := fc.filename("key")
+	rel, _ := filepath.Rel(fc.Path, filename)
+	if parts := strings.Split(rel, string(filepath.Separator)); len(parts) != 3 || !strings.HasSuffix(parts[2], ".cache") ||
+		!strings.HasPrefix(parts[2], parts[0]+parts[1]) {
+		t.Fatalf("unexpected file %s", rel)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected file permission %v", info.Mode())
+	}
+	if info, _ := os.Stat(filepath.Dir(filename)); info.Mode().Perm() != 0700 {
+		t.Fatalf("unexpected directory permission %v", info.Mode())
+	}
+
+	// No temporary file is left.
+	files, _ := ioutil.ReadDir(filepath.Dir(filename))
+	if len(files) != 1 {
+		t.Fatalf("unexpected files %d", len(files))
+	}
+
+	for _, config := range []string{`{"path": ""}`, `{"levels": 9}`, `{"codec": "xml"}`,
+		`{"file_perm": "0999"}`, `{"dir_perm": 0}`, `{"every": "soon"}`} {
+		if _, err := NewCache("file", config); err == nil {
+			t.Errorf("%s: expected an error", config)
+		}
+	}
+}
+
+func TestFileCacheExpiration(t *testing.T) {
+	fc := newTestFileCache(t, "")
+
+	_ = fc.Put("short", "v", 20*time.Millisecond)
+	_ = fc.Put("forever", "v", NoExpiration)
+	time.Sleep(40 * time.Millisecond)
+
+	// The header is enough to tell an expired file.
+	if fc.Exists("short") || fileExists(fc.filename("short")) {
+		t.Fatal("expired file found")
+	}
+
+	_ = fc.Put("gc", "v", 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+
+	// The GC removes the expired files and the old temporary files.
+	temp := filepath.Join(fc.Path, fileTempPrefix+"1")
+	_ = ioutil.WriteFile(temp, []byte("partial"), 0644)
+	old := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(temp, old, old)
+	recent := filepath.Join(fc.Path, fileTempPrefix+"2")
+	_ = ioutil.WriteFile(recent, []byte("partial"), 0644)
+
+	fc.DeleteExpired()
+	if fileExists(fc.filename("gc")) || fileExists(temp) {
+		t.Fatal("expired files not removed")
+	}
+	if !fileExists(recent) || !fc.Exists("forever") {
+		t.Fatal("files removed by the GC")
+	}
+	if stats := fc.Stats(); stats.Expirations != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// ClearAll keeps the files being written.
+	_ = fc.ClearAll()
+	if !fileExists(recent) || fc.Exists("forever") {
+		t.Fatal("unexpected files after ClearAll")
+	}
+
+	gc := newTestFileCache(t, `{"every": "10ms"}`)
+	_ = gc.Put("key", "v", 5*time.Millisecond)
+	filename := gc.filename("key")
+	deadline := time.Now().Add(time.Second)
+	for fileExists(filename) {
+		if time.Now().After(deadline) {
+			t.Fatal("GC not running")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFileCacheCorrupted(t *testing.T) {
+	fc := newTestFileCache(t, "")
+
+	var mu sync.Mutex
+	var errs []error
+	fc.OnError(func(key string, err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+
+	_ = fc.Put("truncated", "v", time.Minute)
+	_ = ioutil.WriteFile(fc.filename("truncated"), []byte(fileMagic), 0644)
+	_ = fc.Put("value", "v", time.Minute)
+	data, _ := ioutil.ReadFile(fc.filename("value"))
+	_ = ioutil.WriteFile(fc.filename("value"), data[:len(data)-2], 0644)
+
+	if fc.Exists("truncated") {
+		t.Fatal("truncated file found")
+	}
+	if v, ok := fc.Lookup("value"); ok || v != nil {
+		t.Fatal("undecodable value found")
+	}
+	if fileExists(fc.filename("truncated")) || fileExists(fc.filename("value")) {
+		t.Fatal("corrupted files not removed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), errFileCorrupted.Error()) {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	var c struct{ Perm FileMode }
+	for config, mode := range map[string]FileMode{`{"perm": "0640"}`: 0640, `{"perm": "755"}`: 0755, `{"perm": 384}`: 0600} {
+		if err := json.Unmarshal([]byte(config), &c); err != nil || c.Perm != mode {
+			t.Errorf("%s: unexpected mode %o %v", config, c.Perm, err)
+		}
+	}
+}
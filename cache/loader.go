@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type (
+	// LoadFunc computes the value of a missing key, see Loader.
+	LoadFunc func() (interface{}, error)
+
+	// Loader gets the values from Cache, loading the missing ones once:
+	// the concurrent GetOrLoad of the same key wait for a single LoadFunc call.
+	Loader struct {
+		Cache Cache
+		// Stale keeps the values for Stale after their timeout: GetOrLoad returns
+		// the stale value while a single goroutine refreshes it.
+		Stale time.Duration
+		// Beta enables the probabilistic early expiration when > 0 (1 is the usual value,
+		// greater values refresh earlier): the closer the timeout and the slower the
+		// last load, the more likely a GetOrLoad refreshes the value before it expires.
+		Beta float64
+		// OnError is called with the errors of the background refreshes
+		// and of the Put of the loaded values.
+		OnError func(key string, err error)
+
+		group  loadGroup
+		mu     sync.Mutex
+		deltas map[string]time.Duration
+	}
+
+	// adapterLoader holds the Loader of an adapter, shared by its GetOrLoad calls.
+	adapterLoader struct {
+		mu     sync.Mutex
+		loader *Loader
+	}
+
+	// loadGroup collapses the concurrent loads of a key.
+	loadGroup struct {
+		mu    sync.Mutex
+		calls map[string]*loadCall
+	}
+
+	loadCall struct {
+		wg    sync.WaitGroup
+		value interface{}
+		err   error
+	}
+)
+
+// maxLoadDeltas bounds the load durations kept for the early expiration.
+const maxLoadDeltas = 10000
+
+// NewLoader returns a Loader of c without stale values and early expiration.
+func NewLoader(c Cache) *Loader {
+	return &Loader{Cache: c}
+}
+
+// LoaderOf returns the Loader shared by the GetOrLoad calls of c: the one returned by
+// the adapter Loader method, the adapter one for the namespaces, or else a new Loader.
+func LoaderOf(c Cache) *Loader {
+	if ns, ok := c.(*NamespaceCache); ok {
+		c = ns.cache
+	}
+	if a, ok := c.(interface{ Loader() *Loader }); ok {
+		return a.Loader()
+	}
+	return NewLoader(c)
+}
+
+// GetOrLoad returns the value of key from c or, when missing, the value returned by load,
+// cached with ttl. The calls share the Loader of c, see LoaderOf and Loader.GetOrLoad.
+func GetOrLoad(c Cache, key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	if ns, ok := c.(*NamespaceCache); ok {
+		// The namespace keys are collapsed with the adapter ones, the values cached by ns.
+		return LoaderOf(ns.cache).getOrLoad(ns, ns.key(key), key, ttl, load)
+	}
+	return LoaderOf(c).GetOrLoad(key, ttl, load)
+}
+
+// get returns the Loader of the adapter c, created on first use.
+func (a *adapterLoader) get(c Cache) *Loader {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.loader == nil {
+		a.loader = NewLoader(c)
+	}
+	return a.loader
+}
+
+// GetOrLoad returns the cached value of key or, when missing, the value returned by load,
+// cached with ttl. Concurrent calls of the same key wait for a single load.
+// The load errors are returned and not cached.
+func (l *Loader) GetOrLoad(key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	return l.getOrLoad(l.Cache, key, key, ttl, load)
+}
+
+// getOrLoad gets key from c, the loads are collapsed by id.
+func (l *Loader) getOrLoad(c Cache, id, key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	v, ok := c.Lookup(key)
+	if !ok {
+		return l.load(c, id, key, ttl, load)
+	}
+
+	if ttl <= NoExpiration || (l.Stale <= 0 && l.Beta <= 0) {
+		return v, nil
+	}
+
+	remaining, ok := c.TTL(key)
+	if !ok || remaining == NoExpiration {
+		return v, nil
+	}
+	remaining -= l.Stale
+
+	switch {
+	case remaining <= 0:
+		// Stale: refresh in background.
+		l.refresh(c, id, key, ttl, load)
+	case l.Beta > 0 && l.early(id, remaining):
+		if l.Stale > 0 {
+			l.refresh(c, id, key, ttl, load)
+			return v, nil
+		}
+		return l.load(c, id, key, ttl, load)
+	}
+	return v, nil
+}
+
+// load calls load once for the concurrent calls of id and caches the value.
+func (l *Loader) load(c Cache, id, key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	call, leader := l.group.join(id)
+	if !leader {
+		call.wg.Wait()
+		return call.value, call.err
+	}
+
+	l.run(call, c, id, key, ttl, load, false)
+	return call.value, call.err
+}
+
+// refresh loads id in background, unless it's already loading.
+func (l *Loader) refresh(c Cache, id, key string, ttl time.Duration, load LoadFunc) {
+	call, leader := l.group.join(id)
+	if !leader {
+		return
+	}
+
+	go func() {
+		l.run(call, c, id, key, ttl, load, true)
+		if call.err != nil && l.OnError != nil {
+			l.OnError(key, call.err)
+		}
+	}()
+}
+
+// run calls load for the call of id and caches the value in c. The panics of the
+// background loads are recovered as the call error, the others reach the caller.
+func (l *Loader) run(call *loadCall, c Cache, id, key string, ttl time.Duration, load LoadFunc, background bool) {
+	defer l.group.done(id, call)
+	if background {
+		// Before done, the waiting calls get the error.
+		defer func() {
+			if r := recover(); r != nil {
+				call.value, call.err = nil, fmt.Errorf("cache: load of %s panicked: %v", key, r)
+			}
+		}()
+	}
+
+	start := time.Now()
+	v, err := load()
+	if err != nil {
+		call.value, call.err = nil, err
+		return
+	}
+	l.setDelta(id, time.Since(start))
+
+	timeout := ttl
+	if ttl > NoExpiration {
+		timeout += l.Stale
+	}
+	if err := c.Put(key, v, timeout); err != nil && l.OnError != nil {
+		l.OnError(key, err)
+	}
+	call.value, call.err = v, nil
+}
+
+// early reports whether to refresh a value expiring in remaining (XFetch).
+func (l *Loader) early(key string, remaining time.Duration) bool {
+	l.mu.Lock()
+	delta := l.deltas[key]
+	l.mu.Unlock()
+
+	if delta <= 0 {
+		return false
+	}
+	return -float64(delta)*l.Beta*math.Log(1-rand.Float64()) >= float64(remaining)
+}
+
+func (l *Loader) setDelta(key string, delta time.Duration) {
+	if l.Beta <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	if l.deltas == nil || len(l.deltas) >= maxLoadDeltas {
+		l.deltas = make(map[string]time.Duration)
+	}
+	l.deltas[key] = delta
+	l.mu.Unlock()
+}
+
+// join returns the running call of key or, with leader true, a new call
+// the caller must run and complete with done.
+func (g *loadGroup) join(key string) (*loadCall, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+
+	// Returned to the waiting calls if the load panics.
+	c := &loadCall{err: fmt.Errorf("cache: load of %s panicked", key)}
+	c.wg.Add(1)
+	g.calls[key] = c
+	return c, true
+}
+
+// done completes the call c of key, the waiting calls get its results.
+func (g *loadGroup) done(key string, c *loadCall) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	c.wg.Done()
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	c := newTestMemoryCache(t, "")
+
+	var calls int32
+	release := make(chan struct{})
+	load := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := GetOrLoad(c, "key", time.Minute, load); v != "value" || err != nil {
+				t.Errorf("unexpected value %v %v", v, err)
+			}
+		}()
+	}
+
+	// Let the goroutines wait on the first load.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("load called %d times", calls)
+	}
+	if c.Get("key") != "value" {
+		t.Fatal("loaded value not cached")
+	}
+
+	if _, err := GetOrLoad(c, "error", time.Minute, func() (interface{}, error) {
+		return nil, errors.New("failed")
+	}); err == nil || c.Exists("error") {
+		t.Fatal("expected the load error, not cached")
+	}
+}
+
+func TestGetOrLoadStale(t *testing.T) {
+	c := newTestMemoryCache(t, "")
+
+	refreshed := make(chan struct{})
+	l := &Loader{Cache: c, Stale: time.Minute}
+
+	if v, _ := l.GetOrLoad("key", 20*time.Millisecond, func() (interface{}, error) { return 1, nil }); v != 1 {
+		t.Fatalf("unexpected value %v", v)
+	}
+	if ttl, _ := c.TTL("key"); ttl < time.Minute {
+		t.Fatalf("stale period not cached, TTL %v", ttl)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	var calls int32
+	load := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-refreshed
+		}
+		return 2, nil
+	}
+
+	// The stale value is returned while a single refresh runs.
+	for i := 0; i < 5; i++ {
+		if v, err := l.GetOrLoad("key", 20*time.Millisecond, load); v != 1 || err != nil {
+			t.Fatalf("expected the stale value, got %v %v", v, err)
+		}
+	}
+	close(refreshed)
+
+	deadline := time.Now().Add(time.Second)
+	for c.Get("key") != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("value not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("refresh called %d times", n)
+	}
+}
+
+func TestGetOrLoadEarlyExpiration(t *testing.T) {
+	c := newTestMemoryCache(t, "")
+	l := &Loader{Cache: c, Beta: 1}
+
+	var calls int32
+	load := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "v", nil
+	}
+
+	_, _ = l.GetOrLoad("key", time.Hour, load)
+
+	// Far from the expiration a slow load isn't refreshed early.
+	for i := 0; i < 100; i++ {
+		_, _ = l.GetOrLoad("key", time.Hour, load)
+	}
+	if calls != 1 {
+		t.Fatalf("unexpected early refresh, %d loads", calls)
+	}
+
+	// Close to the expiration it's almost always refreshed.
+	_, _ = c.Touch("key", time.Millisecond)
+	l.setDelta("key", time.Hour)
+	_, _ = l.GetOrLoad("key", time.Hour, load)
+	if calls != 2 {
+		t.Fatalf("expected an early refresh, %d loads", calls)
+	}
+}
+
+func TestGetOrLoadNamespace(t *testing.T) {
+	c := newTestMemoryCache(t, "")
+
+	if LoaderOf(c) != LoaderOf(c.Namespace("users")) || LoaderOf(c) != c.Loader() {
+		t.Fatal("the namespaces don't share the adapter Loader")
+	}
+
+	var calls int32
+	release := make(chan struct{})
+	load := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "ann", nil
+	}
+
+	// Each call uses a new view, the loads are collapsed anyway.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := GetOrLoad(c.Namespace("users"), "1", time.Minute, load); v != "ann" || err != nil {
+				t.Errorf("unexpected value %v %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("load called %d times", calls)
+	}
+
+	// Cached in the namespace.
+	users := c.Namespace("users")
+	if users.Get("1") != "ann" {
+		t.Fatal("loaded value not cached in the namespace")
+	}
+	_ = users.ClearAll()
+	if c.Exists("users:1") {
+		t.Fatal("loaded value not cleared with the namespace")
+	}
+}
+
+func TestGetOrLoadRefreshPanic(t *testing.T) {
+	c := newTestMemoryCache(t, "")
+
+	errs := make(chan error, 1)
+	l := &Loader{Cache: c, Stale: time.Minute, OnError: func(key string, err error) { errs <- err }}
+
+	_, _ = l.GetOrLoad("key", 10*time.Millisecond, func() (interface{}, error) { return 1, nil })
+	time.Sleep(20 * time.Millisecond)
+
+	// The panic of the background refresh is reported, the stale value returned.
+	v, err := l.GetOrLoad("key", 10*time.Millisecond, func() (interface{}, error) { panic("boom") })
+	if v != 1 || err != nil {
+		t.Fatalf("expected the stale value, got %v %v", v, err)
+	}
+
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic not reported")
+	}
+	if c.Get("key") != 1 {
+		t.Fatal("stale value replaced")
+	}
+}
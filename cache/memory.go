@@ -1,55 +1,249 @@
 package cache
 
 import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
 	"sync"
 	"time"
 )
 
+const (
+	// LRU evicts the least recently used values.
+	LRU = "lru"
+	// LFU evicts the least frequently used values, the least recently used first on ties.
+	LFU = "lfu"
+)
+
+const (
+	// Evicted values have been removed to respect the max entries or bytes.
+	Evicted EvictionReason = iota + 1
+	// Expired values have been removed after their timeout.
+	Expired
+)
+
 type (
+	// EvictionReason tells why a value has been removed, see MemoryCache.OnEvict.
+	EvictionReason int
+
+	// MemoryCacheConfig is the JSON config of the MemoryCache, f.e.
+	// {"shards": 16, "max_entries": 10000, "max_bytes": 67108864, "policy": "lfu", "every": "1m"}
+	MemoryCacheConfig struct {
+		// Shards is the number of independently locked partitions, rounded to a power of two.
+		Shards int `json:"shards"`
+		// MaxEntries is the maximum number of values, 0 is unlimited.
+		MaxEntries int `json:"max_entries"`
+		// MaxBytes is the maximum estimated size of keys and values, 0 is unlimited.
+		MaxBytes int64 `json:"max_bytes"`
+		// Policy chooses the evicted values, LRU (default) or LFU.
+		Policy string `json:"policy"`
+		// Every is the interval between the removals of the expired values, 1 minute by default.
+		// A negative value disables the janitor, the expired values are removed when read.
+		Every Duration `json:"every"`
+	}
+
 	// MemoryCacheItem contains the cached data and expire time.
 	MemoryCacheItem struct {
 		Content interface{}
 		Expire  time.Time
+
+		key     string
+		size    int64
+		hits    uint64
+		element *list.Element
+		index   int
+		tick    uint64
 	}
 
 	// MemoryCache is memory cache adapter.
+	// The values are stored in shards, each one bounded by a share of MaxEntries and MaxBytes.
 	MemoryCache struct {
-		sync.RWMutex
-		items map[string]*MemoryCacheItem
+		counters
+		loader adapterLoader
+
+		config  MemoryCacheConfig
+		shards  []*memoryShard
+		mask    uint32
+		onEvict func(key string, value interface{}, reason EvictionReason)
+		stop    chan struct{}
+		closeMu sync.Mutex
+
+		// tags are the tag indexes, the tagged keys by tag, see TagKeys.
+		tagMu sync.Mutex
+		tags  map[string]map[string]bool
+	}
 
-		dur   time.Duration
-		Every int // run an expiration check Every clock time
+	memoryShard struct {
+		sync.Mutex
+		items      map[string]*MemoryCacheItem
+		policy     evictionPolicy
+		bytes      int64
+		maxEntries int
+		maxBytes   int64
+	}
+
+	// eviction is a removed value, notified once the shard is unlocked.
+	eviction struct {
+		item   *MemoryCacheItem
+		reason EvictionReason
 	}
 )
 
+// DefaultMemoryCacheConfig is used for the missing MemoryCache config values.
+var DefaultMemoryCacheConfig = MemoryCacheConfig{
+	Shards: 16,
+	Policy: LRU,
+	Every:  Duration(time.Minute),
+}
+
 // NewMemoryCache instantiate a new MemoryCache.
+// It's unbounded until Init, which starts the janitor.
 func NewMemoryCache() Cache {
-	return &MemoryCache{items: make(map[string]*MemoryCacheItem)}
+	mc := &MemoryCache{}
+	_ = mc.configure(DefaultMemoryCacheConfig)
+	return mc
 }
 
-// Init initialize the cache adapter with provided config string.
+// String returns the reason name.
+func (r EvictionReason) String() string {
+	if r == Expired {
+		return "expired"
+	}
+	return "evicted"
+}
+
+// Init initialize the cache adapter with provided config string, see MemoryCacheConfig.
+// The cached values are removed.
 func (mc *MemoryCache) Init(config string) error {
+	c := DefaultMemoryCacheConfig
+	if err := parseConfig(config, &c); err != nil {
+		return err
+	}
+
+	if err := mc.configure(c); err != nil {
+		return err
+	}
+
+	if c.Every > 0 {
+		mc.closeMu.Lock()
+		mc.stop = make(chan struct{})
+		go mc.janitor(time.Duration(c.Every), mc.stop)
+		mc.closeMu.Unlock()
+	}
+	return nil
+}
+
+// configure creates the shards.
+func (mc *MemoryCache) configure(c MemoryCacheConfig) error {
+	if c.Policy != LRU && c.Policy != LFU {
+		return fmt.Errorf("cache: unknown eviction policy %s", c.Policy)
+	}
+	if c.MaxEntries < 0 || c.MaxBytes < 0 {
+		return fmt.Errorf("cache: negative max_entries or max_bytes")
+	}
+
+	n := 1
+	for n < c.Shards {
+		n <<= 1
+	}
+	// Each shard must hold at least a value.
+	for n > 1 && c.MaxEntries > 0 && c.MaxEntries < n {
+		n >>= 1
+	}
+	c.Shards = n
+
+	_ = mc.Close()
+
+	mc.tagMu.Lock()
+	mc.tags = make(map[string]map[string]bool)
+	mc.tagMu.Unlock()
+
+	mc.config = c
+	mc.mask = uint32(n - 1)
+	mc.shards = make([]*memoryShard, n)
+	for i := range mc.shards {
+		mc.shards[i] = &memoryShard{
+			items:      make(map[string]*MemoryCacheItem),
+			policy:     newEvictionPolicy(c.Policy),
+			maxEntries: (c.MaxEntries + n - 1) / n,
+			maxBytes:   (c.MaxBytes + int64(n) - 1) / int64(n),
+		}
+	}
 	return nil
 }
 
-// Get cached value by key.
+// OnEvict sets fn, called when a value expires or is evicted to make room.
+// It's not called by Delete and ClearAll.
+func (mc *MemoryCache) OnEvict(fn func(key string, value interface{}, reason EvictionReason)) {
+	mc.onEvict = fn
+}
+
+// Close stops the janitor.
+func (mc *MemoryCache) Close() error {
+	mc.closeMu.Lock()
+	if mc.stop != nil {
+		close(mc.stop)
+		mc.stop = nil
+	}
+	mc.closeMu.Unlock()
+	return nil
+}
+
+// Len returns the number of cached values, the expired ones not yet removed included.
+func (mc *MemoryCache) Len() int {
+	n := 0
+	for _, s := range mc.shards {
+		s.Lock()
+		n += len(s.items)
+		s.Unlock()
+	}
+	return n
+}
+
+// Bytes returns the estimated size of the cached keys and values, 0 without MaxBytes:
+// the values are sized only to enforce it.
+func (mc *MemoryCache) Bytes() int64 {
+	var n int64
+	for _, s := range mc.shards {
+		s.Lock()
+		n += s.bytes
+		s.Unlock()
+	}
+	return n
+}
+
+func (mc *MemoryCache) shard(key string) *memoryShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return mc.shards[h.Sum32()&mc.mask]
+}
+
+// Get cached value by key, nil when missing.
 func (mc *MemoryCache) Get(key string) interface{} {
-	mc.RLock()
-	item := mc.items[key]
+	v, _ := mc.Lookup(key)
+	return v
+}
+
+// Lookup returns the cached value by key and whether it was found.
+func (mc *MemoryCache) Lookup(key string) (interface{}, bool) {
+	s := mc.shard(key)
+
+	s.Lock()
+	item, evictions := s.get(key, time.Now())
 	if item == nil {
-		mc.RUnlock()
-		return ""
+		s.Unlock()
+		mc.record(false)
+		mc.evicted(evictions)
+		return nil, false
 	}
 
-	// If expired, removes the value from memory and return an empty string
-	if item.Expire.Before(time.Now()) {
-		mc.Delete(key)
-		mc.RUnlock()
-		return ""
-	}
+	item.hits++
+	s.policy.access(item)
+	content := item.Content
+	s.Unlock()
 
-	mc.RUnlock()
-	return item.Content
+	mc.record(true)
+	return content, true
 }
 
 // GetMulti values of Get.
@@ -61,47 +255,379 @@ func (mc *MemoryCache) GetMulti(keys []string) []interface{} {
 	return out
 }
 
-// Put sets the cache value with key and timeout.
+// Put sets the cache value with key and timeout, NoExpiration never expires.
+// The values bigger than a shard max bytes aren't cached and return an error.
 func (mc *MemoryCache) Put(key string, value interface{}, timeout time.Duration) error {
-	mc.Lock()
-	mc.items[key] = &MemoryCacheItem{
-		Content: value,
-		Expire:  time.Now().Add(timeout),
+	s := mc.shard(key)
+
+	now := time.Now()
+	size := s.sizeOf(key, value)
+
+	s.Lock()
+	evictions, err := s.put(key, value, size, expiration(now, timeout))
+	s.Unlock()
+
+	mc.evicted(evictions)
+	return err
+}
+
+// PutMulti sets the values of Put with the same timeout.
+func (mc *MemoryCache) PutMulti(values map[string]interface{}, timeout time.Duration) error {
+	var err error
+	for key, value := range values {
+		if perr := mc.Put(key, value, timeout); perr != nil && err == nil {
+			err = perr
+		}
 	}
-	mc.Unlock()
-	return nil
+	return err
+}
+
+// Add sets the cache value only if key is missing, it reports whether it was set.
+func (mc *MemoryCache) Add(key string, value interface{}, timeout time.Duration) (bool, error) {
+	s := mc.shard(key)
+	now := time.Now()
+	size := s.sizeOf(key, value)
+
+	s.Lock()
+	item, evictions := s.get(key, now)
+	if item != nil {
+		s.Unlock()
+		return false, nil
+	}
+
+	more, err := s.put(key, value, size, expiration(now, timeout))
+	s.Unlock()
+
+	mc.evicted(append(evictions, more...))
+	return err == nil, err
+}
+
+// Increment adds delta to the integer value of key and returns the new value.
+// A missing key is set to delta without expiration, the value is stored as int64.
+func (mc *MemoryCache) Increment(key string, delta int64) (int64, error) {
+	s := mc.shard(key)
+	now := time.Now()
+	size := s.sizeOf(key, int64(0))
+
+	s.Lock()
+	item, evictions := s.get(key, now)
+
+	var n int64
+	var expire time.Time
+	if item != nil {
+		current, err := toInt64(item.Content)
+		if err != nil {
+			s.Unlock()
+			return 0, err
+		}
+		n, expire = current, item.Expire
+	}
+	n += delta
+
+	more, err := s.put(key, n, size, expire)
+	s.Unlock()
+
+	mc.evicted(append(evictions, more...))
+	return n, err
+}
+
+// Decrement subtracts delta from the integer value of key, see Increment.
+func (mc *MemoryCache) Decrement(key string, delta int64) (int64, error) {
+	return mc.Increment(key, -delta)
+}
+
+// Touch sets a new timeout to key, it reports whether key was found.
+func (mc *MemoryCache) Touch(key string, timeout time.Duration) (bool, error) {
+	s := mc.shard(key)
+	now := time.Now()
+
+	s.Lock()
+	item, evictions := s.get(key, now)
+	if item != nil {
+		item.Expire = expiration(now, timeout)
+	}
+	s.Unlock()
+
+	mc.evicted(evictions)
+	return item != nil, nil
+}
+
+// TTL returns the remaining timeout of key (NoExpiration without timeout) and whether key was found.
+func (mc *MemoryCache) TTL(key string) (time.Duration, bool) {
+	s := mc.shard(key)
+
+	s.Lock()
+	item, evictions := s.get(key, time.Now())
+	var ttl time.Duration
+	if item != nil {
+		ttl = remaining(item.Expire)
+	}
+	s.Unlock()
+
+	mc.evicted(evictions)
+	return ttl, item != nil
 }
 
 // Delete cached value by key.
 func (mc *MemoryCache) Delete(key string) error {
-	mc.Lock()
-	delete(mc.items, key)
-	mc.Unlock()
+	s := mc.shard(key)
+
+	s.Lock()
+	if item := s.items[key]; item != nil {
+		s.remove(item)
+	}
+	s.Unlock()
+	return nil
+}
+
+// DeleteMulti values of Delete.
+func (mc *MemoryCache) DeleteMulti(keys []string) error {
+	for _, key := range keys {
+		_ = mc.Delete(key)
+	}
 	return nil
 }
 
 // Exists check if cached value exists.
 func (mc *MemoryCache) Exists(key string) bool {
-	mc.RLock()
-	defer mc.RUnlock()
-	if item, ok := mc.items[key]; ok {
-		if item.Expire.Before(time.Now()) {
-			mc.Delete(key)
-			return false
-		}
-		return true
-	}
-	return false
+	s := mc.shard(key)
+
+	s.Lock()
+	item, evictions := s.get(key, time.Now())
+	s.Unlock()
+
+	mc.evicted(evictions)
+	return item != nil
 }
 
 // ClearAll removes all cached values.
 func (mc *MemoryCache) ClearAll() error {
-	mc.Lock()
-	mc.items = make(map[string]*MemoryCacheItem)
-	mc.Unlock()
+	for _, s := range mc.shards {
+		s.Lock()
+		s.items = make(map[string]*MemoryCacheItem)
+		s.policy = newEvictionPolicy(mc.config.Policy)
+		s.bytes = 0
+		s.Unlock()
+	}
+
+	mc.tagMu.Lock()
+	mc.tags = make(map[string]map[string]bool)
+	mc.tagMu.Unlock()
+	return nil
+}
+
+// PutWithTags sets the cache value with key and timeout and tags it, see PutWithTags.
+func (mc *MemoryCache) PutWithTags(key string, value interface{}, timeout time.Duration, tags ...string) error {
+	return PutWithTags(mc, key, value, timeout, tags...)
+}
+
+// InvalidateTag deletes the values tagged with tag.
+func (mc *MemoryCache) InvalidateTag(tag string) error {
+	return InvalidateTag(mc, tag)
+}
+
+// TagKeys adds keys to the index of each tag, see TagIndexer.
+// The indexes are kept out of the shards, so they're neither evicted nor counted
+// in MaxEntries and MaxBytes; their missing keys are pruned.
+func (mc *MemoryCache) TagKeys(keys []string, timeout time.Duration, tags ...string) error {
+	mc.tagMu.Lock()
+	defer mc.tagMu.Unlock()
+
+	for _, tag := range tags {
+		index := mc.tags[tag]
+		if index == nil {
+			index = make(map[string]bool)
+			mc.tags[tag] = index
+		}
+		for _, key := range keys {
+			if index[key] {
+				continue
+			}
+			index[key] = true
+			if n := len(index); n >= pruneTagIndex && n&(n-1) == 0 {
+				mc.pruneTag(index, time.Now())
+			}
+		}
+	}
 	return nil
 }
 
-// func init() {
-// 	Register("memory", NewMemoryCache)
-// }
+// TakeTag deletes the index of tag and returns its keys, see TagIndexer.
+func (mc *MemoryCache) TakeTag(tag string) ([]string, error) {
+	mc.tagMu.Lock()
+	index := mc.tags[tag]
+	delete(mc.tags, tag)
+	mc.tagMu.Unlock()
+
+	keys := make([]string, 0, len(index))
+	for key := range index {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// pruneTag removes the missing keys from a tag index, tagMu must be locked.
+func (mc *MemoryCache) pruneTag(index map[string]bool, now time.Time) {
+	for key := range index {
+		s := mc.shard(key)
+
+		s.Lock()
+		item := s.items[key]
+		found := item != nil && !item.expired(now)
+		s.Unlock()
+
+		if !found {
+			delete(index, key)
+		}
+	}
+}
+
+// Namespace returns a view with the keys prefixed by name, see NewNamespace.
+func (mc *MemoryCache) Namespace(name string) Cache {
+	return NewNamespace(mc, name)
+}
+
+// Loader returns the Loader shared by the GetOrLoad calls, see LoaderOf.
+func (mc *MemoryCache) Loader() *Loader {
+	return mc.loader.get(mc)
+}
+
+// DeleteExpired removes the expired values, and their keys from the tag indexes,
+// it's called periodically by the janitor.
+func (mc *MemoryCache) DeleteExpired() {
+	now := time.Now()
+
+	for _, s := range mc.shards {
+		var evictions []eviction
+
+		s.Lock()
+		for _, item := range s.items {
+			if item.expired(now) {
+				s.remove(item)
+				evictions = append(evictions, eviction{item, Expired})
+			}
+		}
+		s.Unlock()
+
+		mc.evicted(evictions)
+	}
+
+	mc.tagMu.Lock()
+	for tag, index := range mc.tags {
+		if mc.pruneTag(index, now); len(index) == 0 {
+			delete(mc.tags, tag)
+		}
+	}
+	mc.tagMu.Unlock()
+}
+
+// janitor removes the expired values every interval until stop is closed.
+func (mc *MemoryCache) janitor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			mc.DeleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evicted counts the removed values and calls OnEvict.
+func (mc *MemoryCache) evicted(evictions []eviction) {
+	for _, e := range evictions {
+		mc.recordEviction(e.reason)
+		if mc.onEvict != nil {
+			mc.onEvict(e.item.key, e.item.Content, e.reason)
+		}
+	}
+}
+
+// get returns the value of key, nil when missing or expired.
+// The expired value is removed and returned as eviction. The shard must be locked.
+func (s *memoryShard) get(key string, now time.Time) (*MemoryCacheItem, []eviction) {
+	item := s.items[key]
+	if item == nil {
+		return nil, nil
+	}
+
+	if item.expired(now) {
+		s.remove(item)
+		return nil, []eviction{{item, Expired}}
+	}
+	return item, nil
+}
+
+// sizeOf returns the size of key and value for put, 0 without max bytes. It's computed
+// before locking the shard, sizing a value can be slow.
+func (s *memoryShard) sizeOf(key string, value interface{}) int64 {
+	if s.maxBytes == 0 {
+		return 0
+	}
+	return int64(len(key)) + sizeOf(value)
+}
+
+// put sets the value of key with its size, evicting the values over the shard limits.
+// The shard must be locked.
+func (s *memoryShard) put(key string, value interface{}, size int64, expire time.Time) ([]eviction, error) {
+	item := &MemoryCacheItem{
+		Content: value,
+		Expire:  expire,
+		key:     key,
+		size:    size,
+	}
+
+	// Rejected before removing the old value, which is kept.
+	if s.maxBytes > 0 && item.size > s.maxBytes {
+		return nil, fmt.Errorf("cache: value of %s too big (%d bytes)", key, item.size)
+	}
+
+	old := s.items[key]
+	if old != nil {
+		item.hits = old.hits
+		s.remove(old)
+	}
+
+	// Make room before adding, so the new value isn't the LFU victim.
+	evictions := s.evict(item.size, time.Now())
+
+	s.items[key] = item
+	s.bytes += item.size
+	s.policy.add(item)
+	return evictions, nil
+}
+
+// remove deletes item from the shard, the shard must be locked.
+func (s *memoryShard) remove(item *MemoryCacheItem) {
+	delete(s.items, item.key)
+	s.policy.remove(item)
+	s.bytes -= item.size
+}
+
+// evict removes the values chosen by the policy until a value of size fits in the shard limits.
+// The shard must be locked.
+func (s *memoryShard) evict(size int64, now time.Time) []eviction {
+	var evictions []eviction
+
+	for (s.maxEntries > 0 && len(s.items)+1 > s.maxEntries) || (s.maxBytes > 0 && s.bytes+size > s.maxBytes) {
+		item := s.policy.victim()
+		if item == nil {
+			break
+		}
+		s.remove(item)
+
+		reason := Evicted
+		if item.expired(now) {
+			reason = Expired
+		}
+		evictions = append(evictions, eviction{item, reason})
+	}
+	return evictions
+}
+
+func (item *MemoryCacheItem) expired(now time.Time) bool {
+	return !item.Expire.IsZero() && item.Expire.Before(now)
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"reflect"
+)
+
+// evictionPolicy orders the values of a shard, the shard lock protects it.
+type evictionPolicy interface {
+	add(item *MemoryCacheItem)
+	access(item *MemoryCacheItem)
+	remove(item *MemoryCacheItem)
+	// victim returns the next value to evict, nil when empty.
+	victim() *MemoryCacheItem
+}
+
+func newEvictionPolicy(name string) evictionPolicy {
+	if name == LFU {
+		return &lfuPolicy{}
+	}
+	return &lruPolicy{list: list.New()}
+}
+
+// lruPolicy keeps the values by access, the most recent at the front.
+type lruPolicy struct {
+	list *list.List
+}
+
+func (p *lruPolicy) add(item *MemoryCacheItem) {
+	item.element = p.list.PushFront(item)
+}
+
+func (p *lruPolicy) access(item *MemoryCacheItem) {
+	p.list.MoveToFront(item.element)
+}
+
+func (p *lruPolicy) remove(item *MemoryCacheItem) {
+	p.list.Remove(item.element)
+}
+
+func (p *lruPolicy) victim() *MemoryCacheItem {
+	if e := p.list.Back(); e != nil {
+		return e.Value.(*MemoryCacheItem)
+	}
+	return nil
+}
+
+// lfuPolicy is a min-heap by hits, the least recently used first on ties.
+type lfuPolicy struct {
+	items []*MemoryCacheItem
+	clock uint64
+}
+
+func (p *lfuPolicy) add(item *MemoryCacheItem) {
+	p.clock++
+	item.tick = p.clock
+	heap.Push(p, item)
+}
+
+func (p *lfuPolicy) access(item *MemoryCacheItem) {
+	p.clock++
+	item.tick = p.clock
+	heap.Fix(p, item.index)
+}
+
+func (p *lfuPolicy) remove(item *MemoryCacheItem) {
+	heap.Remove(p, item.index)
+}
+
+func (p *lfuPolicy) victim() *MemoryCacheItem {
+	if len(p.items) == 0 {
+		return nil
+	}
+	return p.items[0]
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface.
+func (p *lfuPolicy) Len() int { return len(p.items) }
+
+func (p *lfuPolicy) Less(i, j int) bool {
+	a, b := p.items[i], p.items[j]
+	if a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.tick < b.tick
+}
+
+func (p *lfuPolicy) Swap(i, j int) {
+	p.items[i], p.items[j] = p.items[j], p.items[i]
+	p.items[i].index = i
+	p.items[j].index = j
+}
+
+func (p *lfuPolicy) Push(x interface{}) {
+	item := x.(*MemoryCacheItem)
+	item.index = len(p.items)
+	p.items = append(p.items, item)
+}
+
+func (p *lfuPolicy) Pop() interface{} {
+	n := len(p.items)
+	item := p.items[n-1]
+	p.items[n-1] = nil
+	p.items = p.items[:n-1]
+	return item
+}
+
+// sizeOf estimates the memory used by v, f.e. the length of strings and byte slices.
+func sizeOf(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	switch v := v.(type) {
+	case []byte:
+		return int64(cap(v))
+	case string:
+		return int64(len(v))
+	case interface{ Size() int }:
+		return int64(v.Size())
+	}
+	return sizeOfValue(reflect.ValueOf(v), 0)
+}
+
+func sizeOfValue(v reflect.Value, depth int) int64 {
+	size := int64(v.Type().Size())
+	if depth > 8 {
+		return size
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		size += int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		elem := v.Type().Elem()
+		if v.Kind() == reflect.Slice {
+			size += int64(v.Cap()-v.Len()) * int64(elem.Size())
+		}
+		if !hasPointers(elem) {
+			// Sized at once, the elements have no content elsewhere.
+			if v.Kind() == reflect.Slice {
+				size += int64(v.Len()) * int64(elem.Size())
+			}
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), depth+1)
+		}
+		if v.Kind() == reflect.Array {
+			size -= int64(v.Type().Size())
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOfValue(iter.Key(), depth+1) + sizeOfValue(iter.Value(), depth+1)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			size += sizeOfValue(v.Elem(), depth+1)
+		}
+	case reflect.Struct:
+		size = 0
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOfValue(v.Field(i), depth+1)
+		}
+	}
+	return size
+}
+
+// hasPointers reports whether the values of t may refer to memory outside of them.
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
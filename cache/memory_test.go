@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMemoryCache(t *testing.T, config string) *MemoryCache {
+	c, err := NewCache("memory", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := c.(*MemoryCache)
+	t.Cleanup(func() { _ = mc.Close() })
+	return mc
+}
+
+func TestMemoryCacheLRU(t *testing.T) {
+	mc := newTestMemoryCache(t, `{"shards": 1, "max_entries": 3}`)
+
+	var evicted []string
+	mc.OnEvict(func(key string, value interface{}, reason EvictionReason) {
+		evicted = append(evicted, key+":"+reason.String())
+	})
+
+	for _, key := range []string{"a", "b", "c"} {
+		_ = mc.Put(key, key, time.Minute)
+	}
+	mc.Get("a")
+	_ = mc.Put("d", "d", time.Minute)
+	_ = mc.Put("e", "e", time.Minute)
+
+	if strings.Join(evicted, ",") != "b:evicted,c:evicted" {
+		t.Fatalf("unexpected evictions %v", evicted)
+	}
+	if !mc.Exists("a") || mc.Len() != 3 {
+		t.Fatalf("unexpected values, len %d", mc.Len())
+	}
+	if stats := mc.Stats(); stats.Evictions != 2 || stats.Hits != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMemoryCacheLFU(t *testing.T) {
+	mc := newTestMemoryCache(t, `{"shards": 1, "max_entries": 3, "policy": "lfu"}`)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_ = mc.Put(key, key, time.Minute)
+	}
+	mc.Get("a")
+	mc.Get("a")
+	mc.Get("b")
+	mc.Get("c")
+	mc.Get("c")
+
+	// b has the fewest hits.
+	_ = mc.Put("d", "d", time.Minute)
+	if mc.Exists("b") || !mc.Exists("a") || !mc.Exists("c") || !mc.Exists("d") {
+		t.Fatal("expected b evicted")
+	}
+
+	// d has no hits.
+	_ = mc.Put("e", "e", time.Minute)
+	if mc.Exists("d") || !mc.Exists("e") {
+		t.Fatal("expected d evicted")
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	mc := newTestMemoryCache(t, `{"shards": 1, "max_bytes": 100}`)
+
+	for i := 0; i < 10; i++ {
+		_ = mc.Put(fmt.Sprintf("k%d", i), strings.Repeat("x", 20), time.Minute)
+	}
+	if mc.Bytes() > 100 || mc.Len() == 0 || mc.Len() == 10 {
+		t.Fatalf("unexpected size %d bytes, %d values", mc.Bytes(), mc.Len())
+	}
+	if !mc.Exists("k9") {
+		t.Fatal("expected the last value cached")
+	}
+
+	if err := mc.Put("big", strings.Repeat("x", 200), time.Minute); err == nil || mc.Exists("big") {
+		t.Fatal("expected an error caching a value bigger than max_bytes")
+	}
+
+	// A rejected value keeps the old one.
+	if err := mc.Put("k9", strings.Repeat("x", 200), time.Minute); err == nil {
+		t.Fatal("expected an error replacing a value with a too big one")
+	}
+	if v := mc.Get("k9"); v != strings.Repeat("x", 20) {
+		t.Fatalf("old value removed by a rejected Put: %v", v)
+	}
+}
+
+func TestSizeOf(t *testing.T) {
+	type point struct{ X, Y int64 }
+	type named struct {
+		Name string
+		Tags []string
+	}
+
+	tests := []struct {
+		value interface{}
+		min   int64
+		max   int64
+	}{
+		{make([]byte, 1<<20), 1 << 20, 1<<20 + 64},
+		{strings.Repeat("x", 1000), 1000, 1064},
+		{make([]int64, 1000), 8000, 8064},
+		{make([]point, 10, 20), 320, 384},
+		{[4]int32{}, 16, 16},
+		{named{"name", []string{"a", "bc"}}, 7, 256},
+		{map[string]string{"key": "value"}, 8, 256},
+	}
+	for _, tt := range tests {
+		if size := sizeOf(tt.value); size < tt.min || size > tt.max {
+			t.Errorf("sizeOf(%T) = %d, expected between %d and %d", tt.value, size, tt.min, tt.max)
+		}
+	}
+
+	// Unbounded, the values aren't sized.
+	mc := newTestMemoryCache(t, `{}`)
+	_ = mc.Put("k", make([]byte, 1<<20), time.Minute)
+	if mc.Bytes() != 0 {
+		t.Fatalf("unexpected size %d bytes without max_bytes", mc.Bytes())
+	}
+}
+
+func BenchmarkMemoryCachePutBytes(b *testing.B) {
+	c, err := NewCache("memory", `{"max_bytes": 1073741824}`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mc := c.(*MemoryCache)
+	defer mc.Close()
+
+	value := make([]byte, 1<<20)
+	for i := 0; i < b.N; i++ {
+		_ = mc.Put("k", value, time.Minute)
+	}
+}
+
+func TestMemoryCacheJanitor(t *testing.T) {
+	mc := newTestMemoryCache(t, `{"every": "10ms"}`)
+
+	expired := make(chan string, 1)
+	mc.OnEvict(func(key string, value interface{}, reason EvictionReason) {
+		if reason == Expired {
+			expired <- key
+		}
+	})
+
+	_ = mc.Put("short", 1, time.Millisecond)
+	_ = mc.Put("forever", 1, 0)
+
+	select {
+	case key := <-expired:
+		if key != "short" {
+			t.Fatalf("unexpected expired key %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expired value not removed")
+	}
+
+	if mc.Len() != 1 || !mc.Exists("forever") {
+		t.Fatalf("unexpected values, len %d", mc.Len())
+	}
+	if stats := mc.Stats(); stats.Expirations != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMemoryCacheConfig(t *testing.T) {
+	for _, config := range []string{`{"policy": "fifo"}`, `{"every": "often"}`, `{"max_entries": -1}`, `{`} {
+		if _, err := NewCache("memory", config); err == nil {
+			t.Errorf("%s: expected an error", config)
+		}
+	}
+
+	mc := newTestMemoryCache(t, `{"shards": 5, "every": 30}`)
+	if len(mc.shards) != 8 || mc.config.Every != Duration(30*time.Second) {
+		t.Fatalf("unexpected config %+v", mc.config)
+	}
+}
+
+func TestMemoryCacheConcurrent(t *testing.T) {
+	mc := newTestMemoryCache(t, `{"max_entries": 100, "every": "1ms"}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("k%d", (i*j)%300)
+				_ = mc.Put(key, j, time.Millisecond*time.Duration(j%5))
+				mc.Get(key)
+				mc.Exists(key)
+				if j%100 == 0 {
+					_ = mc.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if mc.Len() > 100+len(mc.shards) {
+		t.Fatalf("too many values %d", mc.Len())
+	}
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// nsTagPrefix starts the tags of the namespace keys, they're invalidated by the namespace ClearAll.
+const nsTagPrefix = "\x00ns:"
+
+// NamespaceCache is a view of a Cache with the keys prefixed by the namespace name,
+// see NewNamespace.
+type NamespaceCache struct {
+	cache  Cache
+	prefix string
+	// tags are the namespace tags of the keys, of the namespace and its parents.
+	tags []string
+}
+
+// NewNamespace returns the namespace name of c: its keys are stored in c prefixed
+// with "name:" and tagged, so ClearAll deletes only them, the nested namespaces included.
+func NewNamespace(c Cache, name string) *NamespaceCache {
+	if ns, ok := c.(*NamespaceCache); ok {
+		return ns.Namespace(name).(*NamespaceCache)
+	}
+	return &NamespaceCache{cache: c, prefix: name + ":", tags: []string{nsTagPrefix + name + ":"}}
+}
+
+// Namespace returns the nested namespace name.
+func (ns *NamespaceCache) Namespace(name string) Cache {
+	prefix := ns.prefix + name + ":"
+	return &NamespaceCache{
+		cache:  ns.cache,
+		prefix: prefix,
+		tags:   append(append([]string(nil), ns.tags...), nsTagPrefix+prefix),
+	}
+}
+
+// Init returns an error, the namespaces use the initialized cache.
+func (ns *NamespaceCache) Init(config string) error {
+	return errors.New("cache: namespace can't be initialized")
+}
+
+func (ns *NamespaceCache) key(key string) string {
+	return ns.prefix + key
+}
+
+func (ns *NamespaceCache) keys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = ns.prefix + key
+	}
+	return prefixed
+}
+
+// tag adds the namespace keys to the namespace tag indexes.
+func (ns *NamespaceCache) tag(keys []string, timeout time.Duration) error {
+	return tagKeys(ns.cache, keys, timeout, ns.tags)
+}
+
+// Get cached value by key, nil when missing.
+func (ns *NamespaceCache) Get(key string) interface{} {
+	return ns.cache.Get(ns.key(key))
+}
+
+// Lookup returns the cached value by key and whether it was found.
+func (ns *NamespaceCache) Lookup(key string) (interface{}, bool) {
+	return ns.cache.Lookup(ns.key(key))
+}
+
+// GetMulti values of Get.
+func (ns *NamespaceCache) GetMulti(keys []string) []interface{} {
+	return ns.cache.GetMulti(ns.keys(keys))
+}
+
+// Put sets the cache value with key and timeout, NoExpiration never expires.
+func (ns *NamespaceCache) Put(key string, value interface{}, timeout time.Duration) error {
+	return ns.cache.PutWithTags(ns.key(key), value, timeout, ns.tags...)
+}
+
+// PutMulti sets the values of Put with the same timeout.
+func (ns *NamespaceCache) PutMulti(values map[string]interface{}, timeout time.Duration) error {
+	prefixed := make(map[string]interface{}, len(values))
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		prefixed[ns.key(key)] = value
+		keys = append(keys, ns.key(key))
+	}
+
+	if err := ns.cache.PutMulti(prefixed, timeout); err != nil {
+		return err
+	}
+	return ns.tag(keys, timeout)
+}
+
+// PutWithTags sets the value of key with the tags of the namespace, see PutWithTags.
+func (ns *NamespaceCache) PutWithTags(key string, value interface{}, timeout time.Duration, tags ...string) error {
+	return ns.cache.PutWithTags(ns.key(key), value, timeout, append(ns.keys(tags), ns.tags...)...)
+}
+
+// InvalidateTag deletes the keys tagged with tag in the namespace.
+func (ns *NamespaceCache) InvalidateTag(tag string) error {
+	return ns.cache.InvalidateTag(ns.key(tag))
+}
+
+// TagKeys adds the namespace keys to the index of each namespace tag, see TagIndexer.
+func (ns *NamespaceCache) TagKeys(keys []string, timeout time.Duration, tags ...string) error {
+	return tagKeys(ns.cache, ns.keys(keys), timeout, ns.keys(tags))
+}
+
+// TakeTag deletes the index of the namespace tag and returns its keys, see TagIndexer.
+func (ns *NamespaceCache) TakeTag(tag string) ([]string, error) {
+	keys, err := takeTag(ns.cache, ns.key(tag))
+	unprefixed := keys[:0]
+	for _, key := range keys {
+		if strings.HasPrefix(key, ns.prefix) {
+			unprefixed = append(unprefixed, key[len(ns.prefix):])
+		}
+	}
+	return unprefixed, err
+}
+
+// Add sets the cache value only if key is missing, it reports whether it was set.
+func (ns *NamespaceCache) Add(key string, value interface{}, timeout time.Duration) (bool, error) {
+	added, err := ns.cache.Add(ns.key(key), value, timeout)
+	if err != nil || !added {
+		return added, err
+	}
+	return true, ns.tag([]string{ns.key(key)}, timeout)
+}
+
+// Increment adds delta to the integer value of key and returns the new value.
+func (ns *NamespaceCache) Increment(key string, delta int64) (int64, error) {
+	n, err := ns.cache.Increment(ns.key(key), delta)
+	if err != nil {
+		return n, err
+	}
+	// The timeout is unknown, the indexes are kept.
+	return n, ns.tag([]string{ns.key(key)}, NoExpiration)
+}
+
+// Decrement subtracts delta from the integer value of key, see Increment.
+func (ns *NamespaceCache) Decrement(key string, delta int64) (int64, error) {
+	return ns.Increment(key, -delta)
+}
+
+// Touch sets a new timeout to key, it reports whether key was found.
+func (ns *NamespaceCache) Touch(key string, timeout time.Duration) (bool, error) {
+	ok, err := ns.cache.Touch(ns.key(key), timeout)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, ns.tag([]string{ns.key(key)}, timeout)
+}
+
+// TTL returns the remaining timeout of key (NoExpiration without timeout) and whether key was found.
+func (ns *NamespaceCache) TTL(key string) (time.Duration, bool) {
+	return ns.cache.TTL(ns.key(key))
+}
+
+// Delete cached value by key.
+func (ns *NamespaceCache) Delete(key string) error {
+	return ns.cache.Delete(ns.key(key))
+}
+
+// DeleteMulti values of Delete.
+func (ns *NamespaceCache) DeleteMulti(keys []string) error {
+	return ns.cache.DeleteMulti(ns.keys(keys))
+}
+
+// Exists check if cached value exists.
+func (ns *NamespaceCache) Exists(key string) bool {
+	return ns.cache.Exists(ns.key(key))
+}
+
+// ClearAll removes the values of the namespace and of its nested namespaces.
+func (ns *NamespaceCache) ClearAll() error {
+	return ns.cache.InvalidateTag(ns.tags[len(ns.tags)-1])
+}
@@ -0,0 +1,922 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// RedisCacheConfig is the JSON config of the RedisCache, f.e.
+	// {"addr": "127.0.0.1:6379", "password": "secret", "db": 1, "prefix": "app:", "pool_size": 20}
+	RedisCacheConfig struct {
+		// Network is tcp (default) or unix.
+		Network string `json:"network"`
+		// Addr of the server, 127.0.0.1:6379 by default.
+		Addr     string `json:"addr"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		DB       int    `json:"db"`
+		// Protocol is the RESP version, 2 (default) or 3.
+		Protocol int `json:"protocol"`
+		// Prefix is prepended to the keys, ClearAll deletes only the prefixed keys.
+		Prefix string `json:"prefix"`
+		// Codec encodes the values, gob (default), json or a name registered with RegisterCodec.
+		// The integers are stored as text, so Increment works on them, and read as int64.
+		Codec string `json:"codec"`
+		// PoolSize is the maximum number of connections, 10 by default.
+		PoolSize int `json:"pool_size"`
+		// IdleTimeout closes the connections idle for longer, 5 minutes by default.
+		IdleTimeout Duration `json:"idle_timeout"`
+		// DialTimeout limits the connection and the wait for a free connection, 5 seconds by default.
+		DialTimeout Duration `json:"dial_timeout"`
+		// ReadTimeout and WriteTimeout limit each command, 3 seconds by default.
+		ReadTimeout  Duration `json:"read_timeout"`
+		WriteTimeout Duration `json:"write_timeout"`
+	}
+
+	// RedisCache is the cache adapter of the Redis compatible servers, speaking RESP2 or RESP3.
+	RedisCache struct {
+		counters
+		loader adapterLoader
+
+		config RedisCacheConfig
+		codec  Codec
+		pool   *redisPool
+	}
+
+	redisPool struct {
+		mu     sync.Mutex
+		idle   []*redisConn
+		slots  chan struct{}
+		closed bool
+		dial   func() (*redisConn, error)
+		config *RedisCacheConfig
+	}
+
+	// redisSubscription receives the messages of a channel on its own connection.
+	redisSubscription struct {
+		channel string
+		fn      func(message []byte)
+		config  RedisCacheConfig
+
+		mu     sync.Mutex
+		conn   *redisConn
+		closed bool
+	}
+
+	redisConn struct {
+		conn     net.Conn
+		r        *bufio.Reader
+		w        *bufio.Writer
+		lastUsed time.Time
+		config   *RedisCacheConfig
+	}
+)
+
+// DefaultRedisCacheConfig is used for the missing RedisCache config values.
+var DefaultRedisCacheConfig = RedisCacheConfig{
+	Network:      "tcp",
+	Addr:         "127.0.0.1:6379",
+	Protocol:     2,
+	Codec:        "gob",
+	PoolSize:     10,
+	IdleTimeout:  Duration(5 * time.Minute),
+	DialTimeout:  Duration(5 * time.Second),
+	ReadTimeout:  Duration(3 * time.Second),
+	WriteTimeout: Duration(3 * time.Second),
+}
+
+// redisCodecTag starts the values encoded with the codec, telling them from the integers
+// stored as text, f.e. a JSON number or a string of digits.
+const redisCodecTag = 0
+
+// tagRetries is the maximum number of tries of a tag transaction, see TagKeys.
+const tagRetries = 16
+
+// errPoolClosed is returned after Close.
+var errPoolClosed = errors.New("cache: redis connection pool closed")
+
+// NewRedisCache instantiate a new RedisCache.
+func NewRedisCache() Cache {
+	return &RedisCache{}
+}
+
+// Init initialize the cache adapter with provided config string, see RedisCacheConfig.
+// The connections are opened on demand, Ping checks the server.
+func (rc *RedisCache) Init(config string) error {
+	c := DefaultRedisCacheConfig
+	if err := parseConfig(config, &c); err != nil {
+		return err
+	}
+	if c.Protocol != 2 && c.Protocol != 3 {
+		return fmt.Errorf("cache: unsupported redis protocol %d", c.Protocol)
+	}
+	if c.PoolSize <= 0 {
+		return fmt.Errorf("cache: invalid redis pool_size %d", c.PoolSize)
+	}
+
+	codec, err := codec(c.Codec)
+	if err != nil {
+		return err
+	}
+
+	_ = rc.Close()
+
+	rc.config, rc.codec = c, codec
+	rc.pool = &redisPool{
+		slots:  make(chan struct{}, c.PoolSize),
+		config: &rc.config,
+	}
+	rc.pool.dial = func() (*redisConn, error) {
+		return dialRedis(&rc.config)
+	}
+	return nil
+}
+
+// Close closes the connections.
+func (rc *RedisCache) Close() error {
+	if rc.pool == nil {
+		return nil
+	}
+	return rc.pool.close()
+}
+
+// Ping checks the connection to the server.
+func (rc *RedisCache) Ping() error {
+	_, err := rc.do("PING")
+	return err
+}
+
+// Publish sends message to the subscribers of channel.
+func (rc *RedisCache) Publish(channel string, message []byte) error {
+	_, err := rc.do("PUBLISH", channel, message)
+	return err
+}
+
+// Subscribe calls fn with the messages of channel until the returned Closer is closed.
+// The subscription uses its own connection, reconnected after errors: fn is then called
+// with nil, as the messages sent while disconnected are lost.
+func (rc *RedisCache) Subscribe(channel string, fn func(message []byte)) (io.Closer, error) {
+	if rc.pool == nil {
+		return nil, errors.New("cache: redis not initialized")
+	}
+
+	s := &redisSubscription{channel: channel, fn: fn, config: rc.config}
+	// The messages are read as RESP2 arrays.
+	s.config.Protocol = 2
+
+	conn, err := s.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+
+	go s.run(conn)
+	return s, nil
+}
+
+// Get cached value by key, nil when missing.
+func (rc *RedisCache) Get(key string) interface{} {
+	v, _ := rc.Lookup(key)
+	return v
+}
+
+// Lookup returns the cached value by key and whether it was found.
+// The connection and decoding errors are reported as misses.
+func (rc *RedisCache) Lookup(key string) (interface{}, bool) {
+	reply, err := rc.do("GET", rc.key(key))
+	if err != nil || reply == nil {
+		rc.record(false)
+		return nil, false
+	}
+
+	v, err := rc.decode(reply)
+	if err != nil {
+		rc.record(false)
+		return nil, false
+	}
+
+	rc.record(true)
+	return v, true
+}
+
+// GetMulti values of Get.
+func (rc *RedisCache) GetMulti(keys []string) []interface{} {
+	out := make([]interface{}, len(keys))
+	if len(keys) == 0 {
+		return out
+	}
+
+	args := []interface{}{"MGET"}
+	for _, key := range keys {
+		args = append(args, rc.key(key))
+	}
+
+	reply, err := rc.do(args...)
+	values, _ := reply.([]interface{})
+	for i := range out {
+		if err != nil || i >= len(values) || values[i] == nil {
+			rc.record(false)
+			continue
+		}
+
+		v, derr := rc.decode(values[i])
+		rc.record(derr == nil)
+		if derr == nil {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+// Put sets the cache value with key and timeout, NoExpiration never expires.
+func (rc *RedisCache) Put(key string, value interface{}, timeout time.Duration) error {
+	args, err := rc.setArgs(key, value, timeout)
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.do(args...)
+	return err
+}
+
+// PutMulti sets the values of Put with the same timeout, in a single round trip.
+func (rc *RedisCache) PutMulti(values map[string]interface{}, timeout time.Duration) error {
+	var cmds [][]interface{}
+	for key, value := range values {
+		args, err := rc.setArgs(key, value, timeout)
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, args)
+	}
+
+	replies, err := rc.pipeline(cmds)
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(RedisError); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add sets the cache value only if key is missing, it reports whether it was set.
+func (rc *RedisCache) Add(key string, value interface{}, timeout time.Duration) (bool, error) {
+	args, err := rc.setArgs(key, value, timeout)
+	if err != nil {
+		return false, err
+	}
+
+	reply, err := rc.do(append(args, "NX")...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// Increment adds delta to the integer value of key and returns the new value.
+// A missing key is set to delta without expiration.
+func (rc *RedisCache) Increment(key string, delta int64) (int64, error) {
+	reply, err := rc.do("INCRBY", rc.key(key), delta)
+	if err != nil {
+		if rerr, ok := err.(RedisError); ok && strings.Contains(string(rerr), "not an integer") {
+			return 0, ErrNotInteger
+		}
+		return 0, err
+	}
+
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, errProtocol
+	}
+	return n, nil
+}
+
+// Decrement subtracts delta from the integer value of key, see Increment.
+func (rc *RedisCache) Decrement(key string, delta int64) (int64, error) {
+	return rc.Increment(key, -delta)
+}
+
+// Touch sets a new timeout to key, it reports whether key was found.
+func (rc *RedisCache) Touch(key string, timeout time.Duration) (bool, error) {
+	if timeout <= NoExpiration {
+		replies, err := rc.pipeline([][]interface{}{{"PERSIST", rc.key(key)}, {"EXISTS", rc.key(key)}})
+		if err != nil {
+			return false, err
+		}
+		return replies[1] == int64(1), nil
+	}
+
+	reply, err := rc.do("PEXPIRE", rc.key(key), milliseconds(timeout))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+// TTL returns the remaining timeout of key (NoExpiration without timeout) and whether key was found.
+func (rc *RedisCache) TTL(key string) (time.Duration, bool) {
+	reply, err := rc.do("PTTL", rc.key(key))
+	ms, ok := reply.(int64)
+	if err != nil || !ok || ms == -2 {
+		return 0, false
+	}
+	if ms == -1 {
+		return NoExpiration, true
+	}
+	if ms == 0 {
+		// Expiring now, but still found.
+		return time.Nanosecond, true
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// Delete cached value by key.
+func (rc *RedisCache) Delete(key string) error {
+	_, err := rc.do("DEL", rc.key(key))
+	return err
+}
+
+// DeleteMulti values of Delete.
+func (rc *RedisCache) DeleteMulti(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := []interface{}{"DEL"}
+	for _, key := range keys {
+		args = append(args, rc.key(key))
+	}
+	_, err := rc.do(args...)
+	return err
+}
+
+// Exists check if cached value exists.
+func (rc *RedisCache) Exists(key string) bool {
+	reply, err := rc.do("EXISTS", rc.key(key))
+	return err == nil && reply == int64(1)
+}
+
+// ClearAll removes all cached values: the keys with the prefix or,
+// without prefix, the whole database (FLUSHDB).
+func (rc *RedisCache) ClearAll() error {
+	if rc.config.Prefix == "" {
+		_, err := rc.do("FLUSHDB")
+		return err
+	}
+
+	cursor := "0"
+	pattern := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(rc.config.Prefix) + "*"
+	for {
+		reply, err := rc.do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000)
+		if err != nil {
+			return err
+		}
+
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 2 {
+			return errProtocol
+		}
+		next, _ := values[0].([]byte)
+		keys, _ := values[1].([]interface{})
+
+		if len(keys) > 0 {
+			if _, err := rc.do(append([]interface{}{"DEL"}, keys...)...); err != nil {
+				return err
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// PutWithTags sets the cache value with key and timeout and adds key to the tag sets,
+// in a single transaction, see TagKeys.
+func (rc *RedisCache) PutWithTags(key string, value interface{}, timeout time.Duration, tags ...string) error {
+	args, err := rc.setArgs(key, value, timeout)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		_, err = rc.do(args...)
+		return err
+	}
+	return rc.tag([]string{key}, timeout, tags, args)
+}
+
+// InvalidateTag deletes the values tagged with tag.
+func (rc *RedisCache) InvalidateTag(tag string) error {
+	return InvalidateTag(rc, tag)
+}
+
+// TagKeys adds keys to the set of each tag, see TagIndexer. A set expires with its last key.
+func (rc *RedisCache) TagKeys(keys []string, timeout time.Duration, tags ...string) error {
+	if len(keys) == 0 || len(tags) == 0 {
+		return nil
+	}
+	return rc.tag(keys, timeout, tags, nil)
+}
+
+// TakeTag deletes the set of tag and returns its keys, see TagIndexer.
+func (rc *RedisCache) TakeTag(tag string) ([]string, error) {
+	index := rc.key(tagPrefix + tag)
+
+	replies, err := rc.pipeline([][]interface{}{{"MULTI"}, {"SMEMBERS", index}, {"DEL", index}, {"EXEC"}})
+	if err != nil {
+		return nil, err
+	}
+	exec, err := execReplies(replies)
+	if err != nil {
+		return nil, err
+	}
+	if exec == nil {
+		return nil, errProtocol
+	}
+
+	members, _ := exec[0].([]interface{})
+	keys := make([]string, 0, len(members))
+	for _, member := range members {
+		b, ok := member.([]byte)
+		if !ok {
+			return nil, errProtocol
+		}
+		keys = append(keys, string(b))
+	}
+	return keys, nil
+}
+
+// tag adds keys to the tag sets in a transaction, after set (the SET command of PutWithTags)
+// when not nil. The transaction is retried while a set changes between the read of its
+// timeout and the EXEC (WATCH), so the sets never expire before their keys.
+func (rc *RedisCache) tag(keys []string, timeout time.Duration, tags []string, set []interface{}) error {
+	if rc.pool == nil {
+		return errors.New("cache: redis not initialized")
+	}
+
+	conn, err := rc.pool.get()
+	if err != nil {
+		return err
+	}
+
+	indexes := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		indexes[i] = rc.key(tagPrefix + tag)
+	}
+	members := make([]interface{}, len(keys))
+	for i, key := range keys {
+		members[i] = key
+	}
+
+	done := false
+	for i := 0; i < tagRetries && err == nil && !done; i++ {
+		done, err = rc.tagTx(conn, indexes, members, timeout, set)
+	}
+	if err == nil && !done {
+		err = fmt.Errorf("cache: tags changed by %d concurrent transactions", tagRetries)
+	}
+
+	rc.pool.put(conn, err)
+	return err
+}
+
+// tagTx runs the transaction of tag, it reports false when aborted by a change of the sets.
+func (rc *RedisCache) tagTx(conn *redisConn, indexes, members []interface{}, timeout time.Duration, set []interface{}) (bool, error) {
+	cmds := [][]interface{}{append([]interface{}{"WATCH"}, indexes...)}
+	for _, index := range indexes {
+		cmds = append(cmds, []interface{}{"PTTL", index})
+	}
+	replies, err := conn.pipeline(cmds)
+	if err != nil {
+		return false, err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(RedisError); ok {
+			_, _ = conn.pipeline([][]interface{}{{"UNWATCH"}})
+			return false, err
+		}
+	}
+
+	tx := [][]interface{}{{"MULTI"}}
+	if set != nil {
+		tx = append(tx, set)
+	}
+	for i, index := range indexes {
+		ms, ok := replies[i+1].(int64)
+		if !ok {
+			return false, errProtocol
+		}
+
+		tx = append(tx, append([]interface{}{"SADD", index}, members...))
+		switch {
+		case timeout <= NoExpiration:
+			if ms >= 0 {
+				tx = append(tx, []interface{}{"PERSIST", index})
+			}
+		case ms == -2 || (ms >= 0 && ms < milliseconds(timeout)):
+			tx = append(tx, []interface{}{"PEXPIRE", index, milliseconds(timeout)})
+		}
+	}
+	tx = append(tx, []interface{}{"EXEC"})
+
+	if replies, err = conn.pipeline(tx); err != nil {
+		return false, err
+	}
+	exec, err := execReplies(replies)
+	return exec != nil, err
+}
+
+// execReplies returns the replies of the transaction ending the replies of a pipeline,
+// nil when aborted by WATCH.
+func execReplies(replies []interface{}) ([]interface{}, error) {
+	for _, reply := range replies[:len(replies)-1] {
+		if err, ok := reply.(RedisError); ok {
+			return nil, err
+		}
+	}
+
+	switch exec := replies[len(replies)-1].(type) {
+	case nil:
+		return nil, nil
+	case RedisError:
+		return nil, exec
+	case []interface{}:
+		for _, reply := range exec {
+			if err, ok := reply.(RedisError); ok {
+				return nil, err
+			}
+		}
+		return exec, nil
+	}
+	return nil, errProtocol
+}
+
+// Namespace returns a view with the keys prefixed by name, see NewNamespace.
+func (rc *RedisCache) Namespace(name string) Cache {
+	return NewNamespace(rc, name)
+}
+
+// Loader returns the Loader shared by the GetOrLoad calls, see LoaderOf.
+func (rc *RedisCache) Loader() *Loader {
+	return rc.loader.get(rc)
+}
+
+func (rc *RedisCache) key(key string) string {
+	return rc.config.Prefix + key
+}
+
+// setArgs returns the SET command of key.
+func (rc *RedisCache) setArgs(key string, value interface{}, timeout time.Duration) ([]interface{}, error) {
+	b, err := rc.encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{"SET", rc.key(key), b}
+	if timeout > NoExpiration {
+		args = append(args, "PX", milliseconds(timeout))
+	}
+	return args, nil
+}
+
+// encode stores the integers as text, so INCRBY works on them, and the other values
+// with the codec, after redisCodecTag.
+func (rc *RedisCache) encode(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		n, _ := toInt64(v)
+		return strconv.AppendInt(nil, n, 10), nil
+	}
+
+	b, err := rc.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{redisCodecTag}, b...), nil
+}
+
+// decode returns the values encoded with the codec and, as int64, the integers
+// stored as text by encode or INCRBY.
+func (rc *RedisCache) decode(reply interface{}) (interface{}, error) {
+	b, ok := reply.([]byte)
+	if !ok {
+		return nil, errProtocol
+	}
+
+	if len(b) > 0 && b[0] == redisCodecTag {
+		return rc.codec.Unmarshal(b[1:])
+	}
+	if isInteger(b) {
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return rc.codec.Unmarshal(b)
+}
+
+// do sends a command and returns its reply, the error replies are returned as RedisError.
+func (rc *RedisCache) do(args ...interface{}) (interface{}, error) {
+	replies, err := rc.pipeline([][]interface{}{args})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := replies[0].(RedisError); ok {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// pipeline sends the commands in a single round trip and returns their replies.
+func (rc *RedisCache) pipeline(cmds [][]interface{}) ([]interface{}, error) {
+	if rc.pool == nil {
+		return nil, errors.New("cache: redis not initialized")
+	}
+
+	conn, err := rc.pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.pipeline(cmds)
+	rc.pool.put(conn, err)
+	return replies, err
+}
+
+// get returns an idle connection or dials a new one, waiting DialTimeout
+// when PoolSize connections are in use.
+func (p *redisPool) get() (*redisConn, error) {
+	timer := time.NewTimer(time.Duration(p.config.DialTimeout))
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-timer.C:
+		return nil, errors.New("cache: redis connection pool timeout")
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, errPoolClosed
+	}
+
+	for len(p.idle) > 0 {
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.config.IdleTimeout > 0 && time.Since(conn.lastUsed) > time.Duration(p.config.IdleTimeout) {
+			_ = conn.conn.Close()
+			continue
+		}
+		p.mu.Unlock()
+		return conn, nil
+	}
+	p.mu.Unlock()
+
+	conn, err := p.dial()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return conn, nil
+}
+
+// put returns conn to the pool, it's closed after network and protocol errors.
+func (p *redisPool) put(conn *redisConn, err error) {
+	defer func() { <-p.slots }()
+
+	if _, ok := err.(RedisError); err != nil && !ok {
+		_ = conn.conn.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		_ = conn.conn.Close()
+		return
+	}
+	conn.lastUsed = time.Now()
+	p.idle = append(p.idle, conn)
+}
+
+func (p *redisPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, conn := range p.idle {
+		_ = conn.conn.Close()
+	}
+	p.idle = nil
+	return nil
+}
+
+// subscribe connects and subscribes to the channel.
+func (s *redisSubscription) subscribe() (*redisConn, error) {
+	conn, err := dialRedis(&s.config)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.pipeline([][]interface{}{{"SUBSCRIBE", s.channel}})
+	if err == nil {
+		if rerr, ok := replies[0].(RedisError); ok {
+			err = rerr
+		}
+	}
+	if err != nil {
+		_ = conn.conn.Close()
+		return nil, fmt.Errorf("cache: redis subscribe %s: %v", s.channel, err)
+	}
+
+	// The messages are waited without timeout.
+	_ = conn.conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// run reads the messages of conn, then reconnects until closed.
+func (s *redisSubscription) run(conn *redisConn) {
+	backoff := 100 * time.Millisecond
+
+	for {
+		for {
+			reply, err := readReply(conn.r)
+			if err != nil {
+				break
+			}
+			// ["message", channel, payload], the other replies are confirmations.
+			values, ok := reply.([]interface{})
+			if !ok || len(values) != 3 {
+				continue
+			}
+			if kind, _ := values[0].([]byte); string(kind) != "message" {
+				continue
+			}
+			message, _ := values[2].([]byte)
+			s.fn(message)
+		}
+		_ = conn.conn.Close()
+
+		for {
+			if s.isClosed() {
+				return
+			}
+
+			var err error
+			if conn, err = s.subscribe(); err == nil {
+				break
+			}
+
+			time.Sleep(backoff)
+			if backoff < 5*time.Second {
+				backoff *= 2
+			}
+		}
+		backoff = 100 * time.Millisecond
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.conn.Close()
+			return
+		}
+		s.conn = conn
+		s.mu.Unlock()
+
+		// The messages sent while disconnected are lost.
+		s.fn(nil)
+	}
+}
+
+func (s *redisSubscription) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Close stops the subscription.
+func (s *redisSubscription) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.conn.conn.Close()
+}
+
+// dialRedis connects and authenticates, selecting the protocol and the database.
+func dialRedis(config *RedisCacheConfig) (*redisConn, error) {
+	conn, err := net.DialTimeout(config.Network, config.Addr, time.Duration(config.DialTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), config: config}
+
+	var cmds [][]interface{}
+	switch {
+	case config.Protocol == 3:
+		hello := []interface{}{"HELLO", 3}
+		if config.Password != "" {
+			username := config.Username
+			if username == "" {
+				username = "default"
+			}
+			hello = append(hello, "AUTH", username, config.Password)
+		}
+		cmds = append(cmds, hello)
+	case config.Username != "":
+		cmds = append(cmds, []interface{}{"AUTH", config.Username, config.Password})
+	case config.Password != "":
+		cmds = append(cmds, []interface{}{"AUTH", config.Password})
+	}
+	if config.DB != 0 {
+		cmds = append(cmds, []interface{}{"SELECT", config.DB})
+	}
+
+	if len(cmds) > 0 {
+		replies, err := c.pipeline(cmds)
+		if err == nil {
+			for _, reply := range replies {
+				if rerr, ok := reply.(RedisError); ok {
+					err = rerr
+					break
+				}
+			}
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("cache: redis connection: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// pipeline writes the commands and reads their replies.
+func (c *redisConn) pipeline(cmds [][]interface{}) ([]interface{}, error) {
+	if c.config.WriteTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(time.Duration(c.config.WriteTimeout)))
+	}
+	for _, args := range cmds {
+		if err := writeCommand(c.w, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if c.config.ReadTimeout > 0 {
+		_ = c.conn.SetReadDeadline(time.Now().Add(time.Duration(c.config.ReadTimeout)))
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range replies {
+		reply, err := readReply(c.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// isInteger reports whether b is a decimal integer as written by INCRBY.
+func isInteger(b []byte) bool {
+	if len(b) > 0 && b[0] == '-' {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 19 || (b[0] == '0' && len(b) > 1) {
+		return false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func milliseconds(d time.Duration) int64 {
+	ms := int64(d / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return ms
+}
@@ -0,0 +1,599 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// respServer is an in-process server speaking the subset of the Redis protocol used by RedisCache.
+type respServer struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	dbs     map[string]map[string]respEntry
+	conns   int
+	stall   bool
+	open    map[net.Conn]bool
+	clients map[string][]*respClient
+}
+
+type respEntry struct {
+	value  []byte
+	set    map[string]bool
+	expire time.Time
+}
+
+type respClient struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	resp3 bool
+	db    string
+	auth  bool
+	// multi queues the commands of a transaction until EXEC.
+	multi  bool
+	queued [][]string
+}
+
+func newRESPServer(t *testing.T, password string) *respServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &respServer{
+		ln:       ln,
+		password: password,
+		dbs:      make(map[string]map[string]respEntry),
+		open:     make(map[net.Conn]bool),
+		clients:  make(map[string][]*respClient),
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *respServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+// drop closes the open connections.
+func (s *respServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.open {
+		_ = conn.Close()
+	}
+}
+
+func (s *respServer) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	c := &respClient{w: bufio.NewWriter(conn), db: "0", auth: s.password == ""}
+
+	s.mu.Lock()
+	s.conns++
+	s.open[conn] = true
+	s.mu.Unlock()
+
+	defer func() {
+		_ = conn.Close()
+
+		s.mu.Lock()
+		delete(s.open, conn)
+		for channel, clients := range s.clients {
+			for i, client := range clients {
+				if client == c {
+					s.clients[channel] = append(clients[:i:i], clients[i+1:]...)
+					break
+				}
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		values, _ := reply.([]interface{})
+		args := make([]string, len(values))
+		for i, v := range values {
+			args[i] = string(v.([]byte))
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		s.mu.Lock()
+		stall := s.stall
+		s.mu.Unlock()
+
+		if stall {
+			continue
+		}
+
+		c.mu.Lock()
+		s.exec(c, args)
+		err = c.w.Flush()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *respServer) exec(c *respClient, args []string) {
+	cmd := strings.ToUpper(args[0])
+
+	switch cmd {
+	case "HELLO":
+		if len(args) >= 5 && strings.ToUpper(args[2]) == "AUTH" {
+			if args[4] != s.password {
+				c.error("WRONGPASS invalid password")
+				return
+			}
+			c.auth = true
+		}
+		if !c.auth {
+			c.error("NOAUTH HELLO must be called with AUTH")
+			return
+		}
+		c.resp3 = args[1] == "3"
+		if c.resp3 {
+			fmt.Fprintf(c.w, "%%2\r\n+server\r\n+redis\r\n+proto\r\n:3\r\n")
+		} else {
+			fmt.Fprintf(c.w, "*4\r\n$6\r\nserver\r\n$5\r\nredis\r\n$5\r\nproto\r\n:2\r\n")
+		}
+		return
+	case "AUTH":
+		if args[len(args)-1] != s.password {
+			c.error("WRONGPASS invalid password")
+			return
+		}
+		c.auth = true
+		c.simple("OK")
+		return
+	}
+
+	if !c.auth {
+		c.error("NOAUTH Authentication required.")
+		return
+	}
+
+	switch cmd {
+	case "MULTI":
+		c.multi, c.queued = true, nil
+		c.simple("OK")
+		return
+	case "EXEC":
+		queued := c.queued
+		c.multi, c.queued = false, nil
+		fmt.Fprintf(c.w, "*%d\r\n", len(queued))
+		for _, args := range queued {
+			s.exec(c, args)
+		}
+		return
+	case "WATCH", "UNWATCH":
+		// The transactions are never aborted.
+		c.simple("OK")
+		return
+	}
+	if c.multi {
+		c.queued = append(c.queued, args)
+		c.simple("QUEUED")
+		return
+	}
+
+	switch cmd {
+	case "SUBSCRIBE":
+		s.mu.Lock()
+		s.clients[args[1]] = append(s.clients[args[1]], c)
+		s.mu.Unlock()
+		fmt.Fprintf(c.w, "*3\r\n$9\r\nsubscribe\r\n")
+		c.bulk([]byte(args[1]))
+		c.integer(1)
+		return
+	case "PUBLISH":
+		s.mu.Lock()
+		clients := append([]*respClient(nil), s.clients[args[1]]...)
+		s.mu.Unlock()
+		for _, client := range clients {
+			client.mu.Lock()
+			fmt.Fprintf(client.w, "*3\r\n$7\r\nmessage\r\n")
+			client.bulk([]byte(args[1]))
+			client.bulk([]byte(args[2]))
+			_ = client.w.Flush()
+			client.mu.Unlock()
+		}
+		c.integer(int64(len(clients)))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := s.dbs[c.db]
+	if db == nil {
+		db = make(map[string]respEntry)
+		s.dbs[c.db] = db
+	}
+
+	get := func(key string) (respEntry, bool) {
+		e, ok := db[key]
+		if ok && !e.expire.IsZero() && !e.expire.After(time.Now()) {
+			delete(db, key)
+			return e, false
+		}
+		return e, ok
+	}
+
+	switch cmd {
+	case "PING":
+		c.simple("PONG")
+	case "SELECT":
+		c.db = args[1]
+		c.simple("OK")
+	case "GET":
+		if e, ok := get(args[1]); ok {
+			c.bulk(e.value)
+		} else {
+			c.null()
+		}
+	case "MGET":
+		fmt.Fprintf(c.w, "*%d\r\n", len(args)-1)
+		for _, key := range args[1:] {
+			if e, ok := get(key); ok {
+				c.bulk(e.value)
+			} else {
+				c.null()
+			}
+		}
+	case "SET":
+		e := respEntry{value: []byte(args[2])}
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				e.expire = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				i++
+			case "NX":
+				nx = true
+			}
+		}
+		if _, ok := get(args[1]); ok && nx {
+			c.null()
+			return
+		}
+		db[args[1]] = e
+		c.simple("OK")
+	case "DEL", "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := get(key); ok {
+				n++
+				if cmd == "DEL" {
+					delete(db, key)
+				}
+			}
+		}
+		c.integer(int64(n))
+	case "SADD":
+		e, ok := get(args[1])
+		if !ok {
+			e = respEntry{set: make(map[string]bool)}
+		}
+		n := 0
+		for _, member := range args[2:] {
+			if !e.set[member] {
+				e.set[member] = true
+				n++
+			}
+		}
+		db[args[1]] = e
+		c.integer(int64(n))
+	case "SMEMBERS":
+		e, _ := get(args[1])
+		members := make([]string, 0, len(e.set))
+		for member := range e.set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		fmt.Fprintf(c.w, "*%d\r\n", len(members))
+		for _, member := range members {
+			c.bulk([]byte(member))
+		}
+	case "INCRBY":
+		e, _ := get(args[1])
+		current := int64(0)
+		if e.value != nil {
+			var err error
+			if current, err = strconv.ParseInt(string(e.value), 10, 64); err != nil {
+				c.error("ERR value is not an integer or out of range")
+				return
+			}
+		}
+		delta, _ := strconv.ParseInt(args[2], 10, 64)
+		e.value = []byte(strconv.FormatInt(current+delta, 10))
+		db[args[1]] = e
+		c.integer(current + delta)
+	case "PEXPIRE":
+		e, ok := get(args[1])
+		if !ok {
+			c.integer(0)
+			return
+		}
+		ms, _ := strconv.Atoi(args[2])
+		e.expire = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		db[args[1]] = e
+		c.integer(1)
+	case "PERSIST":
+		e, ok := get(args[1])
+		if !ok || e.expire.IsZero() {
+			c.integer(0)
+			return
+		}
+		e.expire = time.Time{}
+		db[args[1]] = e
+		c.integer(1)
+	case "PTTL":
+		e, ok := get(args[1])
+		switch {
+		case !ok:
+			c.integer(-2)
+		case e.expire.IsZero():
+			c.integer(-1)
+		default:
+			c.integer(int64(time.Until(e.expire) / time.Millisecond))
+		}
+	case "SCAN":
+		// A single page, sorted.
+		pattern := "*"
+		for i := 2; i < len(args); i++ {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		var keys []string
+		for key := range db {
+			if ok, _ := path.Match(pattern, key); ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(c.w, "*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+		for _, key := range keys {
+			c.bulk([]byte(key))
+		}
+	case "FLUSHDB":
+		s.dbs[c.db] = make(map[string]respEntry)
+		c.simple("OK")
+	default:
+		c.error("ERR unknown command '" + args[0] + "'")
+	}
+}
+
+func (c *respClient) simple(s string) { fmt.Fprintf(c.w, "+%s\r\n", s) }
+func (c *respClient) error(s string)  { fmt.Fprintf(c.w, "-%s\r\n", s) }
+func (c *respClient) integer(n int64) { fmt.Fprintf(c.w, ":%d\r\n", n) }
+func (c *respClient) bulk(b []byte)   { fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(b), b) }
+
+func (c *respClient) null() {
+	if c.resp3 {
+		fmt.Fprint(c.w, "_\r\n")
+	} else {
+		fmt.Fprint(c.w, "$-1\r\n")
+	}
+}
+
+func newTestRedisCache(t *testing.T, config string) *RedisCache {
+	c, err := NewCache("redis", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := c.(*RedisCache)
+	t.Cleanup(func() { _ = rc.Close() })
+	return rc
+}
+
+func TestRedisCacheConformance(t *testing.T) {
+	for _, protocol := range []int{2, 3} {
+		for _, codec := range []string{"gob", "json"} {
+			t.Run(fmt.Sprintf("RESP%d/%s", protocol, codec), func(t *testing.T) {
+				s := newRESPServer(t, "secret")
+
+				testCacheConformance(t, func(t *testing.T) Cache {
+					return newTestRedisCache(t, fmt.Sprintf(
+						`{"addr": %q, "password": "secret", "protocol": %d, "codec": %q, "prefix": "app:"}`,
+						s.addr(), protocol, codec))
+				})
+			})
+		}
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	s := newRESPServer(t, "secret")
+
+	rc := newTestRedisCache(t, fmt.Sprintf(`{"addr": %q, "password": "secret", "db": 2, "prefix": "app:", "pool_size": 2}`, s.addr()))
+
+	type user struct{ Name string }
+	if err := rc.Put("user", user{"ann"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v := rc.Get("user"); v != (user{"ann"}) {
+		t.Fatalf("unexpected value %#v", v)
+	}
+
+	// The keys are prefixed, in the selected database.
+	s.mu.Lock()
+	_, ok := s.dbs["2"]["app:user"]
+	s.mu.Unlock()
+	if !ok {
+		t.Fatal("prefixed key not found in db 2")
+	}
+
+	// ClearAll deletes only the prefixed keys.
+	other := newTestRedisCache(t, fmt.Sprintf(`{"addr": %q, "password": "secret", "db": 2, "prefix": "other:"}`, s.addr()))
+	_ = other.Put("key", "v", time.Minute)
+	if err := rc.ClearAll(); err != nil {
+		t.Fatal(err)
+	}
+	if rc.Exists("user") || !other.Exists("key") {
+		t.Fatal("ClearAll removed the wrong keys")
+	}
+
+	// The connections are reused.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, _ = rc.Increment("counter", 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n, _ := rc.Increment("counter", 0); n != 200 {
+		t.Fatalf("unexpected counter %d", n)
+	}
+	s.mu.Lock()
+	conns := s.conns
+	s.mu.Unlock()
+	if conns > 3 {
+		t.Fatalf("pool_size exceeded, %d connections", conns)
+	}
+
+	if stats := rc.Stats(); stats.Hits != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRedisCacheDigits(t *testing.T) {
+	s := newRESPServer(t, "")
+
+	for _, codec := range []string{"gob", "json"} {
+		rc := newTestRedisCache(t, fmt.Sprintf(`{"addr": %q, "codec": %q, "prefix": %q}`, s.addr(), codec, codec+":"))
+
+		// The strings of digits and the JSON numbers aren't read as integers.
+		_ = rc.Put("id", "00123", time.Minute)
+		_ = rc.Put("digits", "123", time.Minute)
+		_ = rc.Put("float", 5.0, time.Minute)
+		_ = rc.Put("int", 5, time.Minute)
+
+		if v := rc.Get("id"); v != "00123" {
+			t.Errorf("%s: unexpected value %#v", codec, v)
+		}
+		if v := rc.Get("digits"); v != "123" {
+			t.Errorf("%s: unexpected value %#v", codec, v)
+		}
+		if v := rc.Get("float"); v != 5.0 {
+			t.Errorf("%s: unexpected value %#v", codec, v)
+		}
+		if v := rc.Get("int"); v != int64(5) {
+			t.Errorf("%s: unexpected value %#v", codec, v)
+		}
+		if _, err := rc.Increment("digits", 1); err != ErrNotInteger {
+			t.Errorf("%s: expected ErrNotInteger, got %v", codec, err)
+		}
+	}
+}
+
+func TestRedisCacheErrors(t *testing.T) {
+	s := newRESPServer(t, "secret")
+
+	rc := newTestRedisCache(t, fmt.Sprintf(`{"addr": %q, "password": "wrong"}`, s.addr()))
+	if err := rc.Ping(); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("expected an authentication error, got %v", err)
+	}
+
+	rc = newTestRedisCache(t, fmt.Sprintf(`{"addr": %q, "password": "secret", "read_timeout": "50ms"}`, s.addr()))
+	if err := rc.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	s.stall = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	if err := rc.Put("key", "v", time.Minute); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("read_timeout not applied")
+	}
+
+	s.mu.Lock()
+	s.stall = false
+	s.mu.Unlock()
+
+	// The timed out connection is discarded.
+	if err := rc.Put("key", "v", time.Minute); err != nil || rc.Get("key") != "v" {
+		t.Fatalf("unexpected error after a timeout %v", err)
+	}
+
+	for _, config := range []string{`{"protocol": 4}`, `{"codec": "xml"}`, `{"pool_size": 0}`} {
+		if _, err := NewCache("redis", config); err == nil {
+			t.Errorf("%s: expected an error", config)
+		}
+	}
+
+	rc.Close()
+	if err := rc.Ping(); err != errPoolClosed {
+		t.Fatalf("expected errPoolClosed, got %v", err)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	for input, want := range map[string]string{
+		"+OK\r\n":                         "OK",
+		":-5\r\n":                         "-5",
+		"$3\r\nabc\r\n":                   "[97 98 99]",
+		"$-1\r\n":                         "<nil>",
+		"_\r\n":                           "<nil>",
+		",1.5\r\n":                        "1.5",
+		"#t\r\n":                          "true",
+		"=8\r\ntxt:text\r\n":              "[116 101 120 116]",
+		"%1\r\n+a\r\n:1\r\n":              "[a 1]",
+		"~2\r\n:1\r\n:2\r\n":              "[1 2]",
+		"|1\r\n+ttl\r\n:3\r\n+OK\r\n":     "OK",
+		">2\r\n+message\r\n+hi\r\n:1\r\n": "1",
+		"-ERR failed\r\n":                 "ERR failed",
+		"*2\r\n*1\r\n:1\r\n$-1\r\n":       "[[1] <nil>]",
+	} {
+		reply, err := readReply(bufio.NewReader(strings.NewReader(input)))
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if got := fmt.Sprint(reply); got != want {
+			t.Errorf("%q: got %s, want %s", input, got, want)
+		}
+	}
+
+	if _, err := readReply(bufio.NewReader(strings.NewReader("?\r\n"))); err != errProtocol {
+		t.Errorf("expected errProtocol, got %v", err)
+	}
+}
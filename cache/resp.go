@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// RedisError is an error reply of the server, f.e. "ERR value is not an integer".
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// errProtocol reports a malformed reply, the connection can't be reused.
+var errProtocol = errors.New("cache: redis protocol error")
+
+// writeCommand writes args as a RESP array of bulk strings.
+func writeCommand(w *bufio.Writer, args []interface{}) error {
+	_, _ = w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+
+	for _, arg := range args {
+		var b []byte
+		switch arg := arg.(type) {
+		case string:
+			b = []byte(arg)
+		case []byte:
+			b = arg
+		case int:
+			b = strconv.AppendInt(nil, int64(arg), 10)
+		case int64:
+			b = strconv.AppendInt(nil, arg, 10)
+		default:
+			return fmt.Errorf("cache: unsupported redis argument %T", arg)
+		}
+
+		_, _ = w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+		_, _ = w.Write(b)
+		_, _ = w.WriteString("\r\n")
+	}
+	return nil
+}
+
+// readReply reads a RESP2 or RESP3 reply: nil, string (simple strings), []byte (bulk
+// strings), int64, float64, bool, []interface{} (arrays, sets, maps as key-value pairs)
+// or RedisError. The attributes and the push messages are skipped.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errProtocol
+	}
+
+	body := string(line[1:])
+
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return RedisError(body), nil
+	case ':':
+		return parseReplyInt(body)
+	case '(':
+		// Big numbers are returned as strings.
+		return body, nil
+	case ',':
+		switch body {
+		case "inf":
+			body = "+Inf"
+		case "-inf":
+			body = "-Inf"
+		}
+		f, err := strconv.ParseFloat(body, 64)
+		if err != nil {
+			return nil, errProtocol
+		}
+		return f, nil
+	case '#':
+		return body == "t", nil
+	case '_':
+		return nil, nil
+	case '$', '!', '=':
+		n, err := parseReplyInt(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		b = b[:n]
+
+		switch line[0] {
+		case '!':
+			return RedisError(b), nil
+		case '=':
+			// Verbatim strings start with the format, f.e. "txt:".
+			if len(b) >= 4 {
+				b = b[4:]
+			}
+		}
+		return b, nil
+	case '*', '~', '%', '>', '|':
+		n, err := parseReplyInt(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if line[0] == '%' || line[0] == '|' {
+			n *= 2
+		}
+
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+
+		// Attributes precede the actual reply, push messages aren't replies.
+		if line[0] == '|' || line[0] == '>' {
+			return readReply(r)
+		}
+		return values, nil
+	}
+	return nil, errProtocol
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, errProtocol
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+func parseReplyInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errProtocol
+	}
+	return n, nil
+}
@@ -0,0 +1,51 @@
+package cache
+
+import "sync/atomic"
+
+type (
+	// Stats contains the number of Get hits and misses and the evicted values of an adapter.
+	Stats struct {
+		Hits   uint64
+		Misses uint64
+		// Evictions are the values removed to make room for new ones.
+		Evictions uint64
+		// Expirations are the expired values removed.
+		Expirations uint64
+	}
+
+	// counters records the adapter hits and misses, embed it to provide Stats.
+	counters struct {
+		hits        uint64
+		misses      uint64
+		evictions   uint64
+		expirations uint64
+	}
+)
+
+// record counts a Get result.
+func (c *counters) record(hit bool) {
+	if hit {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+// recordEviction counts a removed value, expired or evicted.
+func (c *counters) recordEviction(reason EvictionReason) {
+	if reason == Expired {
+		atomic.AddUint64(&c.expirations, 1)
+	} else {
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// Stats returns the number of hits, misses and removed values since the adapter creation.
+func (c *counters) Stats() Stats {
+	return Stats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		Evictions:   atomic.LoadUint64(&c.evictions),
+		Expirations: atomic.LoadUint64(&c.expirations),
+	}
+}
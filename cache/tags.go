@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// tagPrefix starts the keys of the tag indexes, the keys tagged by each tag.
+const tagPrefix = "\x00tag:"
+
+// pruneTagIndex is the size from which a tag index drops its missing keys,
+// then at each power of two.
+const pruneTagIndex = 256
+
+// TagIndexer is implemented by the adapters storing the tag indexes natively, f.e. as
+// Redis sets or marker files: the changes are atomic across the instances sharing the
+// store and don't rewrite the index. PutWithTags and InvalidateTag use it when implemented.
+type TagIndexer interface {
+	// TagKeys adds keys, cached with timeout, to the index of each tag.
+	TagKeys(keys []string, timeout time.Duration, tags ...string) error
+	// TakeTag deletes the index of tag and returns its keys, atomically.
+	TakeTag(tag string) ([]string, error)
+}
+
+// tagLocks serialize the changes of the tag indexes stored as values, by hash of the tag.
+var tagLocks [64]sync.Mutex
+
+// PutWithTags sets the value of key in c, like Put, and adds key to the index of each tag:
+// InvalidateTag deletes the tagged keys. Without TagIndexer, the tag indexes are cached
+// values of c, so it works with any adapter, but their changes are atomic only within
+// the process.
+func PutWithTags(c Cache, key string, value interface{}, timeout time.Duration, tags ...string) error {
+	if err := c.Put(key, value, timeout); err != nil {
+		return err
+	}
+	return tagKeys(c, []string{key}, timeout, tags)
+}
+
+// InvalidateTag deletes the keys tagged with tag in c, see PutWithTags.
+func InvalidateTag(c Cache, tag string) error {
+	keys, err := takeTag(c, tag)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	return c.DeleteMulti(keys)
+}
+
+// tagKeys adds keys, cached with timeout, to the tag indexes of c.
+func tagKeys(c Cache, keys []string, timeout time.Duration, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if ti, ok := c.(TagIndexer); ok {
+		return ti.TagKeys(keys, timeout, tags...)
+	}
+
+	unlock := lockTags(tags)
+	defer unlock()
+	return indexKeys(c, keys, timeout, tags)
+}
+
+// takeTag deletes the tag index of c and returns its keys.
+func takeTag(c Cache, tag string) ([]string, error) {
+	if ti, ok := c.(TagIndexer); ok {
+		return ti.TakeTag(tag)
+	}
+
+	unlock := lockTags([]string{tag})
+	defer unlock()
+
+	index := tagPrefix + tag
+	v, found := c.Lookup(index)
+	if !found {
+		return nil, nil
+	}
+	keys, err := tagIndex(v)
+	if err != nil {
+		return nil, fmt.Errorf("cache: tag %s: %v", tag, err)
+	}
+	return keys, c.Delete(index)
+}
+
+// lockTags locks the tags, in order, and returns their unlock.
+func lockTags(tags []string) func() {
+	var locks []int
+	for _, tag := range tags {
+		h := fnv.New32a()
+		h.Write([]byte(tag))
+		locks = append(locks, int(h.Sum32()%uint32(len(tagLocks))))
+	}
+	sort.Ints(locks)
+
+	var locked []int
+	for i, lock := range locks {
+		if i > 0 && lock == locks[i-1] {
+			continue
+		}
+		tagLocks[lock].Lock()
+		locked = append(locked, lock)
+	}
+
+	return func() {
+		for _, lock := range locked {
+			tagLocks[lock].Unlock()
+		}
+	}
+}
+
+// indexKeys adds keys, cached with timeout, to the tag indexes stored as values of c;
+// the caller locks the tags. An index expires with its last key.
+func indexKeys(c Cache, keys []string, timeout time.Duration, tags []string) error {
+	for _, tag := range tags {
+		index := tagPrefix + tag
+
+		tagged, err := tagIndex(c.Get(index))
+		if err != nil {
+			// Overwriting it would lose the tagged keys.
+			return fmt.Errorf("cache: tag %s: %v", tag, err)
+		}
+		ttl, found := c.TTL(index)
+		extend := found && ttl != NoExpiration && (timeout == NoExpiration || timeout > ttl)
+
+		set := make(map[string]bool, len(tagged))
+		for _, key := range tagged {
+			set[key] = true
+		}
+		added := false
+		for _, key := range keys {
+			if !set[key] {
+				set[key] = true
+				tagged = append(tagged, key)
+				added = true
+			}
+		}
+		if !added && !extend {
+			continue
+		}
+
+		if n := len(tagged); n >= pruneTagIndex && n&(n-1) == 0 {
+			tagged = pruneKeys(c, tagged)
+		}
+
+		if !found || extend {
+			ttl = timeout
+		}
+		if err := c.Put(index, tagged, ttl); err != nil {
+			return fmt.Errorf("cache: tag %s: %v", tag, err)
+		}
+	}
+	return nil
+}
+
+// tagIndex returns the keys of a tag index value, nil, a []string or
+// a []interface{} when decoded from JSON.
+func tagIndex(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		// Copied, the memory adapters return the cached slice.
+		return append([]string(nil), v...), nil
+	case []interface{}:
+		keys := make([]string, 0, len(v))
+		for _, key := range v {
+			s, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid index key %T", key)
+			}
+			keys = append(keys, s)
+		}
+		return keys, nil
+	}
+	return nil, fmt.Errorf("invalid index %T", v)
+}
+
+// pruneKeys returns the existing keys.
+func pruneKeys(c Cache, keys []string) []string {
+	existing := keys[:0]
+	for _, key := range keys {
+		if c.Exists(key) {
+			existing = append(existing, key)
+		}
+	}
+	return existing
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// untagged hides the TagIndexer of a cache, its tag indexes are values.
+type untagged struct{ Cache }
+
+func TestTagIndex(t *testing.T) {
+	c := untagged{newTestFileCache(t, "")}
+
+	_ = PutWithTags(c, "a", "v", 20*time.Millisecond, "tag")
+	if ttl, _ := c.TTL(tagPrefix + "tag"); ttl > 20*time.Millisecond {
+		t.Fatalf("unexpected index TTL %v", ttl)
+	}
+
+	// The index expires with its last key.
+	_ = PutWithTags(c, "b", "v", time.Minute, "tag")
+	if ttl, _ := c.TTL(tagPrefix + "tag"); ttl < 30*time.Second {
+		t.Fatalf("index TTL not extended %v", ttl)
+	}
+	_ = PutWithTags(c, "c", "v", NoExpiration, "tag")
+	if ttl, _ := c.TTL(tagPrefix + "tag"); ttl != NoExpiration {
+		t.Fatalf("index TTL not extended %v", ttl)
+	}
+
+	// The missing keys are pruned, the last one was found.
+	for i := 0; i < pruneTagIndex; i++ {
+		key := fmt.Sprintf("key%d", i)
+		_ = PutWithTags(c, key, "v", time.Minute, "pruned")
+		_ = c.Delete(key)
+	}
+	if keys, _ := tagIndex(c.Get(tagPrefix + "pruned")); len(keys) > 1 {
+		t.Fatalf("index not pruned, %d keys", len(keys))
+	}
+
+	// JSON decoded indexes.
+	if keys, err := tagIndex([]interface{}{"a", "b"}); err != nil || len(keys) != 2 || keys[1] != "b" {
+		t.Fatalf("unexpected keys %v %v", keys, err)
+	}
+
+	// An invalid index is reported, not overwritten.
+	_ = c.Put(tagPrefix+"invalid", 42, time.Minute)
+	if err := PutWithTags(c, "d", "v", time.Minute, "invalid"); err == nil || !strings.Contains(err.Error(), "tag invalid") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := InvalidateTag(c, "invalid"); err == nil {
+		t.Fatal("invalid index not reported")
+	}
+	if c.Get(tagPrefix+"invalid") != int64(42) && c.Get(tagPrefix+"invalid") != 42 {
+		t.Fatal("invalid index overwritten")
+	}
+}
+
+func TestMemoryCacheTags(t *testing.T) {
+	c := newTestMemoryCache(t, `{"shards": 1, "max_entries": 4, "every": -1}`)
+
+	// The index is neither evicted nor counted in max_entries.
+	for i := 0; i < 10; i++ {
+		if err := c.PutWithTags(fmt.Sprintf("key%d", i), "v", time.Minute, "tag"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Len() != 4 {
+		t.Fatalf("unexpected len %d", c.Len())
+	}
+	if err := c.InvalidateTag("tag"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 0 {
+		t.Fatalf("tagged values not invalidated, %d left", c.Len())
+	}
+
+	// The missing keys are pruned with the expired values.
+	_ = c.PutWithTags("a", "v", time.Millisecond, "expired")
+	_ = c.PutWithTags("b", "v", time.Minute, "kept")
+	time.Sleep(5 * time.Millisecond)
+	c.DeleteExpired()
+	c.tagMu.Lock()
+	_, expired := c.tags["expired"]
+	kept := c.tags["kept"]["b"]
+	c.tagMu.Unlock()
+	if expired || !kept {
+		t.Fatalf("unexpected indexes %v %v", expired, kept)
+	}
+}
+
+func TestFileCacheTags(t *testing.T) {
+	a := newTestFileCache(t, `{"levels": 2}`)
+	c, err := NewCache("file", fmt.Sprintf(`{"path": %q, "levels": 2, "every": -1}`, a.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := c.(*FileCache)
+	defer b.Close()
+
+	// The instances sharing the directory tag concurrently in the same index.
+	var wg sync.WaitGroup
+	for i, fc := range []*FileCache{a, b, a, b} {
+		wg.Add(1)
+		go func(i int, fc *FileCache) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := fc.PutWithTags(fmt.Sprintf("key%d-%d", i, j), "v", time.Minute, "tag", "other"); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i, fc)
+	}
+	wg.Wait()
+
+	// The index isn't a value.
+	if a.Exists(tagPrefix + "tag") {
+		t.Fatal("index stored as value")
+	}
+
+	keys, err := b.TakeTag("other")
+	if err != nil || len(keys) != 200 {
+		t.Fatalf("unexpected keys %d %v", len(keys), err)
+	}
+	if keys, _ := a.TakeTag("other"); len(keys) != 0 {
+		t.Fatalf("index not deleted, %d keys", len(keys))
+	}
+	if err := a.InvalidateTag("tag"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"key0-0", "key1-49", "key3-10"} {
+		if b.Exists(key) {
+			t.Fatalf("tagged value %s not invalidated", key)
+		}
+	}
+
+	// The markers of the missing keys are pruned with the expired values, then the empty indexes.
+	_ = a.PutWithTags("a", "v", time.Millisecond, "expired")
+	_ = a.PutWithTags("b", "v", time.Minute, "kept")
+	time.Sleep(5 * time.Millisecond)
+	a.DeleteExpired()
+	if fileExists(a.tagDirname("expired")) || !fileExists(a.tagDirname("kept")) {
+		t.Fatal("unexpected indexes")
+	}
+
+	// ClearAll removes the indexes.
+	if err := b.ClearAll(); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(filepath.Join(a.Path, fileTagDir)) || a.Exists("b") {
+		t.Fatal("indexes not cleared")
+	}
+}
+
+func TestRedisCacheTags(t *testing.T) {
+	s := newRESPServer(t, "")
+	rc := newTestRedisCache(t, fmt.Sprintf(`{"addr": %q, "prefix": "app:"}`, s.addr()))
+
+	ttl := func() int64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		e, ok := s.dbs["0"]["app:"+tagPrefix+"tag"]
+		switch {
+		case !ok:
+			return -2
+		case e.expire.IsZero():
+			return -1
+		}
+		return int64(time.Until(e.expire) / time.Second)
+	}
+
+	// The tags are sets, expiring with their last key.
+	_ = rc.PutWithTags("a", "v", 10*time.Second, "tag")
+	if n := ttl(); n < 0 || n > 10 {
+		t.Fatalf("unexpected set TTL %d", n)
+	}
+	_ = rc.PutWithTags("b", "v", time.Minute, "tag")
+	if n := ttl(); n < 30 {
+		t.Fatalf("set TTL not extended %d", n)
+	}
+	_ = rc.PutWithTags("c", "v", 10*time.Second, "tag")
+	if n := ttl(); n < 30 {
+		t.Fatalf("set TTL reduced %d", n)
+	}
+	_ = rc.PutWithTags("d", "v", NoExpiration, "tag")
+	if n := ttl(); n != -1 {
+		t.Fatalf("set not persisted %d", n)
+	}
+
+	keys, err := rc.TakeTag("tag")
+	if err != nil || strings.Join(keys, ",") != "a,b,c,d" {
+		t.Fatalf("unexpected keys %v %v", keys, err)
+	}
+	if n := ttl(); n != -2 {
+		t.Fatal("set not deleted")
+	}
+}
+
+func TestTieredCacheTags(t *testing.T) {
+	s := newRESPServer(t, "")
+	config := fmt.Sprintf(`{"l2": "redis", "l2_config": {"addr": %q, "prefix": "app:"}, "l1_ttl": "1m"}`, s.addr())
+
+	a := newTestTieredCache(t, config)
+	b := newTestTieredCache(t, config)
+
+	// Each instance tags its keys in the shared index.
+	_ = a.PutWithTags("a", "v", time.Minute, "tag")
+	_ = b.PutWithTags("b", "v", time.Minute, "tag")
+	if b.Get("a") != "v" || a.Get("b") != "v" {
+		t.Fatal("values not shared")
+	}
+
+	if err := a.InvalidateTag("tag"); err != nil {
+		t.Fatal(err)
+	}
+	if a.L2().Exists("a") || a.L2().Exists("b") {
+		t.Fatal("tagged values of an instance not invalidated")
+	}
+	if a.L1().Exists("a") || a.L1().Exists("b") {
+		t.Fatal("tagged values not invalidated in L1")
+	}
+	eventually(t, "tagged values not invalidated in the other L1", func() bool {
+		return !b.L1().Exists("a") && !b.L1().Exists("b")
+	})
+
+	// Through the namespaces too.
+	users := b.Namespace("users")
+	_ = users.Put("1", "ann", time.Minute)
+	_ = a.Namespace("users").Put("2", "tim", time.Minute)
+	if err := a.Namespace("users").ClearAll(); err != nil {
+		t.Fatal(err)
+	}
+	if a.L2().Exists("users:1") || a.L2().Exists("users:2") {
+		t.Fatal("namespace values not cleared")
+	}
+	eventually(t, "namespace values not cleared in the other L1", func() bool { return !users.Exists("1") })
+}
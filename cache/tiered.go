@@ -0,0 +1,557 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// WriteThrough writes the values to L2 before returning.
+	WriteThrough = "through"
+	// WriteBehind writes the values to L1 and queues their L2 write.
+	WriteBehind = "behind"
+)
+
+type (
+	// TieredCacheConfig is the JSON config of the TieredCache, f.e.
+	// {"l1": {"max_entries": 10000}, "l1_ttl": "10s", "l2": "redis", "l2_config": {"addr": "127.0.0.1:6379"}}
+	TieredCacheConfig struct {
+		// L1 is the MemoryCacheConfig of the in-process cache.
+		L1 json.RawMessage `json:"l1"`
+		// L1TTL is the maximum timeout of the L1 values, 10 seconds by default:
+		// it bounds how long an instance may serve a value changed by another one.
+		L1TTL Duration `json:"l1_ttl"`
+		// L2 is the name of the registered shared adapter, f.e. redis or file.
+		L2 string `json:"l2"`
+		// L2Config is the config of L2, a JSON object or string.
+		L2Config json.RawMessage `json:"l2_config"`
+		// ReadThrough fills L1 with the values read from L2, true by default.
+		ReadThrough bool `json:"read_through"`
+		// Write is WriteThrough (default) or WriteBehind.
+		Write string `json:"write"`
+		// QueueSize is the number of queued WriteBehind writes, 1000 by default: Put blocks when full.
+		QueueSize int `json:"queue_size"`
+		// Channel receives the invalidated keys when L2 is a Broadcaster (f.e. redis),
+		// "cache:invalidate" by default, empty disables the invalidation messages.
+		Channel string `json:"channel"`
+	}
+
+	// Broadcaster sends messages to the instances sharing an adapter,
+	// the TieredCache uses it when implemented by L2.
+	Broadcaster interface {
+		Publish(channel string, message []byte) error
+		// Subscribe calls fn with the messages of channel, or with nil when some may be lost.
+		Subscribe(channel string, fn func(message []byte)) (io.Closer, error)
+	}
+
+	// TieredCache is an in-process MemoryCache (L1) in front of a shared adapter (L2).
+	// The instances drop their L1 copy of the keys changed by the others
+	// through the invalidation messages of the L2 Broadcaster.
+	TieredCache struct {
+		counters
+		loader adapterLoader
+
+		config TieredCacheConfig
+		id     string
+		l1     *MemoryCache
+		l2     Cache
+		sub    io.Closer
+
+		errorMu sync.Mutex
+		onError func(key string, err error)
+
+		mu     sync.RWMutex
+		queue  chan tieredWrite
+		done   chan struct{}
+		closed bool
+	}
+
+	// tieredWrite is a queued WriteBehind write, or a flush barrier with flushed.
+	tieredWrite struct {
+		values  map[string]interface{}
+		timeout time.Duration
+		flushed chan struct{}
+	}
+
+	// invalidation is the message of the changed keys, All for ClearAll.
+	invalidation struct {
+		ID   string   `json:"id"`
+		Keys []string `json:"keys,omitempty"`
+		All  bool     `json:"all,omitempty"`
+	}
+)
+
+// DefaultTieredCacheConfig is used for the missing TieredCache config values.
+var DefaultTieredCacheConfig = TieredCacheConfig{
+	L1TTL:       Duration(10 * time.Second),
+	ReadThrough: true,
+	Write:       WriteThrough,
+	QueueSize:   1000,
+	Channel:     "cache:invalidate",
+}
+
+// NewTieredCache instantiate a new TieredCache.
+func NewTieredCache() Cache {
+	return &TieredCache{}
+}
+
+// Init initialize the cache adapter with provided config string, see TieredCacheConfig.
+// The L2 adapter must be registered.
+func (tc *TieredCache) Init(config string) error {
+	c := DefaultTieredCacheConfig
+	if err := parseConfig(config, &c); err != nil {
+		return err
+	}
+	if c.L2 == "" || c.L2 == "tiered" {
+		return fmt.Errorf("cache: invalid tiered l2 %q", c.L2)
+	}
+	if c.L1TTL <= 0 {
+		return fmt.Errorf("cache: invalid tiered l1_ttl %v", time.Duration(c.L1TTL))
+	}
+	if c.Write != WriteThrough && c.Write != WriteBehind {
+		return fmt.Errorf("cache: unknown tiered write mode %s", c.Write)
+	}
+	if c.Write == WriteBehind && c.QueueSize <= 0 {
+		return fmt.Errorf("cache: invalid tiered queue_size %d", c.QueueSize)
+	}
+
+	l1Config, err := rawConfig(c.L1)
+	if err != nil {
+		return err
+	}
+	l2Config, err := rawConfig(c.L2Config)
+	if err != nil {
+		return err
+	}
+
+	l1 := NewMemoryCache().(*MemoryCache)
+	if err := l1.Init(l1Config); err != nil {
+		return err
+	}
+	l2, err := NewCache(c.L2, l2Config)
+	if err != nil {
+		_ = l1.Close()
+		return err
+	}
+	if l2, ok := l2.(interface {
+		OnError(func(key string, err error))
+	}); ok {
+		l2.OnError(tc.error)
+	}
+
+	_ = tc.Close()
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	tc.config, tc.id, tc.l1, tc.l2 = c, hex.EncodeToString(id), l1, l2
+	tc.sub, tc.queue, tc.done, tc.closed = nil, nil, nil, false
+
+	if b, ok := l2.(Broadcaster); ok && c.Channel != "" {
+		if tc.sub, err = b.Subscribe(c.Channel, tc.invalidated); err != nil {
+			_ = tc.Close()
+			return err
+		}
+	}
+
+	if c.Write == WriteBehind {
+		tc.queue = make(chan tieredWrite, c.QueueSize)
+		tc.done = make(chan struct{})
+		go tc.writer(tc.queue, tc.done)
+	}
+	return nil
+}
+
+// rawConfig returns the config of a JSON object or string.
+func rawConfig(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", fmt.Errorf("cache: invalid config: %v", err)
+		}
+		return s, nil
+	}
+	return string(raw), nil
+}
+
+// OnError sets fn, called with the errors of the WriteBehind writes and of the invalidation messages.
+func (tc *TieredCache) OnError(fn func(key string, err error)) {
+	tc.errorMu.Lock()
+	tc.onError = fn
+	tc.errorMu.Unlock()
+}
+
+func (tc *TieredCache) error(key string, err error) {
+	tc.errorMu.Lock()
+	fn := tc.onError
+	tc.errorMu.Unlock()
+
+	if fn != nil {
+		fn(key, err)
+	}
+}
+
+// L1 returns the in-process cache.
+func (tc *TieredCache) L1() *MemoryCache {
+	return tc.l1
+}
+
+// L2 returns the shared cache.
+func (tc *TieredCache) L2() Cache {
+	return tc.l2
+}
+
+// Close writes the queued values, then closes L1 and L2 when it's an io.Closer.
+func (tc *TieredCache) Close() error {
+	tc.mu.Lock()
+	if tc.closed || tc.l2 == nil {
+		tc.mu.Unlock()
+		return nil
+	}
+	tc.closed = true
+	if tc.queue != nil {
+		close(tc.queue)
+	}
+	tc.mu.Unlock()
+
+	if tc.done != nil {
+		<-tc.done
+	}
+	if tc.sub != nil {
+		_ = tc.sub.Close()
+	}
+	_ = tc.l1.Close()
+	if c, ok := tc.l2.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Get cached value by key, nil when missing.
+func (tc *TieredCache) Get(key string) interface{} {
+	v, _ := tc.Lookup(key)
+	return v
+}
+
+// Lookup returns the cached value by key from L1 or else from L2, see Cache.
+func (tc *TieredCache) Lookup(key string) (interface{}, bool) {
+	if v, ok := tc.l1.Lookup(key); ok {
+		tc.record(true)
+		return v, true
+	}
+
+	v, ok := tc.l2.Lookup(key)
+	tc.record(ok)
+	if ok && tc.config.ReadThrough {
+		tc.fill(key, v)
+	}
+	return v, ok
+}
+
+// GetMulti values of Get.
+func (tc *TieredCache) GetMulti(keys []string) []interface{} {
+	values := make([]interface{}, len(keys))
+
+	var missing []string
+	var indexes []int
+	for i, key := range keys {
+		if v, ok := tc.l1.Lookup(key); ok {
+			tc.record(true)
+			values[i] = v
+			continue
+		}
+		missing = append(missing, key)
+		indexes = append(indexes, i)
+	}
+	if len(missing) == 0 {
+		return values
+	}
+
+	for j, v := range tc.l2.GetMulti(missing) {
+		tc.record(v != nil)
+		values[indexes[j]] = v
+		if v != nil && tc.config.ReadThrough {
+			tc.fill(missing[j], v)
+		}
+	}
+	return values
+}
+
+// fill caches in L1 a value read from L2, until its L2 timeout at most.
+func (tc *TieredCache) fill(key string, v interface{}) {
+	ttl, ok := tc.l2.TTL(key)
+	if !ok {
+		return
+	}
+	_ = tc.l1.Put(key, v, tc.l1Timeout(ttl))
+}
+
+// l1Timeout returns the L1 timeout of an L2 timeout.
+func (tc *TieredCache) l1Timeout(timeout time.Duration) time.Duration {
+	if l1TTL := time.Duration(tc.config.L1TTL); timeout <= NoExpiration || timeout > l1TTL {
+		return l1TTL
+	}
+	return timeout
+}
+
+// Put sets the cache value with key and timeout, in L2 now or later with WriteBehind.
+func (tc *TieredCache) Put(key string, value interface{}, timeout time.Duration) error {
+	return tc.PutMulti(map[string]interface{}{key: value}, timeout)
+}
+
+// PutMulti sets the values of Put with the same timeout.
+func (tc *TieredCache) PutMulti(values map[string]interface{}, timeout time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	tc.mu.RLock()
+	if tc.queue != nil && !tc.closed {
+		// Copied, the caller may reuse values once queued.
+		queued := make(map[string]interface{}, len(values))
+		for key, value := range values {
+			queued[key] = value
+			_ = tc.l1.Put(key, value, tc.l1Timeout(timeout))
+		}
+		tc.queue <- tieredWrite{values: queued, timeout: timeout}
+		tc.mu.RUnlock()
+		return nil
+	}
+	tc.mu.RUnlock()
+
+	return tc.write(values, timeout)
+}
+
+// write sets the values in L2, then in L1, and invalidates the other L1.
+func (tc *TieredCache) write(values map[string]interface{}, timeout time.Duration) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	var err error
+	if len(values) == 1 {
+		err = tc.l2.Put(keys[0], values[keys[0]], timeout)
+	} else {
+		err = tc.l2.PutMulti(values, timeout)
+	}
+	if err != nil {
+		// L2 state is unknown.
+		_ = tc.l1.DeleteMulti(keys)
+		return err
+	}
+
+	for key, value := range values {
+		_ = tc.l1.Put(key, value, tc.l1Timeout(timeout))
+	}
+	tc.publish(invalidation{Keys: keys})
+	return nil
+}
+
+// writer writes the queued values until the queue is closed.
+func (tc *TieredCache) writer(queue chan tieredWrite, done chan struct{}) {
+	defer close(done)
+
+	for w := range queue {
+		if w.flushed != nil {
+			close(w.flushed)
+			continue
+		}
+		if err := tc.write(w.values, w.timeout); err != nil {
+			for key := range w.values {
+				tc.error(key, err)
+			}
+		}
+	}
+}
+
+// flush waits for the queued writes, so they don't override the next changes.
+func (tc *TieredCache) flush() {
+	tc.mu.RLock()
+	if tc.queue == nil || tc.closed {
+		tc.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	tc.queue <- tieredWrite{flushed: flushed}
+	tc.mu.RUnlock()
+
+	<-flushed
+}
+
+// Add sets the cache value only if key is missing from L2, it reports whether it was set.
+func (tc *TieredCache) Add(key string, value interface{}, timeout time.Duration) (bool, error) {
+	tc.flush()
+
+	added, err := tc.l2.Add(key, value, timeout)
+	if err != nil || !added {
+		return added, err
+	}
+
+	_ = tc.l1.Put(key, value, tc.l1Timeout(timeout))
+	tc.publish(invalidation{Keys: []string{key}})
+	return true, nil
+}
+
+// Increment adds delta to the integer value of key in L2 and returns the new value.
+func (tc *TieredCache) Increment(key string, delta int64) (int64, error) {
+	tc.flush()
+
+	n, err := tc.l2.Increment(key, delta)
+	tc.invalidate(key)
+	return n, err
+}
+
+// Decrement subtracts delta from the integer value of key, see Increment.
+func (tc *TieredCache) Decrement(key string, delta int64) (int64, error) {
+	tc.flush()
+
+	n, err := tc.l2.Decrement(key, delta)
+	tc.invalidate(key)
+	return n, err
+}
+
+// Touch sets a new timeout to key, it reports whether key was found in L2.
+func (tc *TieredCache) Touch(key string, timeout time.Duration) (bool, error) {
+	tc.flush()
+
+	ok, err := tc.l2.Touch(key, timeout)
+	if err != nil || !ok {
+		_ = tc.l1.Delete(key)
+		return ok, err
+	}
+
+	_, _ = tc.l1.Touch(key, tc.l1Timeout(timeout))
+	tc.publish(invalidation{Keys: []string{key}})
+	return true, nil
+}
+
+// TTL returns the remaining L2 timeout of key (NoExpiration without timeout) and whether key was found.
+func (tc *TieredCache) TTL(key string) (time.Duration, bool) {
+	tc.flush()
+	return tc.l2.TTL(key)
+}
+
+// Delete cached value by key.
+func (tc *TieredCache) Delete(key string) error {
+	return tc.DeleteMulti([]string{key})
+}
+
+// DeleteMulti values of Delete.
+func (tc *TieredCache) DeleteMulti(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	tc.flush()
+
+	// L2 first, a concurrent Lookup could fill L1 again.
+	var err error
+	if len(keys) == 1 {
+		err = tc.l2.Delete(keys[0])
+	} else {
+		err = tc.l2.DeleteMulti(keys)
+	}
+	_ = tc.l1.DeleteMulti(keys)
+	tc.publish(invalidation{Keys: keys})
+	return err
+}
+
+// Exists check if cached value exists in L1 or L2.
+func (tc *TieredCache) Exists(key string) bool {
+	return tc.l1.Exists(key) || tc.l2.Exists(key)
+}
+
+// ClearAll removes all cached values from L2 and from the L1 of all the instances.
+func (tc *TieredCache) ClearAll() error {
+	tc.flush()
+
+	err := tc.l2.ClearAll()
+	_ = tc.l1.ClearAll()
+	tc.publish(invalidation{All: true})
+	return err
+}
+
+// PutWithTags sets the cache value with key and timeout and tags it, see PutWithTags.
+func (tc *TieredCache) PutWithTags(key string, value interface{}, timeout time.Duration, tags ...string) error {
+	return PutWithTags(tc, key, value, timeout, tags...)
+}
+
+// InvalidateTag deletes the values tagged with tag.
+func (tc *TieredCache) InvalidateTag(tag string) error {
+	return InvalidateTag(tc, tag)
+}
+
+// TagKeys adds keys to the index of each tag in L2, natively when L2 is a TagIndexer.
+// The indexes aren't cached in L1, they're shared by the instances.
+func (tc *TieredCache) TagKeys(keys []string, timeout time.Duration, tags ...string) error {
+	return tagKeys(tc.l2, keys, timeout, tags)
+}
+
+// TakeTag deletes the L2 index of tag and returns its keys, see TagIndexer.
+func (tc *TieredCache) TakeTag(tag string) ([]string, error) {
+	return takeTag(tc.l2, tag)
+}
+
+// Namespace returns a view with the keys prefixed by name, see NewNamespace.
+func (tc *TieredCache) Namespace(name string) Cache {
+	return NewNamespace(tc, name)
+}
+
+// Loader returns the Loader shared by the GetOrLoad calls, see LoaderOf.
+func (tc *TieredCache) Loader() *Loader {
+	return tc.loader.get(tc)
+}
+
+// invalidate removes key from L1 of all the instances.
+func (tc *TieredCache) invalidate(key string) {
+	_ = tc.l1.Delete(key)
+	tc.publish(invalidation{Keys: []string{key}})
+}
+
+// publish sends the invalidation to the other instances.
+func (tc *TieredCache) publish(msg invalidation) {
+	if tc.sub == nil {
+		return
+	}
+
+	msg.ID = tc.id
+	b, err := json.Marshal(msg)
+	if err == nil {
+		err = tc.l2.(Broadcaster).Publish(tc.config.Channel, b)
+	}
+	if err != nil {
+		tc.error(tc.config.Channel, fmt.Errorf("cache: invalidation: %v", err))
+	}
+}
+
+// invalidated applies the invalidation messages of the other instances.
+func (tc *TieredCache) invalidated(message []byte) {
+	if message == nil {
+		// Some messages may be lost.
+		_ = tc.l1.ClearAll()
+		return
+	}
+
+	var msg invalidation
+	if err := json.Unmarshal(message, &msg); err != nil {
+		tc.error(tc.config.Channel, fmt.Errorf("cache: invalidation: %v", err))
+		return
+	}
+	if msg.ID == tc.id {
+		return
+	}
+
+	if msg.All {
+		_ = tc.l1.ClearAll()
+	} else {
+		_ = tc.l1.DeleteMulti(msg.Keys)
+	}
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestTieredCache(t *testing.T, config string) *TieredCache {
+	c, err := NewCache("tiered", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := c.(*TieredCache)
+	t.Cleanup(func() { _ = tc.Close() })
+	return tc
+}
+
+// eventually fails t if cond isn't true within a second.
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTieredCacheConformance(t *testing.T) {
+	for _, write := range []string{WriteThrough, WriteBehind} {
+		t.Run("memory/"+write, func(t *testing.T) {
+			testCacheConformance(t, func(t *testing.T) Cache {
+				return newTestTieredCache(t, fmt.Sprintf(`{"l2": "memory", "write": %q}`, write))
+			})
+		})
+
+		t.Run("redis/"+write, func(t *testing.T) {
+			s := newRESPServer(t, "")
+
+			testCacheConformance(t, func(t *testing.T) Cache {
+				return newTestTieredCache(t, fmt.Sprintf(
+					`{"l2": "redis", "l2_config": {"addr": %q, "prefix": %q}, "write": %q}`,
+					s.addr(), t.Name()+":", write))
+			})
+		})
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	tc := newTestTieredCache(t, `{"l1": {"max_entries": 100}, "l1_ttl": "50ms", "l2": "memory"}`)
+
+	if err := tc.Put("key", "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if tc.L1().Get("key") != "v1" || tc.L2().Get("key") != "v1" {
+		t.Fatal("Put not written through")
+	}
+
+	// L1 serves its copy until l1_ttl.
+	_ = tc.L2().Put("key", "v2", time.Minute)
+	if v := tc.Get("key"); v != "v1" {
+		t.Fatalf("unexpected L1 value %v", v)
+	}
+	if ttl, _ := tc.L1().TTL("key"); ttl > 50*time.Millisecond {
+		t.Fatalf("L1 timeout not bounded by l1_ttl: %v", ttl)
+	}
+	eventually(t, "L1 value not expired", func() bool { return tc.Get("key") == "v2" })
+
+	// Read-through fills L1, until the L2 timeout at most.
+	_ = tc.L2().Put("short", "v", 20*time.Millisecond)
+	if tc.Get("short") != "v" || !tc.L1().Exists("short") {
+		t.Fatal("L1 not filled by a read")
+	}
+	if ttl, _ := tc.L1().TTL("short"); ttl > 20*time.Millisecond {
+		t.Fatalf("L1 timeout longer than L2 timeout: %v", ttl)
+	}
+
+	// A hit in L1 or L2 counts once.
+	hits := tc.Stats().Hits
+	_ = tc.Get("key")
+	_ = tc.Get("missing")
+	if stats := tc.Stats(); stats.Hits != hits+1 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	noRead := newTestTieredCache(t, `{"l2": "memory", "read_through": false}`)
+	_ = noRead.L2().Put("key", "v", time.Minute)
+	if noRead.Get("key") != "v" || noRead.L1().Exists("key") {
+		t.Fatal("L1 filled without read_through")
+	}
+
+	for _, config := range []string{`{}`, `{"l2": "tiered"}`, `{"l2": "memory", "write": "around"}`,
+		`{"l2": "memory", "l1_ttl": 0}`, `{"l2": "memory", "l1": {"policy": "fifo"}}`, `{"l2": "xml"}`} {
+		if _, err := NewCache("tiered", config); err == nil {
+			t.Errorf("%s: expected an error", config)
+		}
+	}
+}
+
+func TestTieredCacheWriteBehind(t *testing.T) {
+	tc := newTestTieredCache(t, `{"l2": "memory", "write": "behind", "queue_size": 1}`)
+
+	for i := 0; i < 100; i++ {
+		if err := tc.Put("key", i, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tc.Get("key") != 99 {
+		t.Fatal("L1 not written")
+	}
+
+	// The queued writes precede the next changes.
+	if n, err := tc.Increment("key", 1); err != nil || n != 100 {
+		t.Fatalf("unexpected increment %d %v", n, err)
+	}
+
+	// The queued values are copied.
+	values := map[string]interface{}{"a": "1", "b": "2"}
+	_ = tc.PutMulti(values, time.Minute)
+	values["a"] = "changed"
+	delete(values, "b")
+
+	_ = tc.Put("last", "v", time.Minute)
+	l2 := tc.L2()
+	_ = tc.Close()
+	if l2.Get("last") != "v" {
+		t.Fatal("queued write lost on Close")
+	}
+	if l2.Get("a") != "1" || l2.Get("b") != "2" {
+		t.Fatalf("queued values changed %v %v", l2.Get("a"), l2.Get("b"))
+	}
+}
+
+func TestTieredCacheInvalidation(t *testing.T) {
+	s := newRESPServer(t, "")
+	config := fmt.Sprintf(`{"l2": "redis", "l2_config": {"addr": %q, "prefix": "app:"}, "l1_ttl": "1m"}`, s.addr())
+
+	a := newTestTieredCache(t, config)
+	b := newTestTieredCache(t, config)
+
+	_ = a.Put("key", "v1", time.Minute)
+	if b.Get("key") != "v1" || !b.L1().Exists("key") {
+		t.Fatal("value not read from L2")
+	}
+
+	_ = a.Put("key", "v2", time.Minute)
+	eventually(t, "Put not invalidated", func() bool { return !b.L1().Exists("key") })
+	if b.Get("key") != "v2" || a.L1().Get("key") != "v2" {
+		t.Fatal("unexpected values after Put")
+	}
+
+	_ = a.Delete("key")
+	eventually(t, "Delete not invalidated", func() bool { return !b.L1().Exists("key") })
+
+	_ = a.Put("x", 1, time.Minute)
+	_ = b.Get("x")
+	_, _ = a.Increment("x", 1)
+	eventually(t, "Increment not invalidated", func() bool { return !b.L1().Exists("x") })
+
+	_ = b.Get("x")
+	_ = a.ClearAll()
+	eventually(t, "ClearAll not invalidated", func() bool { return b.L1().Len() == 0 })
+
+	// The L1 values are dropped after a reconnection, the messages may have been lost.
+	_ = a.Put("key", "v", time.Minute)
+	_ = b.Get("key")
+	s.drop()
+	eventually(t, "L1 not cleared after a reconnection", func() bool { return b.L1().Len() == 0 })
+
+	_ = a.Put("key", "v3", time.Minute)
+	_ = b.Get("key")
+	_ = a.Delete("key")
+	eventually(t, "not resubscribed", func() bool { return !b.L1().Exists("key") })
+}
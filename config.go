@@ -7,26 +7,46 @@ package framework
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Current framework config parameters:
+// Current framework config parameters (see Settings):
+// access_log     string
+// access_log_skip []string
+// address        string
 // author         string
 // cache          string
-// cache_config   string
+// cache_config   string or JSON
+// cache_stale    duration
+// cache_beta     float
+// cert           string
+// cert_key       string
+// config_watch   duration
 // compress_html  bool
 // compress_css   bool
 // compress_js    bool
+// cookie_keys    []string
+// cookie_path    string
+// cookie_domain  string
+// cookie_secure  bool
+// cookie_http_only bool
+// cookie_same_site string
 // database       string
 // database_conn  string
+// log_level      string
+// log_format     string
+// log_sinks      []JSON
 // mode           string
 // name           string
 // port           int
+// request_timeout duration
 // grpc_port      int
 // grpc_cert      string
 // grpc_cert_key  string
 // session        string
-// session_config JSON
+// session_config string or JSON
 // smtp_server    string
 // smtp_auth      string
 // smtp_username  string
@@ -34,32 +54,19 @@ import (
 // version        string
 // template_left  string
 // template_right string
+// trusted_proxies []string
+// client_ip_header string
 // pprof          string
+// health_path    string
+// ready_path     string
+// health_timeout duration
+// shutdown_delay duration
+// shutdown_timeout duration
+// metrics        string
+// trace_exporter string
+// trace_endpoint string
+// trace_sample_ratio float
 type (
-	// Config struct {
-	// 	Author        string `json:"author"`
-	// 	Cache         string `json:"cache"`
-	// 	CacheConfig   string `json:"cache"`
-	// 	CompressHTML  bool   `json:"compress_html"`
-	// 	CompressCSS   bool   `json:"compress_css"`
-	// 	CompressJS    bool   `json:"compress_js"`
-	// 	Database      string `json:"database"`
-	// 	DatabaseConn  string `json:"database_conn"`
-	// 	Mode          string `json:"mode"`
-	// 	Name          string `json:"name"`
-	// 	Port          int    `json:"port"`
-	// 	Session       string `json:"session"`
-	// 	SessionConfig JSON   `json:"session_config"`
-	// 	SMTPServer    string `json:"smtp_server"`
-	// 	SMTPAuth      string `json:"smtp_auth"`
-	// 	SMTPUsername  string `json:"smtp_username"`
-	// 	SMTPPassword  string `json:"smtp_password"`
-	// 	Version       string `json:"version"`
-	// 	TemplateLeft  string `json:"template_left"`
-	// 	TemplateRight string `json:"template_right"`
-	// 	Pprof         string `json:"pprof"`
-	// }
-
 	// Configuration is the interface for app configuration.
 	Configuration interface {
 		Set(key string, value interface{})
@@ -67,11 +74,27 @@ type (
 		String(key string) string
 		Int(key string) int
 		Bool(key string) bool
+		Float(key string) float64
+		Duration(key string) time.Duration
+		StringSlice(key string) []string
+		Bind(v interface{}) error
+		Validate() error
+		OnChange(key string, fn func(ConfigChange))
+		Reload() (*ConfigReload, error)
 	}
 
-	// ConfigData contains the configuration data
+	// ConfigData contains the configuration data.
+	// The data and sources maps are replaced, never modified, by Set and Reload.
 	ConfigData struct {
-		data JSON
+		mu      sync.RWMutex
+		data    JSON
+		sources map[string]ConfigSource
+		bound   map[string]bool
+		secrets map[string]bool
+
+		loader      *ConfigLoader
+		files       []string
+		subscribers []configSubscriber
 	}
 )
 
@@ -85,67 +108,179 @@ func DefaultConfig() *ConfigData {
 	data["name"] = "AnUnnamedApp"
 	data["author"] = "AnUnnamedProject"
 	data["port"] = float64(8080)
-	data["mode"] = "debug"
+	data["mode"] = Mode()
 	data["compress_html"] = true
 	data["compress_css"] = true
 	data["compress_js"] = true
 	data["template_left"] = "{{"
 	data["template_right"] = "}}"
+	data["cookie_path"] = "/"
+	data["cookie_http_only"] = true
+	data["cookie_same_site"] = "lax"
 
-	return &ConfigData{data: data}
+	sources := make(map[string]ConfigSource, len(data))
+	for key := range data {
+		sources[key] = ConfigSource{Layer: ConfigDefault}
+	}
+
+	return &ConfigData{data: data, sources: sources}
 }
 
-// LoadConfig loads the configuration file from specified path and returns the Config object.
+// LoadConfig loads the configuration file (JSON, YAML, TOML or .env, by extension)
+// from specified path and returns the Config object.
+// The per-mode file, the APP_ environment variables and the --config. flags override
+// the file values, see ConfigLoader.
 func LoadConfig(path string) Configuration {
-	config := DefaultConfig()
-
-	data, err := ioutil.ReadFile(path)
+	config, err := NewConfigLoader(path).Load()
 	if err != nil {
-		return config
-	}
-
-	if err := json.Unmarshal(data, &config.data); err != nil {
-		fmt.Println("unable to decode json", err)
+		fmt.Println(err)
 	}
 
 	return config
 }
 
 // Set updates a key with value.
+// The OnChange subscribers of the key are notified.
 func (c *ConfigData) Set(key string, value interface{}) {
+	c.mu.Lock()
+	old := c.data
+
+	data := make(JSON, len(old)+1)
+	for k, v := range old {
+		data[k] = v
+	}
+	sources := make(map[string]ConfigSource, len(c.sources)+1)
+	for k, v := range c.sources {
+		sources[k] = v
+	}
+	c.data, c.sources = data, sources
+	c.set(key, value, ConfigSource{Layer: ConfigSet})
+
+	subscribers := c.subscribers
+	c.mu.Unlock()
+
+	notifyConfigChanges(subscribers, old, data, []string{key})
+}
+
+// set updates the key without locking, while loading.
+func (c *ConfigData) set(key string, value interface{}, source ConfigSource) {
+	if c.sources == nil {
+		c.sources = make(map[string]ConfigSource)
+	}
 	c.data[key] = value
+	c.sources[key] = source
 }
 
 // Get return config's value by specified key.
+// Dotted keys read nested objects, f.e. "session_config.save_path".
 func (c *ConfigData) Get(key string) interface{} {
-	return c.data[key]
+	c.mu.RLock()
+	data := c.data
+	c.mu.RUnlock()
+
+	return getConfigValue(data, key)
+}
+
+func getConfigValue(data JSON, key string) interface{} {
+	if v, ok := data[key]; ok || !strings.Contains(key, ".") {
+		return v
+	}
+
+	var v interface{} = map[string]interface{}(data)
+	for _, part := range strings.Split(key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+// Source returns the layer of the key value, an empty ConfigSource if the key isn't set.
+func (c *ConfigData) Source(key string) ConfigSource {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.sources[key]
+}
+
+// Sources returns the layer of every key.
+func (c *ConfigData) Sources() map[string]ConfigSource {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sources := make(map[string]ConfigSource, len(c.sources))
+	for key, source := range c.sources {
+		sources[key] = source
+	}
+	return sources
 }
 
 // String returns the config's value by specified key, cast to string if possible.
+// Objects and arrays are returned JSON encoded, so session_config and cache_config
+// can be written as nested objects.
 // If data type don't match, return an empty string
 func (c *ConfigData) String(key string) string {
-	if v, ok := c.Get(key).(string); ok {
+	switch v := c.Get(key).(type) {
+	case string:
 		return v
+	case JSON, map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
 	}
 	return ""
 }
 
 // Int returns the config's value by specified key, cast to int if possible.
+// Numeric strings (f.e. set by an environment variable) are parsed.
 // If data type don't match, return 0
 func (c *ConfigData) Int(key string) int {
-	if v, ok := c.Get(key).(float64); ok {
-		return int(v)
-	}
+	f, _ := toFloat(c.Get(key))
+	return int(f)
+}
 
-	return 0
+// Float returns the config's value by specified key, cast to float64 if possible.
+// Numeric strings are parsed.
+// If data type don't match, return 0
+func (c *ConfigData) Float(key string) float64 {
+	f, _ := toFloat(c.Get(key))
+	return f
 }
 
 // Bool returns the config's value by specified key, cast to bool if possible.
+// Strings accepted by strconv.ParseBool (f.e. set by an environment variable) are parsed.
 // If data type don't match, return false
 func (c *ConfigData) Bool(key string) bool {
-	if v, ok := c.Get(key).(bool); ok {
-		return v
+	b, _ := toBool(c.Get(key))
+	return b
+}
+
+// Duration returns the config's value by specified key as a duration:
+// a duration string ("1m30s") or a number of seconds.
+// If data type don't match, return 0
+func (c *ConfigData) Duration(key string) time.Duration {
+	d, _ := toDuration(c.Get(key))
+	return d
+}
+
+// StringSlice returns the config's value by specified key as a []string:
+// a list of strings or a comma separated string.
+// Empty strings and values of other types are skipped.
+func (c *ConfigData) StringSlice(key string) []string {
+	var out []string
+
+	switch v := c.Get(key).(type) {
+	case string:
+		out = splitList(v)
+	case []string:
+		out = toStrings(v)
+	case []interface{}:
+		out = toStrings(v)
 	}
 
-	return false
+	return out
 }
@@ -0,0 +1,446 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Settings contains the framework configuration keys, Validate checks their types.
+	Settings struct {
+		AccessLog        string        `config:"access_log"`
+		AccessLogSkip    []string      `config:"access_log_skip"`
+		Address          string        `config:"address"`
+		Author           string        `config:"author"`
+		Cache            string        `config:"cache"`
+		CacheConfig      interface{}   `config:"cache_config"`
+		CacheStale       time.Duration `config:"cache_stale"`
+		CacheBeta        float64       `config:"cache_beta"`
+		Cert             string        `config:"cert"`
+		CertKey          string        `config:"cert_key"`
+		ClientIPHeader   string        `config:"client_ip_header"`
+		ConfigWatch      time.Duration `config:"config_watch"`
+		CompressHTML     bool          `config:"compress_html"`
+		CompressCSS      bool          `config:"compress_css"`
+		CompressJS       bool          `config:"compress_js"`
+		CookieKeys       []string      `config:"cookie_keys"`
+		CookiePath       string        `config:"cookie_path"`
+		CookieDomain     string        `config:"cookie_domain"`
+		CookieSecure     bool          `config:"cookie_secure"`
+		CookieHTTPOnly   bool          `config:"cookie_http_only"`
+		CookieSameSite   string        `config:"cookie_same_site"`
+		Database         string        `config:"database"`
+		DatabaseConn     string        `config:"database_conn"`
+		GRPCPort         int           `config:"grpc_port"`
+		GRPCCert         string        `config:"grpc_cert"`
+		GRPCCertKey      string        `config:"grpc_cert_key"`
+		HealthPath       string        `config:"health_path"`
+		HealthTimeout    time.Duration `config:"health_timeout"`
+		LogLevel         string        `config:"log_level"`
+		LogFormat        string        `config:"log_format"`
+		LogSinks         []interface{} `config:"log_sinks"`
+		Metrics          string        `config:"metrics"`
+		Mode             string        `config:"mode"`
+		Name             string        `config:"name"`
+		Port             int           `config:"port"`
+		Pprof            string        `config:"pprof"`
+		ReadyPath        string        `config:"ready_path"`
+		RequestTimeout   time.Duration `config:"request_timeout"`
+		Session          string        `config:"session"`
+		SessionConfig    interface{}   `config:"session_config"`
+		ShutdownDelay    time.Duration `config:"shutdown_delay"`
+		ShutdownTimeout  time.Duration `config:"shutdown_timeout"`
+		SMTPServer       string        `config:"smtp_server"`
+		SMTPAuth         string        `config:"smtp_auth"`
+		SMTPUsername     string        `config:"smtp_username"`
+		SMTPPassword     string        `config:"smtp_password"`
+		TemplateLeft     string        `config:"template_left"`
+		TemplateRight    string        `config:"template_right"`
+		TraceExporter    string        `config:"trace_exporter"`
+		TraceEndpoint    string        `config:"trace_endpoint"`
+		TraceSampleRatio float64       `config:"trace_sample_ratio"`
+		TrustedProxies   []string      `config:"trusted_proxies"`
+		Version          string        `config:"version"`
+	}
+
+	// ConfigErrors lists every invalid configuration key.
+	ConfigErrors []string
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (e ConfigErrors) Error() string {
+	return "config: " + strings.Join(e, "; ")
+}
+
+// Bind copies the configuration values into the struct pointed by v.
+// The key of each exported field is read from the config tag, f.e.
+//
+//	type DatabaseConfig struct {
+//		Host    string        `config:"db.host,required"`
+//		Port    int           `config:"db.port" default:"5432"`
+//		Timeout time.Duration `config:"db.timeout" default:"5s"`
+//		Tags    []string      `config:"db.tags"`
+//	}
+//
+// Fields without config tag use the json tag or the lowercase field name, "-" skips the field.
+// Nested structs read the nested object keys (f.e. key "db" and field tag "host").
+// Missing keys are set from the default tag, a missing required key is an error.
+// Strings are converted to numbers, booleans, durations and comma separated slices.
+//
+// Bind returns ConfigErrors with every missing or invalid key.
+// The bound keys are known to Validate.
+func (c *ConfigData) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Bind requires a pointer to a struct, got %T", v)
+	}
+
+	var errs ConfigErrors
+	c.bindStruct(rv.Elem(), "", &errs)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the framework keys types (see Settings) and reports the unknown keys:
+// every key set by a file or a flag must be a framework key or a key bound with Bind.
+// The unknown environment variables are only warnings (see UnknownEnv), the environment
+// may contain unrelated APP_ variables.
+// Init calls Validate and exits on errors, bind the application keys before Init.
+func (c *ConfigData) Validate() error {
+	var errs ConfigErrors
+	if err := c.Bind(&Settings{}); err != nil {
+		errs = append(errs, err.(ConfigErrors)...)
+	}
+
+	for _, key := range c.unknownKeys(false) {
+		errs = append(errs, fmt.Sprintf("unknown key %s (%s)", key, c.Source(key)))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// UnknownEnv returns the keys set by an environment variable which aren't
+// framework keys nor bound, Init logs them as warnings.
+func (c *ConfigData) UnknownEnv() []string {
+	return c.unknownKeys(true)
+}
+
+// unknownKeys returns the sorted unknown keys, set by an environment variable with env
+// or else by a file or a flag.
+func (c *ConfigData) unknownKeys(env bool) []string {
+	// Marks the framework keys as bound, their errors are reported by Validate.
+	_ = c.Bind(&Settings{})
+
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.sources))
+	for key, source := range c.sources {
+		if source.Layer == ConfigDefault || source.Layer == ConfigSet || c.bound[key] {
+			continue
+		}
+		if (source.Layer == ConfigEnv) == env {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// bindStruct sets the fields of v, prefix is the key of the nested struct.
+func (c *ConfigData) bindStruct(v reflect.Value, prefix string, errs *ConfigErrors) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		key, required := fieldKey(field)
+		if key == "-" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		c.markBound(key)
+
+		value := c.Get(key)
+		if value == nil {
+			if def, ok := field.Tag.Lookup("default"); ok {
+				value = def
+			} else if required {
+				*errs = append(*errs, fmt.Sprintf("missing required key %s", key))
+				continue
+			}
+		}
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if _, ok := value.(map[string]interface{}); value == nil || ok {
+				c.bindStruct(v.Field(i), key, errs)
+				continue
+			}
+		}
+
+		if value == nil {
+			continue
+		}
+
+		// The errors report the key and its source, never the value: it may be a decrypted secret.
+		converted, err := convertConfigValue(value, field.Type)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("invalid key %s%s: %v", key, c.sourceOf(key), err))
+			continue
+		}
+		v.Field(i).Set(converted)
+	}
+}
+
+// sourceOf returns " (source)" of the top-level key, empty when unknown.
+func (c *ConfigData) sourceOf(key string) string {
+	if i := strings.Index(key, "."); i >= 0 {
+		key = key[:i]
+	}
+
+	c.mu.RLock()
+	source, ok := c.sources[key]
+	c.mu.RUnlock()
+
+	if !ok {
+		return ""
+	}
+	return " (" + source.String() + ")"
+}
+
+// markBound records the top-level key for Validate.
+func (c *ConfigData) markBound(key string) {
+	if i := strings.Index(key, "."); i >= 0 {
+		key = key[:i]
+	}
+
+	c.mu.Lock()
+	if c.bound == nil {
+		c.bound = make(map[string]bool)
+	}
+	c.bound[key] = true
+	c.mu.Unlock()
+}
+
+// fieldKey returns the key of a struct field and whether it's required.
+func fieldKey(field reflect.StructField) (string, bool) {
+	tag, ok := field.Tag.Lookup("config")
+	if !ok {
+		tag = field.Tag.Get("json")
+	}
+
+	parts := strings.Split(tag, ",")
+	key, required := parts[0], false
+	for _, opt := range parts[1:] {
+		if opt == "required" {
+			required = true
+		}
+	}
+
+	if key == "" {
+		key = strings.ToLower(field.Name)
+	}
+	return key, required
+}
+
+// convertConfigValue converts a decoded config value to t.
+func convertConfigValue(value interface{}, t reflect.Type) (reflect.Value, error) {
+	rv := reflect.New(t).Elem()
+
+	if t == durationType {
+		d, err := toDuration(value)
+		if err != nil {
+			return rv, err
+		}
+		rv.SetInt(int64(d))
+		return rv, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if value != nil && !reflect.TypeOf(value).Implements(t) {
+			return rv, fmt.Errorf("expected %s, got %T", t, value)
+		}
+		rv.Set(reflect.ValueOf(value))
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return rv, fmt.Errorf("expected string, got %T", value)
+		}
+		rv.SetString(s)
+	case reflect.Bool:
+		b, err := toBool(value)
+		if err != nil {
+			return rv, err
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, err := toFloat(value)
+		if err != nil {
+			return rv, err
+		}
+		if f != float64(int64(f)) || rv.OverflowInt(int64(f)) {
+			return rv, fmt.Errorf("not a valid %s", t)
+		}
+		rv.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, err := toFloat(value)
+		if err != nil {
+			return rv, err
+		}
+		if f < 0 || f != float64(uint64(f)) || rv.OverflowUint(uint64(f)) {
+			return rv, fmt.Errorf("not a valid %s", t)
+		}
+		rv.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(value)
+		if err != nil {
+			return rv, err
+		}
+		rv.SetFloat(f)
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			s, isString := value.(string)
+			if !isString {
+				return rv, fmt.Errorf("expected list, got %T", value)
+			}
+			for _, item := range splitList(s) {
+				items = append(items, item)
+			}
+		}
+
+		rv = reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			elem, err := convertConfigValue(item, t.Elem())
+			if err != nil {
+				return rv, fmt.Errorf("item %d: %v", i, err)
+			}
+			rv.Index(i).Set(elem)
+		}
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok || t.Key().Kind() != reflect.String {
+			return rv, fmt.Errorf("expected object, got %T", value)
+		}
+
+		rv = reflect.MakeMapWithSize(t, len(m))
+		for k, item := range m {
+			elem, err := convertConfigValue(item, t.Elem())
+			if err != nil {
+				return rv, fmt.Errorf("%s: %v", k, err)
+			}
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), elem)
+		}
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return rv, fmt.Errorf("expected object, got %T", value)
+		}
+
+		var errs ConfigErrors
+		(&ConfigData{data: m}).bindStruct(rv, "", &errs)
+		if len(errs) > 0 {
+			return rv, fmt.Errorf("%s", strings.Join(errs, ", "))
+		}
+	default:
+		return rv, fmt.Errorf("unsupported type %s", t)
+	}
+
+	return rv, nil
+}
+
+// toFloat converts a number or a numeric string.
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("not a number")
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("expected number, got %T", value)
+}
+
+// toBool converts a boolean or a string accepted by strconv.ParseBool.
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("not a boolean")
+		}
+		return b, nil
+	}
+	return false, fmt.Errorf("expected boolean, got %T", value)
+}
+
+// toDuration converts a duration string ("1m30s") or a number of seconds,
+// the unit of the framework timeouts.
+func toDuration(value interface{}) (time.Duration, error) {
+	if s, ok := value.(string); ok {
+		if d, err := time.ParseDuration(strings.TrimSpace(s)); err == nil {
+			return d, nil
+		}
+	}
+	if d, ok := value.(time.Duration); ok {
+		return d, nil
+	}
+
+	f, err := toFloat(value)
+	if err != nil {
+		return 0, fmt.Errorf("not a duration")
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// splitList splits a comma separated list, f.e. set by an environment variable.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
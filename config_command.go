@@ -0,0 +1,118 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const configUsage = `usage: config <command>
+
+  genkey                        print a new master key
+  encrypt [value]               encrypt value (read from stdin without value)
+  decrypt [value]               decrypt an "enc:" value (read from stdin without value)
+  dump [json|yaml|toml|env]     print the configuration, secrets are redacted
+
+The master key is read from $FRAMEWORK_CONFIG_KEY, the file at $FRAMEWORK_CONFIG_KEY_FILE
+or config/master.key.`
+
+// Command runs the config subcommand with args, f.e. ["encrypt", "secret"].
+// Without value, encrypt and decrypt read it from in, so it doesn't end up in the shell history.
+func (l *ConfigLoader) Command(args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+
+	switch args[0] {
+	case "genkey":
+		key, err := GenerateConfigKey()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, key)
+		return err
+	case "encrypt", "decrypt":
+		key, err := l.MasterKey()
+		if err != nil {
+			return err
+		}
+
+		var value string
+		if len(args) > 1 {
+			value = args[1]
+		} else {
+			b, err := ioutil.ReadAll(in)
+			if err != nil {
+				return err
+			}
+			value = strings.TrimRight(string(b), "\r\n")
+		}
+
+		if args[0] == "encrypt" {
+			value, err = EncryptConfigValue(key, value)
+		} else {
+			value, err = DecryptConfigValue(key, value)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, value)
+		return err
+	case "dump":
+		config, err := l.Load()
+		if err != nil {
+			return err
+		}
+
+		format := "json"
+		if len(args) > 1 {
+			format = args[1]
+		}
+
+		var b []byte
+		data := config.Redacted()
+		switch format {
+		case "json":
+			b, err = json.MarshalIndent(data, "", "  ")
+			b = append(b, '\n')
+		case "yaml":
+			b, err = encodeYAML(data)
+		case "toml":
+			b, err = encodeTOML(data)
+		case "env":
+			b, err = encodeDotenv(data)
+		default:
+			return fmt.Errorf("config: unknown format %s", format)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(b)
+		return err
+	}
+
+	return errors.New(configUsage)
+}
+
+// runCommand runs the "config" subcommand of the application command line and exits,
+// f.e. "./app config encrypt".
+func runCommand() {
+	if len(os.Args) < 2 || os.Args[1] != "config" {
+		return
+	}
+
+	loader := NewConfigLoader(FindConfigFile(App.Path + "config"))
+	if err := loader.Command(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
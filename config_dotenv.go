@@ -0,0 +1,240 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// decodeDotenv decodes a .env file: KEY=value lines, optionally prefixed by "export".
+// Keys are lowercased and "__" separates the nested keys: SESSION_CONFIG__SAVE_PATH sets
+// session_config.save_path. Values are strings, double quoted values support the \n, \t,
+// \" and \\ escapes and can span multiple lines, single quoted values are literal.
+func decodeDotenv(b []byte) (JSON, error) {
+	data := JSON{}
+	s := strings.Replace(string(b), "\r\n", "\n", -1)
+	line := 1
+
+	for len(s) > 0 {
+		var text string
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			text, s = s[:i], s[i+1:]
+		} else {
+			text, s = s, ""
+		}
+		start := line
+		line++
+
+		text = strings.TrimSpace(text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "export ") {
+			text = strings.TrimSpace(text[len("export "):])
+		}
+
+		eq := strings.IndexByte(text, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("dotenv: line %d: expected KEY=value", start)
+		}
+
+		key := strings.TrimSpace(text[:eq])
+		if !isDotenvKey(key) {
+			return nil, fmt.Errorf("dotenv: line %d: invalid key %q", start, key)
+		}
+		raw := strings.TrimLeft(text[eq+1:], " \t")
+
+		var value string
+		if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+			// Quoted values can continue on the next lines.
+			quote := raw[0]
+			for {
+				end := dotenvQuoteEnd(raw, quote)
+				if end > 0 {
+					if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+						return nil, fmt.Errorf("dotenv: line %d: unexpected %q after value", start, rest)
+					}
+					value = raw[1:end]
+					break
+				}
+				if s == "" {
+					return nil, fmt.Errorf("dotenv: line %d: unterminated value", start)
+				}
+
+				var next string
+				if i := strings.IndexByte(s, '\n'); i >= 0 {
+					next, s = s[:i], s[i+1:]
+				} else {
+					next, s = s, ""
+				}
+				raw += "\n" + next
+				line++
+			}
+
+			if quote == '"' {
+				value = unescapeDotenv(value)
+			}
+		} else {
+			// Unquoted values end at the comment.
+			if i := strings.Index(raw, " #"); i >= 0 {
+				raw = raw[:i]
+			}
+			value = strings.TrimSpace(raw)
+		}
+
+		if err := setDotenvKey(data, strings.ToLower(key), value); err != nil {
+			return nil, fmt.Errorf("dotenv: line %d: %v", start, err)
+		}
+	}
+
+	return data, nil
+}
+
+func isDotenvKey(key string) bool {
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '.' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return key != ""
+}
+
+// dotenvQuoteEnd returns the index of the closing quote, -1 if the value continues.
+func dotenvQuoteEnd(raw string, quote byte) int {
+	for i := 1; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case '"', '\\', '$':
+			buf.WriteByte(s[i])
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String()
+}
+
+// setDotenvKey sets the "__" separated key.
+func setDotenvKey(data JSON, key string, value string) error {
+	path := strings.Split(key, "__")
+
+	t := map[string]interface{}(data)
+	for _, name := range path[:len(path)-1] {
+		next, ok := t[name].(map[string]interface{})
+		if !ok {
+			if t[name] != nil {
+				return fmt.Errorf("%s is not an object", name)
+			}
+			next = map[string]interface{}{}
+			t[name] = next
+		}
+		t = next
+	}
+
+	name := path[len(path)-1]
+	if _, ok := t[name].(map[string]interface{}); ok {
+		return fmt.Errorf("%s is an object", key)
+	}
+	t[name] = value
+	return nil
+}
+
+// encodeDotenv encodes the configuration as a .env file, keys are sorted and uppercased.
+// Nested objects are flattened with "__", the other non-string values are JSON encoded.
+func encodeDotenv(data JSON) ([]byte, error) {
+	lines := []string{}
+	if err := flattenDotenv(&lines, "", data); err != nil {
+		return nil, err
+	}
+	sort.Strings(lines)
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func flattenDotenv(lines *[]string, prefix string, m map[string]interface{}) error {
+	for key, value := range m {
+		name := strings.ToUpper(prefix + key)
+		if !isDotenvKey(name) || strings.Contains(key, "__") {
+			return fmt.Errorf("dotenv: invalid key %q", prefix+key)
+		}
+
+		var s string
+		switch v := value.(type) {
+		case JSON:
+			if err := flattenDotenv(lines, prefix+key+"__", v); err != nil {
+				return err
+			}
+			continue
+		case map[string]interface{}:
+			if err := flattenDotenv(lines, prefix+key+"__", v); err != nil {
+				return err
+			}
+			continue
+		case string:
+			s = v
+		case nil:
+			s = ""
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			s = string(b)
+		}
+
+		*lines = append(*lines, name+"="+quoteDotenv(s))
+	}
+	return nil
+}
+
+// quoteDotenv double quotes the values with spaces, quotes, comments or escapes.
+func quoteDotenv(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\r\"'#\\$") {
+		return s
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "$", `\$`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// expectedConfig is the content of the YAML and TOML test documents.
+var expectedConfig = JSON{
+	"name":          "app",
+	"port":          float64(8080),
+	"ratio":         0.25,
+	"compress_html": false,
+	"empty":         "",
+	"version":       "1.0",
+	"proxies":       []interface{}{"10.0.0.0/8", "192.168.0.1"},
+	"session_config": map[string]interface{}{
+		"save_path": "/tmp/sessions",
+		"lifetime":  float64(3600),
+	},
+	"log_sinks": []interface{}{
+		map[string]interface{}{"type": "stdout", "level": "info"},
+		map[string]interface{}{"type": "file", "path": "log/app.log", "compress": true},
+	},
+	"motd": "Hello\n  \"world\" # not a comment\n",
+}
+
+const yamlConfig = `---
+# Application
+name: app
+port: 8080 # HTTP
+ratio: 0.25
+compress_html: false
+empty: ""
+version: "1.0"
+proxies: [10.0.0.0/8, '192.168.0.1']
+session_config:
+  save_path: /tmp/sessions
+  lifetime: 0xe10
+log_sinks:
+- type: stdout
+  level: info
+- {type: file, path: log/app.log,
+   compress: true}
+motd: |
+  Hello
+    "world" # not a comment
+`
+
+const tomlConfig = `# Application
+name = "app"
+port = 8_080 # HTTP
+ratio = 2.5e-1
+compress_html = false
+empty = ''
+version = "1.0"
+proxies = [
+  "10.0.0.0/8",
+  '192.168.0.1', # gateway
+]
+motd = """
+Hello
+  "world" # not a comment
+"""
+
+[session_config]
+save_path = "/tmp/sessions"
+lifetime = 3600
+
+[[log_sinks]]
+type = "stdout"
+level = "info"
+
+[[log_sinks]]
+type = "file"
+path = "log/app.log"
+compress = true
+`
+
+func TestDecodeConfigFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func([]byte) (JSON, error)
+		doc    string
+	}{
+		{"yaml", decodeYAML, yamlConfig},
+		{"toml", decodeTOML, tomlConfig},
+	}
+
+	for _, tt := range tests {
+		data, err := tt.decode([]byte(tt.doc))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(data, expectedConfig) {
+			t.Errorf("%s: unexpected config\n%#v", tt.name, data)
+		}
+	}
+}
+
+func TestConfigFormatsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode func(JSON) ([]byte, error)
+		decode func([]byte) (JSON, error)
+		data   JSON
+	}{
+		{"json", nil, decodeJSONConfig, expectedConfig},
+		{"yaml", encodeYAML, decodeYAML, expectedConfig},
+		{"toml", encodeTOML, decodeTOML, expectedConfig},
+		{"dotenv", encodeDotenv, decodeDotenv, JSON{
+			"name":           "app",
+			"smtp_password":  `p@ss "w0rd" # $HOME \ end`,
+			"motd":           "Hello\n\tworld",
+			"empty":          "",
+			"session_config": map[string]interface{}{"save_path": "/tmp/sessions", "name": "sid"},
+		}},
+	}
+
+	for _, tt := range tests {
+		encode := tt.encode
+		if encode == nil {
+			encode = func(data JSON) ([]byte, error) { return json.Marshal(data) }
+		}
+
+		b, err := encode(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		data, err := tt.decode(b)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", tt.name, err, b)
+		}
+		if !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("%s: round trip mismatch\n%s\n%#v", tt.name, b, data)
+		}
+
+		// Encoding is stable.
+		again, err := encode(data)
+		if err != nil || string(again) != string(b) {
+			t.Errorf("%s: unstable encoding\n%s\n%s", tt.name, b, again)
+		}
+	}
+}
+
+func TestDecodeDotenv(t *testing.T) {
+	data, err := decodeDotenv([]byte(`# Application
+export NAME=app
+PORT = 8080 # HTTP
+SMTP_PASSWORD='pa$$ #1'
+MOTD="Hello
+world\t!"
+SESSION_CONFIG__SAVE_PATH=/tmp/sessions
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := JSON{
+		"name":           "app",
+		"port":           "8080",
+		"smtp_password":  "pa$$ #1",
+		"motd":           "Hello\nworld\t!",
+		"session_config": map[string]interface{}{"save_path": "/tmp/sessions"},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("unexpected config %#v", data)
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func([]byte) (JSON, error)
+		doc    string
+	}{
+		{"yaml indentation", decodeYAML, "a: 1\n  b: 2\n"},
+		{"yaml duplicate", decodeYAML, "a: 1\na: 2\n"},
+		{"yaml alias", decodeYAML, "a: &x 1\nb: *x\n"},
+		{"yaml tab", decodeYAML, "a:\n\tb: 1\n"},
+		{"yaml string", decodeYAML, "a: \"open\n"},
+		{"yaml scalar", decodeYAML, "just a string\n"},
+		{"toml duplicate", decodeTOML, "a = 1\na = 2\n"},
+		{"toml table", decodeTOML, "[a]\n[a]\n"},
+		{"toml value", decodeTOML, "a = yes\n"},
+		{"toml leading zero", decodeTOML, "a = 012\n"},
+		{"toml string", decodeTOML, "a = \"open\n"},
+		{"dotenv key", decodeDotenv, "1A=b\n"},
+		{"dotenv line", decodeDotenv, "just text\n"},
+		{"dotenv quote", decodeDotenv, "A=\"open\n"},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.decode([]byte(tt.doc)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if path := FindConfigFile(dir); path != filepath.Join(dir, "app.json") {
+		t.Fatalf("unexpected default path %s", path)
+	}
+
+	writeConfigFile(t, dir, "app.yaml", "name: app\nsession_config:\n  save_path: ${SESSIONS:-/tmp}\n")
+	writeConfigFile(t, dir, "app.staging.yaml", "port: 9000\n")
+	writeConfigFile(t, dir, ".env", "SMTP_PASSWORD=secret\nCOOKIE_SECURE=true\n")
+	writeConfigFile(t, dir, ".env.staging", "PORT=9090\n")
+
+	path := FindConfigFile(dir)
+	if path != filepath.Join(dir, "app.yaml") {
+		t.Fatalf("unexpected path %s", path)
+	}
+
+	config, err := (&ConfigLoader{Path: path, Mode: "staging"}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Int("port") != 9000 || config.String("session_config.save_path") != "/tmp" ||
+		config.String("session_config") != `{"save_path":"/tmp"}` {
+		t.Errorf("unexpected config %v", config.data)
+	}
+
+	config, err = (&ConfigLoader{Path: filepath.Join(dir, ".env"), Mode: "staging"}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// .env values take the type of the lower layers.
+	if config.Get("port") != float64(9090) || config.Get("cookie_secure") != "true" || config.Get("smtp_password") != "secret" {
+		t.Errorf("unexpected config %v", config.data)
+	}
+	if s := config.Source("port"); s.Layer != ConfigModeFile || !strings.HasSuffix(s.Origin, ".env.staging") {
+		t.Errorf("unexpected source %v", s)
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Configuration layers, from the lowest to the highest priority.
+const (
+	// ConfigDefault - value set by DefaultConfig.
+	ConfigDefault string = "default"
+	// ConfigFile - value read from the configuration file.
+	ConfigFile string = "file"
+	// ConfigModeFile - value read from the per-mode file (f.e. app.production.json).
+	ConfigModeFile string = "mode file"
+	// ConfigEnv - value read from an environment variable (f.e. APP_SMTP_PASSWORD).
+	ConfigEnv string = "env"
+	// ConfigFlag - value read from a command line flag (f.e. --config.port=80).
+	ConfigFlag string = "flag"
+	// ConfigSet - value updated at runtime with Set.
+	ConfigSet string = "set"
+)
+
+type (
+	// ConfigSource describes where a configuration value comes from.
+	ConfigSource struct {
+		// Layer is one of ConfigDefault, ConfigFile, ConfigModeFile, ConfigEnv, ConfigFlag or ConfigSet.
+		Layer string `json:"layer"`
+		// Origin is the file path, the environment variable or the flag.
+		Origin string `json:"origin,omitempty"`
+	}
+
+	// ConfigLoader loads the configuration layers:
+	// DefaultConfig, the configuration file, the per-mode file, the environment variables
+	// and the command line flags, each layer overrides the previous ones.
+	//
+	// ${NAME} and ${NAME:-default} inside the files string values are replaced
+	// with the environment variables. The "enc:" values of every layer are decrypted,
+	// see EncryptConfigValue.
+	ConfigLoader struct {
+		// Path of the JSON, YAML (.yaml or .yml), TOML or .env file, the per-mode file is read
+		// from the same directory (config/app.yaml, config/app.production.yaml).
+		Path string
+		// Mode selects the per-mode file. When empty it's the "mode" flag or environment
+		// variable, the "mode" key of the JSON file or the current framework Mode().
+		// The files of the modes it extends are loaded first, see RegisterMode.
+		Mode string
+		// EnvPrefix of the environment variables, APP_SMTP_PASSWORD sets smtp_password.
+		EnvPrefix string
+		// Environ is the environment in the form "key=value", see os.Environ.
+		Environ []string
+		// Args are the command line arguments without the program name.
+		// --config.key=value and --config.key value set key.
+		Args []string
+		// Key decrypts the "enc:" values, when nil it's read by MasterKey.
+		Key []byte
+	}
+)
+
+// String returns f.e. "env APP_SMTP_PASSWORD".
+func (s ConfigSource) String() string {
+	if s.Origin == "" {
+		return s.Layer
+	}
+	return s.Layer + " " + s.Origin
+}
+
+// NewConfigLoader returns a loader for the configuration file at path, with the APP_ environment
+// variables and the process command line flags.
+func NewConfigLoader(path string) *ConfigLoader {
+	var args []string
+	if len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+
+	return &ConfigLoader{
+		Path:      path,
+		EnvPrefix: "APP_",
+		Environ:   os.Environ(),
+		Args:      args,
+	}
+}
+
+// Load merges the layers over DefaultConfig.
+// A missing file is not an error, the returned config is always usable.
+func (l *ConfigLoader) Load() (*ConfigData, error) {
+	config := DefaultConfig()
+	env := l.env()
+
+	var errs []string
+	fail := func(err error) {
+		errs = append(errs, err.Error())
+	}
+
+	if err := config.loadFile(l.Path, ConfigFile, env); err != nil {
+		fail(err)
+	}
+
+	flags := l.flags()
+
+	config.loader = l
+	config.files = []string{l.Path}
+
+	if mode := l.mode(config, env, flags); mode != "" && l.Path != "" {
+		// The parent modes files first, f.e. app.production.json before app.staging.json.
+		for _, mode := range modeChain(mode) {
+			path := modeConfigPath(l.Path, mode)
+			config.files = append(config.files, path)
+
+			if err := config.loadFile(path, ConfigModeFile, env); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	if l.EnvPrefix != "" {
+		for _, kv := range l.Environ {
+			i := strings.Index(kv, "=")
+			if i <= len(l.EnvPrefix) || !strings.HasPrefix(kv, l.EnvPrefix) {
+				continue
+			}
+
+			key := strings.ToLower(kv[len(l.EnvPrefix):i])
+			config.set(key, config.parseValue(key, kv[i+1:]), ConfigSource{Layer: ConfigEnv, Origin: kv[:i]})
+		}
+	}
+
+	for _, f := range flags {
+		config.set(f.key, config.parseValue(f.key, f.value), ConfigSource{Layer: ConfigFlag, Origin: "--config." + f.key})
+	}
+
+	if err := config.decrypt(l); err != nil {
+		fail(err)
+	}
+
+	if len(errs) > 0 {
+		return config, fmt.Errorf("config: %s", strings.Join(errs, "; "))
+	}
+	return config, nil
+}
+
+// configFlag is a --config.key=value command line flag.
+type configFlag struct {
+	key   string
+	value string
+}
+
+// flags parses the --config.key=value and --config.key value arguments,
+// a flag without value is true. The other arguments are ignored.
+func (l *ConfigLoader) flags() []configFlag {
+	var flags []configFlag
+
+	for i := 0; i < len(l.Args); i++ {
+		arg := l.Args[i]
+		if arg == "--" {
+			break
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if !strings.HasPrefix(name, "config.") {
+			continue
+		}
+		name = name[len("config."):]
+
+		value := "true"
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value = name[:j], name[j+1:]
+		} else if i+1 < len(l.Args) && !strings.HasPrefix(l.Args[i+1], "-") {
+			i++
+			value = l.Args[i]
+		}
+
+		if name != "" {
+			flags = append(flags, configFlag{key: name, value: value})
+		}
+	}
+
+	return flags
+}
+
+// env returns the environment as a map.
+func (l *ConfigLoader) env() map[string]string {
+	env := make(map[string]string, len(l.Environ))
+	for _, kv := range l.Environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+// mode returns the mode selecting the per-mode file.
+func (l *ConfigLoader) mode(config *ConfigData, env map[string]string, flags []configFlag) string {
+	if l.Mode != "" {
+		return l.Mode
+	}
+
+	for i := len(flags) - 1; i >= 0; i-- {
+		if flags[i].key == "mode" {
+			return flags[i].value
+		}
+	}
+
+	if l.EnvPrefix != "" {
+		if mode := env[l.EnvPrefix+"MODE"]; mode != "" {
+			return mode
+		}
+	}
+
+	if config.Source("mode").Layer == ConfigFile {
+		return config.String("mode")
+	}
+
+	return Mode()
+}
+
+// configDecoders decodes the configuration files by extension, see configFormat.
+var configDecoders = map[string]func([]byte) (JSON, error){
+	".json": decodeJSONConfig,
+	".yaml": decodeYAML,
+	".yml":  decodeYAML,
+	".toml": decodeTOML,
+	".env":  decodeDotenv,
+}
+
+// configFiles are the configuration files looked up by FindConfigFile, in order.
+var configFiles = []string{"app.json", "app.yaml", "app.yml", "app.toml", ".env"}
+
+func decodeJSONConfig(b []byte) (JSON, error) {
+	data := JSON{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// configFormat returns the extension selecting the decoder,
+// ".env" for the .env and .env.<mode> files.
+func configFormat(path string) string {
+	base := filepath.Base(path)
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return ".env"
+	}
+	return strings.ToLower(filepath.Ext(path))
+}
+
+// modeConfigPath returns the per-mode file of path:
+// config/app.production.yaml for config/app.yaml, config/.env.production for config/.env.
+func modeConfigPath(path, mode string) string {
+	if filepath.Base(path) == ".env" {
+		return path + "." + mode
+	}
+
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + mode + ext
+}
+
+// FindConfigFile returns the first configuration file found in dir:
+// app.json, app.yaml, app.yml, app.toml or .env. It returns the app.json path if none exists.
+func FindConfigFile(dir string) string {
+	for _, name := range configFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, configFiles[0])
+}
+
+// loadFile merges the configuration file at path, the format is selected by the extension.
+// A missing file is ignored.
+func (c *ConfigData) loadFile(path string, layer string, env map[string]string) error {
+	if path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	format := configFormat(path)
+	decode, ok := configDecoders[format]
+	if !ok {
+		return fmt.Errorf("unsupported config file %s", path)
+	}
+
+	data, err := decode(b)
+	if err != nil {
+		return fmt.Errorf("unable to decode %s: %v", path, err)
+	}
+
+	var errs []string
+	for key, value := range data {
+		// .env values are strings, like the environment variables.
+		if s, ok := value.(string); ok && format == ".env" {
+			value = c.parseValue(key, s)
+		}
+
+		value, err := interpolate(value, env)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s: %v", path, key, err))
+		}
+		c.set(key, value, ConfigSource{Layer: layer, Origin: path})
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// parseValue converts an environment variable or a flag to the type of the key lower layer value:
+// numbers, booleans, arrays and objects are decoded as JSON when possible (8080, true, ["a","b"]),
+// new keys and strings are kept as is, so APP_SMTP_PASSWORD=123456 stays a string.
+// Int and Bool parse the string values.
+func (c *ConfigData) parseValue(key string, raw string) interface{} {
+	switch c.data[key].(type) {
+	case nil, string:
+		return raw
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err == nil {
+		return v
+	}
+	return raw
+}
+
+// interpolate replaces ${NAME} and ${NAME:-default} in the string values,
+// including the values nested in objects and arrays.
+// An unset variable without default is replaced with an empty string and reported.
+func interpolate(value interface{}, env map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return interpolateString(v, env)
+	case []interface{}:
+		var err error
+		for i := range v {
+			var ierr error
+			if v[i], ierr = interpolate(v[i], env); ierr != nil && err == nil {
+				err = ierr
+			}
+		}
+		return v, err
+	case map[string]interface{}:
+		var err error
+		for k := range v {
+			var ierr error
+			if v[k], ierr = interpolate(v[k], env); ierr != nil && err == nil {
+				err = ierr
+			}
+		}
+		return v, err
+	}
+	return value, nil
+}
+
+func interpolateString(s string, env map[string]string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var buf strings.Builder
+	var missing []string
+
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+
+		buf.WriteString(s[:start])
+
+		name, def, hasDefault := s[start+2:end], "", false
+		if i := strings.Index(name, ":-"); i >= 0 {
+			name, def, hasDefault = name[:i], name[i+2:], true
+		}
+
+		if v, ok := env[name]; ok && (v != "" || !hasDefault) {
+			buf.WriteString(v)
+		} else if hasDefault {
+			buf.WriteString(def)
+		} else {
+			missing = append(missing, name)
+		}
+
+		s = s[end+1:]
+	}
+	buf.WriteString(s)
+
+	if len(missing) > 0 {
+		return buf.String(), fmt.Errorf("%s not set", strings.Join(missing, ", "))
+	}
+	return buf.String(), nil
+}
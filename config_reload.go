@@ -0,0 +1,282 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type (
+	// ConfigChange describes a changed key, notified to the OnChange subscribers.
+	ConfigChange struct {
+		Key string
+		Old interface{}
+		New interface{}
+	}
+
+	// ConfigReload is the outcome of Reload.
+	ConfigReload struct {
+		// Changed are the applied keys.
+		Changed []string
+		// Ignored are the changed keys that can't be reloaded, they're applied on restart.
+		Ignored []string
+	}
+
+	configSubscriber struct {
+		key string
+		fn  func(ConfigChange)
+	}
+)
+
+// staticConfigKeys are read once at startup, their changes are ignored by Reload.
+var staticConfigKeys = map[string]bool{
+	"access_log":      true,
+	"access_log_skip": true,
+	"address":         true,
+	"cache":           true,
+	"cache_beta":      true,
+	"cache_config":    true,
+	"cache_stale":     true,
+	"cert":            true,
+	"cert_key":        true,
+	"config_watch":    true,
+	"database":        true,
+	"database_conn":   true,
+	"grpc_cert":       true,
+	"grpc_cert_key":   true,
+	"grpc_port":       true,
+	"health_path":     true,
+	"metrics":         true,
+	"mode":            true,
+	"port":            true,
+	"pprof":           true,
+	"ready_path":      true,
+	"session":         true,
+	"session_config":  true,
+	"template_left":   true,
+	"template_right":  true,
+	"trace_endpoint":  true,
+	"trace_exporter":  true,
+}
+
+// OnChange registers fn, called when the value of key changes by Reload or Set.
+// Dotted keys watch the nested values, an empty key watches every key.
+func (c *ConfigData) OnChange(key string, fn func(ConfigChange)) {
+	c.mu.Lock()
+	subscribers := make([]configSubscriber, len(c.subscribers), len(c.subscribers)+1)
+	copy(subscribers, c.subscribers)
+	c.subscribers = append(subscribers, configSubscriber{key: key, fn: fn})
+	c.mu.Unlock()
+}
+
+// Reload loads the configuration layers again, validates them and swaps the values atomically.
+// The keys that can't be reloaded (f.e. port) keep their value and are reported as Ignored,
+// the values updated at runtime with Set are kept.
+// On errors the current configuration is unchanged.
+func (c *ConfigData) Reload() (*ConfigReload, error) {
+	return c.load(false)
+}
+
+// load loads the configuration layers again, see Reload. With static, the static keys
+// are reloaded too: Init does it once the mode is set, before reading them.
+func (c *ConfigData) load(static bool) (*ConfigReload, error) {
+	c.mu.RLock()
+	loader := c.loader
+	c.mu.RUnlock()
+
+	if loader == nil {
+		return nil, fmt.Errorf("config: not loaded from a file")
+	}
+
+	next, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	next.bound = make(map[string]bool, len(c.bound))
+	for key := range c.bound {
+		next.bound[key] = true
+	}
+	c.mu.RUnlock()
+
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	old := c.data
+
+	// Keep the runtime values and the static keys.
+	for key, source := range c.sources {
+		if source.Layer == ConfigSet {
+			next.set(key, old[key], source)
+		}
+	}
+
+	report := &ConfigReload{}
+	for _, key := range changedConfigKeys(old, next.data) {
+		if static || !staticConfigKeys[key] {
+			report.Changed = append(report.Changed, key)
+			continue
+		}
+
+		report.Ignored = append(report.Ignored, key)
+		if v, ok := old[key]; ok {
+			next.set(key, v, c.sources[key])
+		} else {
+			delete(next.data, key)
+			delete(next.sources, key)
+		}
+	}
+
+	c.data, c.sources, c.files, c.secrets = next.data, next.sources, next.files, next.secrets
+	subscribers := c.subscribers
+	c.mu.Unlock()
+
+	notifyConfigChanges(subscribers, old, next.data, report.Changed)
+
+	return report, nil
+}
+
+// changedConfigKeys returns the sorted top-level keys with different values.
+func changedConfigKeys(old, data JSON) []string {
+	var keys []string
+	for key, v := range data {
+		if ov, ok := old[key]; !ok || !reflect.DeepEqual(ov, v) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range old {
+		if _, ok := data[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// notifyConfigChanges calls the subscribers of the changed top-level keys.
+func notifyConfigChanges(subscribers []configSubscriber, old, data JSON, changed []string) {
+	for _, s := range subscribers {
+		for _, key := range changed {
+			switch {
+			case s.key == "":
+				if !reflect.DeepEqual(old[key], data[key]) {
+					s.fn(ConfigChange{Key: key, Old: old[key], New: data[key]})
+				}
+			case s.key == key || strings.HasPrefix(s.key, key+"."):
+				ov, nv := getConfigValue(old, s.key), getConfigValue(data, s.key)
+				if !reflect.DeepEqual(ov, nv) {
+					s.fn(ConfigChange{Key: s.key, Old: ov, New: nv})
+				}
+			}
+		}
+	}
+}
+
+// Watch reloads the configuration when one of its files changes, checking every interval
+// until stop is closed. Errors are logged and the current configuration is kept.
+func (c *ConfigData) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := c.fileStamps()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		stamps := c.fileStamps()
+		if stamps == last {
+			continue
+		}
+		last = stamps
+
+		c.reload("file changed")
+	}
+}
+
+// fileStamps returns the size and modification time of the configuration files.
+func (c *ConfigData) fileStamps() string {
+	c.mu.RLock()
+	files := c.files
+	c.mu.RUnlock()
+
+	var stamps []string
+	for _, path := range files {
+		if fi, err := os.Stat(path); err == nil {
+			stamps = append(stamps, fmt.Sprintf("%s:%d:%d", path, fi.Size(), fi.ModTime().UnixNano()))
+		}
+	}
+	return strings.Join(stamps, "|")
+}
+
+// reload calls Reload and logs the outcome.
+func (c *ConfigData) reload(reason string) {
+	report, err := c.Reload()
+	if err != nil {
+		Log.Error(fmt.Errorf("config reload (%s) failed: %v", reason, err))
+		return
+	}
+
+	Log.Info(fmt.Sprintf("config reloaded (%s), changed keys: %s", reason, strings.Join(report.Changed, ", ")))
+	for _, key := range report.Ignored {
+		Log.Warning(fmt.Sprintf("config key %s changed but can't be reloaded, restart to apply it", key))
+	}
+}
+
+// watchConfig reloads the configuration on SIGHUP and, when config_watch is set,
+// when the files change. The framework settings are updated on change.
+func (engine *Engine) watchConfig() {
+	Config.OnChange("log_level", func(ConfigChange) { configureLogger(Log, Config) })
+	Config.OnChange("log_format", func(ConfigChange) { configureLogger(Log, Config) })
+	Config.OnChange("log_sinks", func(ConfigChange) { configureLogger(Log, Config) })
+	Config.OnChange("trusted_proxies", func(ConfigChange) {
+		if err := SetTrustedProxies(Config.StringSlice("trusted_proxies")...); err != nil {
+			Log.Error(err)
+		}
+	})
+	Config.OnChange("trace_sample_ratio", func(change ConfigChange) {
+		if change.New != nil {
+			Tracing.SetSampleRatio(Config.Float("trace_sample_ratio"))
+		}
+	})
+
+	config, ok := Config.(*ConfigData)
+	if !ok {
+		return
+	}
+
+	if interval := Config.Duration("config_watch"); interval > 0 {
+		go config.Watch(interval, engine.done)
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-signals:
+				config.reload("SIGHUP")
+			case <-engine.done:
+				return
+			}
+		}
+	}()
+}
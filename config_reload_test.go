@@ -0,0 +1,149 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "app.json", `{"port": 8080, "log_level": "info", "feature": {"beta": false}}`)
+
+	config, err := (&ConfigLoader{Path: path}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feature struct {
+		Beta bool `config:"feature.beta"`
+	}
+	if err := config.Bind(&feature); err != nil {
+		t.Fatal(err)
+	}
+	config.Set("runtime", "kept")
+
+	var mu sync.Mutex
+	var changes []ConfigChange
+	record := func(change ConfigChange) {
+		mu.Lock()
+		changes = append(changes, change)
+		mu.Unlock()
+	}
+	config.OnChange("feature.beta", record)
+	config.OnChange("port", record)
+	config.OnChange("name", record)
+
+	var all []string
+	config.OnChange("", func(change ConfigChange) { all = append(all, change.Key) })
+
+	writeConfigFile(t, dir, "app.json", `{"port": 9000, "log_level": "debug", "feature": {"beta": true}}`)
+
+	// Concurrent readers see either configuration.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = config.String("log_level")
+			_ = config.Bool("feature.beta")
+		}
+	}()
+
+	report, err := config.Reload()
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(report.Changed, []string{"feature", "log_level"}) || !reflect.DeepEqual(report.Ignored, []string{"port"}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if config.Int("port") != 8080 || config.String("log_level") != "debug" || !config.Bool("feature.beta") || config.String("runtime") != "kept" {
+		t.Fatalf("unexpected config %v", config.data)
+	}
+	if !reflect.DeepEqual(changes, []ConfigChange{{Key: "feature.beta", Old: false, New: true}}) {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if !reflect.DeepEqual(all, []string{"feature", "log_level"}) {
+		t.Fatalf("unexpected changes %v", all)
+	}
+
+	// Invalid configurations are not applied.
+	writeConfigFile(t, dir, "app.json", `{"port": 8080, "log_level": "info", "feature": {"beta": false}, "typo": 1}`)
+	if _, err := config.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+	writeConfigFile(t, dir, "app.json", `{"port": 8080, "log_level": 1}`)
+	if _, err := config.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if config.String("log_level") != "debug" || !config.Bool("feature.beta") {
+		t.Fatal("configuration changed by an invalid reload")
+	}
+
+	if _, err := DefaultConfig().Reload(); err == nil {
+		t.Fatal("expected an error without file")
+	}
+}
+
+func TestConfigSetNotifies(t *testing.T) {
+	config := DefaultConfig()
+
+	var changes []ConfigChange
+	config.OnChange("session_config.save_path", func(change ConfigChange) { changes = append(changes, change) })
+
+	config.Set("session_config", map[string]interface{}{"save_path": "/tmp"})
+	config.Set("session_config", map[string]interface{}{"save_path": "/tmp", "name": "sid"})
+	config.Set("name", "other")
+
+	if !reflect.DeepEqual(changes, []ConfigChange{{Key: "session_config.save_path", Old: nil, New: "/tmp"}}) {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+}
+
+func TestConfigWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "app.json", `{"log_level": "info"}`)
+
+	config, err := (&ConfigLoader{Path: path}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan interface{}, 1)
+	config.OnChange("log_level", func(change ConfigChange) { changed <- change.New })
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go config.Watch(10*time.Millisecond, stop)
+
+	// The modification time resolution may be coarse, the size changes.
+	time.Sleep(20 * time.Millisecond)
+	writeConfigFile(t, dir, "app.json", `{"log_level": "warning"}`)
+
+	select {
+	case v := <-changed:
+		if v != "warning" {
+			t.Fatalf("unexpected value %v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration not reloaded")
+	}
+}
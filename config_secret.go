@@ -0,0 +1,255 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// EncryptedPrefix marks the encrypted config values, see EncryptConfigValue.
+	EncryptedPrefix = "enc:"
+	// ConfigKeyEnv is the environment variable with the base64 master key.
+	ConfigKeyEnv = "FRAMEWORK_CONFIG_KEY"
+	// ConfigKeyFileEnv is the environment variable with the path of the master key file.
+	ConfigKeyFileEnv = "FRAMEWORK_CONFIG_KEY_FILE"
+	// Redacted replaces the secret values in the dumps.
+	Redacted = "[REDACTED]"
+)
+
+// GenerateConfigKey returns a new random base64 master key (AES-256).
+func GenerateConfigKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseConfigKey decodes a base64 master key of 16, 24 or 32 bytes.
+func ParseConfigKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid master key: %v", err)
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("config: invalid master key size %d", len(key))
+}
+
+// EncryptConfigValue encrypts plaintext with AES-GCM and returns "enc:" followed
+// by the base64 nonce and ciphertext.
+func EncryptConfigValue(key []byte, plaintext string) (string, error) {
+	aead, err := newConfigAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptConfigValue decrypts a value returned by EncryptConfigValue.
+func DecryptConfigValue(key []byte, value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedPrefix) {
+		return "", fmt.Errorf("config: value is not encrypted")
+	}
+
+	aead, err := newConfigAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(value[len(EncryptedPrefix):])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("config: invalid encrypted value")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("config: unable to decrypt value, wrong master key?")
+	}
+	return string(plaintext), nil
+}
+
+func newConfigAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid master key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// MasterKey returns the master key decrypting the "enc:" values:
+// the Key field, the FRAMEWORK_CONFIG_KEY environment variable, the file at
+// FRAMEWORK_CONFIG_KEY_FILE or master.key next to the configuration file.
+func (l *ConfigLoader) MasterKey() ([]byte, error) {
+	if l.Key != nil {
+		return l.Key, nil
+	}
+
+	env := l.env()
+	if s := env[ConfigKeyEnv]; s != "" {
+		return ParseConfigKey(s)
+	}
+
+	path := env[ConfigKeyFileEnv]
+	if path == "" && l.Path != "" {
+		path = filepath.Join(filepath.Dir(l.Path), "master.key")
+	}
+	if path == "" {
+		return nil, fmt.Errorf("config: no master key, set %s or %s", ConfigKeyEnv, ConfigKeyFileEnv)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("config: no master key, set %s or %s", ConfigKeyEnv, ConfigKeyFileEnv)
+		}
+		return nil, err
+	}
+	return ParseConfigKey(string(b))
+}
+
+// decrypt replaces the "enc:" values, the master key is read on the first one.
+// The decrypted keys are recorded as secrets.
+func (c *ConfigData) decrypt(l *ConfigLoader) error {
+	var key []byte
+	var keyErr error
+	var errs []string
+
+	var walk func(path string, v interface{}) interface{}
+	walk = func(path string, v interface{}) interface{} {
+		switch v := v.(type) {
+		case string:
+			if !strings.HasPrefix(v, EncryptedPrefix) {
+				return v
+			}
+
+			if key == nil && keyErr == nil {
+				key, keyErr = l.MasterKey()
+			}
+			if keyErr != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", path, keyErr))
+				return v
+			}
+
+			plaintext, err := DecryptConfigValue(key, v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+				return v
+			}
+
+			if c.secrets == nil {
+				c.secrets = make(map[string]bool)
+			}
+			c.secrets[path] = true
+			return plaintext
+		case map[string]interface{}:
+			for k, item := range v {
+				v[k] = walk(path+"."+k, item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = walk(path, item)
+			}
+		}
+		return v
+	}
+
+	for k, v := range c.data {
+		c.data[k] = walk(k, v)
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// isSecretKey reports whether the key name looks like a secret (password, token, key...).
+func isSecretKey(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"password", "passwd", "secret", "token", "credential"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return name == "key" || name == "keys" || strings.HasSuffix(name, "_key") || strings.HasSuffix(name, "_keys")
+}
+
+// Redacted returns a copy of the configuration with the secrets replaced by "[REDACTED]":
+// the decrypted values and the keys named like secrets (f.e. smtp_password, cookie_keys).
+func (c *ConfigData) Redacted() JSON {
+	c.mu.RLock()
+	data, secrets := c.data, c.secrets
+	c.mu.RUnlock()
+
+	var redact func(path, name string, v interface{}) interface{}
+	redact = func(path, name string, v interface{}) interface{} {
+		if secrets[path] || (v != nil && v != "" && isSecretKey(name)) {
+			return Redacted
+		}
+
+		switch v := v.(type) {
+		case JSON:
+			return redact(path, name, map[string]interface{}(v))
+		case map[string]interface{}:
+			m := make(map[string]interface{}, len(v))
+			for k, item := range v {
+				m[k] = redact(path+"."+k, k, item)
+			}
+			return m
+		case []interface{}:
+			s := make([]interface{}, len(v))
+			for i, item := range v {
+				s[i] = redact(path, name, item)
+			}
+			return s
+		}
+		return v
+	}
+
+	out := make(JSON, len(data))
+	for k, v := range data {
+		out[k] = redact(k, k, v)
+	}
+	return out
+}
+
+// MarshalJSON encodes the redacted configuration.
+func (c *ConfigData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Redacted())
+}
+
+// Format prints the redacted configuration, so the secrets aren't logged by fmt and Log.
+func (c *ConfigData) Format(f fmt.State, verb rune) {
+	b, err := json.Marshal(c.Redacted())
+	if err != nil {
+		fmt.Fprintf(f, "%%!%c(%v)", verb, err)
+		return
+	}
+	_, _ = f.Write(b)
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptConfigValue(t *testing.T) {
+	encoded, err := GenerateConfigKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseConfigKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := EncryptConfigValue(key, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, EncryptedPrefix) || strings.Contains(value, "s3cr3t") {
+		t.Fatalf("unexpected value %s", value)
+	}
+
+	if again, _ := EncryptConfigValue(key, "s3cr3t"); again == value {
+		t.Fatal("expected a random nonce")
+	}
+
+	if plaintext, err := DecryptConfigValue(key, value); err != nil || plaintext != "s3cr3t" {
+		t.Fatalf("unexpected plaintext %q %v", plaintext, err)
+	}
+
+	other, _ := GenerateConfigKey()
+	otherKey, _ := ParseConfigKey(other)
+	if _, err := DecryptConfigValue(otherKey, value); err == nil {
+		t.Fatal("expected an error with the wrong key")
+	}
+
+	// Tampered values are rejected.
+	b, _ := base64.StdEncoding.DecodeString(value[len(EncryptedPrefix):])
+	b[len(b)-1] ^= 1
+	if _, err := DecryptConfigValue(key, EncryptedPrefix+base64.StdEncoding.EncodeToString(b)); err == nil {
+		t.Fatal("expected an error with a tampered value")
+	}
+
+	if _, err := ParseConfigKey(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Fatal("expected an error with a short key")
+	}
+}
+
+func TestConfigEncryptedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	encoded, _ := GenerateConfigKey()
+	key, _ := ParseConfigKey(encoded)
+	password, _ := EncryptConfigValue(key, "smtp-secret")
+	sessionKey, _ := EncryptConfigValue(key, "session-secret")
+	envValue, _ := EncryptConfigValue(key, "db-secret")
+
+	path := writeConfigFile(t, dir, "app.json", fmt.Sprintf(`{
+		"smtp_password": %q,
+		"session_config": {"key": %q, "name": "sid"},
+		"database": "mysql"
+	}`, password, sessionKey))
+	writeConfigFile(t, dir, "master.key", encoded+"\n")
+
+	loader := &ConfigLoader{Path: path, EnvPrefix: "APP_", Environ: []string{"APP_DATABASE_CONN=" + envValue}}
+
+	config, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.String("smtp_password") != "smtp-secret" || config.String("session_config.key") != "session-secret" ||
+		config.String("database_conn") != "db-secret" {
+		t.Fatalf("values not decrypted")
+	}
+
+	// The secrets are redacted when dumped or logged.
+	for _, out := range []string{fmt.Sprint(config), fmt.Sprintf("%v", config)} {
+		if strings.Contains(out, "secret") || !strings.Contains(out, Redacted) || !strings.Contains(out, "mysql") {
+			t.Errorf("secrets not redacted: %s", out)
+		}
+	}
+	b, _ := json.Marshal(config)
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("secrets not redacted: %s", b)
+	}
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf)
+	logger.SetEncoder(&JSONEncoder{})
+	logger.With("config", config).Info("loaded")
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("secrets logged: %s", buf.String())
+	}
+
+	// The binding errors don't show the decrypted values.
+	var bound struct {
+		Port int `config:"smtp_password"`
+	}
+	if err := config.Bind(&bound); err == nil || strings.Contains(err.Error(), "secret") ||
+		!strings.Contains(err.Error(), "smtp_password (file "+path+")") {
+		t.Errorf("unexpected binding error %v", err)
+	}
+
+	// Without master key the values aren't decrypted.
+	_ = os.Remove(filepath.Join(dir, "master.key"))
+	if _, err := (&ConfigLoader{Path: path}).Load(); err == nil || !strings.Contains(err.Error(), "smtp_password") {
+		t.Fatalf("expected a master key error, got %v", err)
+	}
+
+	loader = &ConfigLoader{Path: path, Environ: []string{ConfigKeyEnv + "=" + encoded}}
+	if config, err = loader.Load(); err != nil || config.String("smtp_password") != "smtp-secret" {
+		t.Fatalf("unexpected config %v", err)
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := func(l *ConfigLoader, in string, args ...string) string {
+		var out bytes.Buffer
+		if err := l.Command(args, strings.NewReader(in), &out); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		return strings.TrimSpace(out.String())
+	}
+
+	loader := &ConfigLoader{Path: filepath.Join(dir, "app.json")}
+	encoded := run(loader, "", "genkey")
+
+	keyFile := writeConfigFile(t, dir, "key", encoded)
+	loader.Environ = []string{ConfigKeyFileEnv + "=" + keyFile}
+
+	value := run(loader, "from stdin\n", "encrypt")
+	if run(loader, value+"\n", "decrypt") != "from stdin" {
+		t.Fatal("unexpected decrypted value")
+	}
+
+	value = run(loader, "", "encrypt", "hunter2")
+	writeConfigFile(t, dir, "app.json", fmt.Sprintf(`{"smtp_password": %q, "name": "app"}`, value))
+
+	for _, format := range []string{"json", "yaml", "toml", "env"} {
+		out := run(loader, "", "dump", format)
+		if strings.Contains(out, "hunter2") || !strings.Contains(out, Redacted) || !strings.Contains(out, "app") {
+			t.Errorf("%s: unexpected dump %s", format, out)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := loader.Command([]string{"unknown"}, nil, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Fatalf("expected the usage, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "app.json", `{
+		"name": "app",
+		"mode": "production",
+		"port": 3000,
+		"smtp_server": "${SMTP_HOST}:${SMTP_PORT:-25}",
+		"database_conn": "user:${DB_PASS}@/db",
+		"session_config": {"save_path": "${TMP:-/tmp}/sessions"}
+	}`)
+	writeConfigFile(t, dir, "app.production.json", `{"port": 80, "compress_html": false}`)
+
+	loader := &ConfigLoader{
+		Path:      path,
+		EnvPrefix: "APP_",
+		Environ: []string{
+			"SMTP_HOST=mail.local",
+			"DB_PASS=secret",
+			"APP_SMTP_PASSWORD=123456",
+			"APP_COOKIE_SECURE=false",
+			"APP_COMPRESS_CSS=false",
+			"APP_REQUEST_TIMEOUT=30",
+			"APP_TEMPLATE_LEFT=[[",
+			"APP_=ignored",
+		},
+		Args: []string{"-test.v", "--config.port=8443", "-config.version", "1.2", "--config.grpc_port", "9000", "--config.cookie_secure", "--", "--config.name=x"},
+	}
+
+	config, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key    string
+		value  interface{}
+		source string
+	}{
+		{"author", "AnUnnamedProject", ConfigDefault},
+		{"name", "app", ConfigFile + " " + path},
+		{"smtp_server", "mail.local:25", ConfigFile + " " + path},
+		{"database_conn", "user:secret@/db", ConfigFile + " " + path},
+		{"compress_html", false, ConfigModeFile + " " + filepath.Join(dir, "app.production.json")},
+		{"smtp_password", "123456", ConfigEnv + " APP_SMTP_PASSWORD"},
+		{"cookie_secure", "true", ConfigFlag + " --config.cookie_secure"},
+		{"compress_css", false, ConfigEnv + " APP_COMPRESS_CSS"},
+		{"request_timeout", "30", ConfigEnv + " APP_REQUEST_TIMEOUT"},
+		{"template_left", "[[", ConfigEnv + " APP_TEMPLATE_LEFT"},
+		{"port", float64(8443), ConfigFlag + " --config.port"},
+		{"version", "1.2", ConfigFlag + " --config.version"},
+		{"grpc_port", "9000", ConfigFlag + " --config.grpc_port"},
+	}
+
+	for _, tt := range tests {
+		if v := config.Get(tt.key); v != tt.value {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", tt.key, tt.value, tt.value, v, v)
+		}
+		if s := config.Source(tt.key).String(); s != tt.source {
+			t.Errorf("%s: expected source %q, got %q", tt.key, tt.source, s)
+		}
+	}
+
+	if config.Int("request_timeout") != 30 || config.Int("grpc_port") != 9000 || !config.Bool("cookie_secure") {
+		t.Error("expected the string values to be parsed")
+	}
+	if v := config.Get("session_config").(map[string]interface{})["save_path"]; v != "/tmp/sessions" {
+		t.Errorf("unexpected nested value %v", v)
+	}
+	if _, ok := config.Sources()[""]; ok {
+		t.Error("empty key set by APP_")
+	}
+
+	config.Set("port", float64(80))
+	if config.Source("port").Layer != ConfigSet {
+		t.Errorf("unexpected source %v", config.Source("port"))
+	}
+}
+
+func TestConfigLayersErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "app.json", `{"smtp_password": "${SMTP_PASSWORD}"}`)
+	writeConfigFile(t, dir, "app.staging.json", `{invalid`)
+
+	config, err := (&ConfigLoader{Path: path, Mode: "staging"}).Load()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if config.String("smtp_password") != "" || config.Int("port") != 8080 {
+		t.Fatal("expected the usable config")
+	}
+
+	// Missing files aren't errors.
+	if _, err := (&ConfigLoader{Path: filepath.Join(dir, "missing.json")}).Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigGetters(t *testing.T) {
+	config := DefaultConfig()
+	config.Set("timeout", "1m30s")
+	config.Set("delay", float64(5))
+	config.Set("ratio", "0.25")
+	config.Set("proxies", "10.0.0.0/8, 192.168.0.1")
+	config.Set("paths", []interface{}{"/healthz", "", "/metrics"})
+	config.Set("count", 3)
+	config.Set("session_config", map[string]interface{}{
+		"save_path": "/tmp",
+		"cookie":    map[string]interface{}{"secure": true},
+	})
+
+	if d := config.Duration("timeout"); d != 90*time.Second {
+		t.Errorf("unexpected duration %s", d)
+	}
+	if d := config.Duration("delay"); d != 5*time.Second {
+		t.Errorf("unexpected duration %s", d)
+	}
+	if f := config.Float("ratio"); f != 0.25 {
+		t.Errorf("unexpected float %v", f)
+	}
+	if config.Int("count") != 3 || config.Int("port") != 8080 || config.Int("name") != 0 {
+		t.Error("unexpected int")
+	}
+	if s := config.StringSlice("proxies"); !reflect.DeepEqual(s, []string{"10.0.0.0/8", "192.168.0.1"}) {
+		t.Errorf("unexpected slice %q", s)
+	}
+	if s := config.StringSlice("paths"); !reflect.DeepEqual(s, []string{"/healthz", "/metrics"}) {
+		t.Errorf("unexpected slice %q", s)
+	}
+	if config.String("session_config.save_path") != "/tmp" || !config.Bool("session_config.cookie.secure") {
+		t.Error("unexpected dotted values")
+	}
+	if config.Get("session_config.missing.key") != nil || config.Get("name.first") != nil {
+		t.Error("expected nil")
+	}
+}
+
+func TestConfigBind(t *testing.T) {
+	type Database struct {
+		Host    string        `config:"host,required"`
+		Port    int           `config:"port" default:"5432"`
+		Timeout time.Duration `config:"timeout" default:"5s"`
+	}
+
+	var settings struct {
+		Name     string   `json:"name"`
+		Port     uint16   `config:"port"`
+		Secure   bool     `config:"cookie_secure"`
+		Proxies  []string `config:"trusted_proxies"`
+		Ratio    float64  `config:"trace_sample_ratio" default:"0.5"`
+		Database Database `config:"db"`
+		Limits   map[string]int
+		Ignored  string `config:"-"`
+		private  string
+	}
+
+	config := DefaultConfig()
+	config.Set("cookie_secure", "true")
+	config.Set("trusted_proxies", []interface{}{"10.0.0.1"})
+	config.Set("db", map[string]interface{}{"host": "localhost", "timeout": "1m"})
+	config.Set("limits", map[string]interface{}{"api": float64(100)})
+
+	if err := config.Bind(&settings); err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.Name != "AnUnnamedApp" || settings.Port != 8080 || !settings.Secure || settings.Ratio != 0.5 ||
+		!reflect.DeepEqual(settings.Proxies, []string{"10.0.0.1"}) || settings.Limits["api"] != 100 {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+	if settings.Database != (Database{Host: "localhost", Port: 5432, Timeout: time.Minute}) {
+		t.Errorf("unexpected database %+v", settings.Database)
+	}
+
+	if err := config.Bind(settings); err == nil {
+		t.Error("expected an error binding a struct value")
+	}
+
+	// Every invalid key is reported.
+	config.Set("port", float64(80.5))
+	config.Set("cookie_secure", "maybe")
+	config.Set("db", map[string]interface{}{"port": "x"})
+
+	err := config.Bind(&settings)
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("unexpected errors %v", err)
+	}
+	for _, key := range []string{"port", "cookie_secure", "db.host", "db.port"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("%s not reported in %v", key, err)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "app.json", `{"port": "http", "smtp_pasword": "secret", "feature": {"beta": true}}`)
+
+	config, err := (&ConfigLoader{Path: path, EnvPrefix: "APP_", Environ: []string{"APP_PROT=80", "APP_FOO=bar"}}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Set("runtime", true)
+
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"invalid key port", "unknown key smtp_pasword (file " + path + ")", "unknown key feature"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q not reported in %v", want, err)
+		}
+	}
+
+	// The stray environment variables are only warnings.
+	if strings.Contains(err.Error(), "prot") || strings.Contains(err.Error(), "foo") {
+		t.Errorf("environment variables reported as errors: %v", err)
+	}
+	if keys := config.UnknownEnv(); !reflect.DeepEqual(keys, []string{"foo", "prot"}) {
+		t.Errorf("unexpected unknown environment keys %v", keys)
+	}
+	if strings.Contains(err.Error(), "runtime") {
+		t.Errorf("keys set at runtime aren't unknown: %v", err)
+	}
+
+	// Bound keys are known.
+	var feature struct {
+		Beta bool `config:"feature.beta"`
+	}
+	config.Set("port", float64(80))
+	config.Set("smtp_password", config.Get("smtp_pasword"))
+	delete(config.data, "smtp_pasword")
+	delete(config.sources, "smtp_pasword")
+	delete(config.data, "prot")
+	delete(config.sources, "prot")
+
+	if err := config.Bind(&feature); err != nil || !feature.Beta {
+		t.Fatalf("unexpected bind %v %+v", err, feature)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,781 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tomlParser decodes TOML v1.0 documents. Date and time values are kept as strings.
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+
+	// defined contains the explicitly defined tables, they can't be defined twice.
+	defined map[string]bool
+}
+
+// decodeTOML decodes a TOML document into the configuration model:
+// tables are JSON, integers and floats float64.
+func decodeTOML(b []byte) (JSON, error) {
+	p := &tomlParser{s: strings.Replace(string(b), "\r\n", "\n", -1), line: 1, defined: map[string]bool{}}
+
+	root := map[string]interface{}{}
+	if err := p.parse(root); err != nil {
+		return nil, err
+	}
+	return JSON(root), nil
+}
+
+func (p *tomlParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("toml: line %d: %s", p.line, fmt.Sprintf(format, a...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *tomlParser) skipSpaces() {
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// skipComment skips the spaces and a comment up to the end of line.
+func (p *tomlParser) skipComment() {
+	p.skipSpaces()
+	if p.peek() == '#' {
+		for !p.eof() && p.s[p.pos] != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// skipBlank skips the spaces, the comments and the new lines.
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipComment()
+		if p.peek() != '\n' {
+			return
+		}
+		p.pos++
+		p.line++
+	}
+}
+
+// endOfLine expects the end of the line after a key/value pair or a table header.
+func (p *tomlParser) endOfLine() error {
+	p.skipComment()
+	if p.eof() {
+		return nil
+	}
+	if p.s[p.pos] != '\n' {
+		return p.errorf("unexpected %q", p.rest())
+	}
+	p.pos++
+	p.line++
+	return nil
+}
+
+func (p *tomlParser) rest() string {
+	end := strings.IndexByte(p.s[p.pos:], '\n')
+	if end < 0 {
+		return p.s[p.pos:]
+	}
+	return p.s[p.pos : p.pos+end]
+}
+
+func (p *tomlParser) parse(root map[string]interface{}) error {
+	current := root
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil
+		}
+
+		if p.peek() != '[' {
+			if err := p.parseKeyValue(current); err != nil {
+				return err
+			}
+			if err := p.endOfLine(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		array := strings.HasPrefix(p.s[p.pos:], "[[")
+		if array {
+			p.pos += 2
+		} else {
+			p.pos++
+		}
+
+		p.skipSpaces()
+		path, err := p.parseKey()
+		if err != nil {
+			return err
+		}
+		p.skipSpaces()
+
+		if array {
+			if !strings.HasPrefix(p.s[p.pos:], "]]") {
+				return p.errorf("expected ]] after table name")
+			}
+			p.pos += 2
+
+			parent, err := p.table(root, path[:len(path)-1])
+			if err != nil {
+				return err
+			}
+
+			name := path[len(path)-1]
+			tables, ok := parent[name].([]interface{})
+			if parent[name] != nil && !ok {
+				return p.errorf("%s is not an array of tables", strings.Join(path, "."))
+			}
+
+			current = map[string]interface{}{}
+			parent[name] = append(tables, current)
+		} else {
+			if p.peek() != ']' {
+				return p.errorf("expected ] after table name")
+			}
+			p.pos++
+
+			key := strings.Join(path, "\x00")
+			if p.defined[key] {
+				return p.errorf("table %s defined twice", strings.Join(path, "."))
+			}
+			p.defined[key] = true
+
+			if current, err = p.table(root, path); err != nil {
+				return err
+			}
+		}
+
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// table returns the table at path, creating the missing tables.
+// The last table of an array of tables is used.
+func (p *tomlParser) table(root map[string]interface{}, path []string) (map[string]interface{}, error) {
+	t := root
+	for _, name := range path {
+		switch v := t[name].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			t[name] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			last, ok := tomlLastTable(v)
+			if !ok {
+				return nil, p.errorf("%s is not a table", name)
+			}
+			t = last
+		default:
+			return nil, p.errorf("%s is not a table", name)
+		}
+	}
+	return t, nil
+}
+
+func tomlLastTable(v []interface{}) (map[string]interface{}, bool) {
+	if len(v) == 0 {
+		return nil, false
+	}
+	t, ok := v[len(v)-1].(map[string]interface{})
+	return t, ok
+}
+
+// parseKeyValue parses key = value into t, dotted keys create the nested tables.
+func (p *tomlParser) parseKeyValue(t map[string]interface{}) error {
+	path, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	p.skipSpaces()
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(path, "."))
+	}
+	p.pos++
+	p.skipSpaces()
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range path[:len(path)-1] {
+		next, ok := t[name].(map[string]interface{})
+		if !ok {
+			if t[name] != nil {
+				return p.errorf("%s is not a table", name)
+			}
+			next = map[string]interface{}{}
+			t[name] = next
+		}
+		t = next
+	}
+
+	name := path[len(path)-1]
+	if _, ok := t[name]; ok {
+		return p.errorf("duplicate key %s", strings.Join(path, "."))
+	}
+	t[name] = value
+	return nil
+}
+
+// parseKey parses a bare, quoted or dotted key.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var path []string
+
+	for {
+		p.skipSpaces()
+
+		var name string
+		switch p.peek() {
+		case '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			name = s
+		case '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			name = s
+		default:
+			start := p.pos
+			for !p.eof() && isTOMLBareKeyChar(p.s[p.pos]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected a key, got %q", p.rest())
+			}
+			name = p.s[start:p.pos]
+		}
+		path = append(path, name)
+
+		p.skipSpaces()
+		if p.peek() != '.' {
+			return path, nil
+		}
+		p.pos++
+	}
+}
+
+func isTOMLBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		if strings.HasPrefix(p.s[p.pos:], `"""`) {
+			return p.parseMultilineString(`"""`)
+		}
+		return p.parseBasicString()
+	case c == '\'':
+		if strings.HasPrefix(p.s[p.pos:], "'''") {
+			return p.parseMultilineString("'''")
+		}
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	case strings.HasPrefix(p.s[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.s[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	}
+
+	return p.parseNumberOrDate()
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	var buf bytes.Buffer
+	p.pos++
+
+	for !p.eof() {
+		c := p.s[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return buf.String(), nil
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\':
+			if err := p.parseEscape(&buf); err != nil {
+				return "", err
+			}
+		default:
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.pos++
+	start := p.pos
+
+	for !p.eof() {
+		switch p.s[p.pos] {
+		case '\'':
+			s := p.s[start:p.pos]
+			p.pos++
+			return s, nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		}
+		p.pos++
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseMultilineString parses the multi-line basic and literal strings, delim is the quotes.
+func (p *tomlParser) parseMultilineString(delim string) (string, error) {
+	var buf bytes.Buffer
+	p.pos += 3
+
+	// A new line after the opening delimiter is trimmed.
+	if p.peek() == '\n' {
+		p.pos++
+		p.line++
+	}
+
+	for !p.eof() {
+		if strings.HasPrefix(p.s[p.pos:], delim) {
+			// Up to two quotes are allowed before the closing delimiter.
+			for i := 0; i < 2 && strings.HasPrefix(p.s[p.pos+1:], delim); i++ {
+				buf.WriteByte(delim[0])
+				p.pos++
+			}
+			p.pos += 3
+			return buf.String(), nil
+		}
+
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && delim == `"""`:
+			// A line ending backslash trims the new line and the following spaces.
+			end := p.pos + 1
+			for end < len(p.s) && (p.s[end] == ' ' || p.s[end] == '\t') {
+				end++
+			}
+			if end < len(p.s) && p.s[end] == '\n' {
+				p.pos = end
+				for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+					if p.s[p.pos] == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if err := p.parseEscape(&buf); err != nil {
+				return "", err
+			}
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *tomlParser) parseEscape(buf *bytes.Buffer) error {
+	p.pos++
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+
+	c := p.s[p.pos]
+	p.pos++
+
+	switch c {
+	case 'b':
+		buf.WriteByte('\b')
+	case 't':
+		buf.WriteByte('\t')
+	case 'n':
+		buf.WriteByte('\n')
+	case 'f':
+		buf.WriteByte('\f')
+	case 'r':
+		buf.WriteByte('\r')
+	case 'e':
+		buf.WriteByte(0x1b)
+	case '"', '\\':
+		buf.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.s) {
+			return p.errorf("invalid escape \\%c", c)
+		}
+		n, err := strconv.ParseUint(p.s[p.pos:p.pos+size], 16, 32)
+		if err != nil {
+			return p.errorf("invalid escape \\%c%s", c, p.s[p.pos:p.pos+size])
+		}
+		buf.WriteRune(rune(n))
+		p.pos += size
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	a := []interface{}{}
+	p.pos++
+
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			return a, nil
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return a, nil
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	t := map[string]interface{}{}
+	p.pos++
+
+	p.skipSpaces()
+	if p.peek() == '}' {
+		p.pos++
+		return t, nil
+	}
+
+	for {
+		if err := p.parseKeyValue(t); err != nil {
+			return nil, err
+		}
+
+		p.skipSpaces()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return t, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// parseNumberOrDate parses the integers, the floats and the date/time values.
+func (p *tomlParser) parseNumberOrDate() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && strings.IndexByte("0123456789abcdefxABCDEFXoOinINTZ+-._:", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+
+	// Date and time separated by a space: 1979-05-27 07:32:00Z
+	if p.pos-start == 10 && p.peek() == ' ' && p.pos+3 < len(p.s) && isDigit(p.s[p.pos+1]) && isDigit(p.s[p.pos+2]) && p.s[p.pos+3] == ':' {
+		p.pos++
+		for !p.eof() && strings.IndexByte("0123456789Z+-.:", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+	}
+
+	token := p.s[start:p.pos]
+	if token == "" {
+		return nil, p.errorf("expected a value, got %q", p.rest())
+	}
+
+	if isTOMLDate(token) {
+		return token, nil
+	}
+
+	f, ok := parseTOMLNumber(token)
+	if !ok {
+		return nil, p.errorf("invalid value %q", token)
+	}
+	return f, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isTOMLDate reports whether token is a date (1979-05-27) or a time (07:32:00).
+func isTOMLDate(token string) bool {
+	if len(token) >= 10 && isDigit(token[0]) && token[4] == '-' && token[7] == '-' {
+		return true
+	}
+	return len(token) >= 8 && isDigit(token[0]) && token[2] == ':' && token[5] == ':'
+}
+
+func parseTOMLNumber(token string) (float64, bool) {
+	switch strings.TrimLeft(token, "+-") {
+	case "inf":
+		if token[0] == '-' {
+			return math.Inf(-1), true
+		}
+		return math.Inf(1), true
+	case "nan":
+		return math.NaN(), true
+	}
+
+	// Underscores are allowed between digits only.
+	if strings.HasPrefix(token, "_") || strings.HasSuffix(token, "_") || strings.Contains(token, "__") {
+		return 0, false
+	}
+	clean := strings.Replace(token, "_", "", -1)
+
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(clean, prefix) {
+			n, err := strconv.ParseUint(clean[2:], base, 64)
+			return float64(n), err == nil
+		}
+	}
+
+	// Leading zeros aren't allowed.
+	digits := strings.TrimLeft(clean, "+-")
+	if len(digits) > 1 && digits[0] == '0' && isDigit(digits[1]) {
+		return 0, false
+	}
+	if strings.ContainsAny(clean, "xXpPiInN") {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(clean, 64)
+	return f, err == nil
+}
+
+// encodeTOML encodes the configuration as TOML, keys are sorted.
+// TOML has no null, nil values are an error.
+func encodeTOML(data JSON) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeTOMLTable(&buf, nil, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeTOMLTable writes the key/value pairs of t, then its sub-tables.
+func writeTOMLTable(buf *bytes.Buffer, path []string, t map[string]interface{}) error {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var tables []string
+	for _, key := range keys {
+		if isTOMLTable(t[key]) || isTOMLArrayOfTables(t[key]) {
+			tables = append(tables, key)
+			continue
+		}
+
+		s, err := tomlValue(t[key])
+		if err != nil {
+			return fmt.Errorf("%s: %v", strings.Join(append(path, key), "."), err)
+		}
+		fmt.Fprintf(buf, "%s = %s\n", tomlKey(key), s)
+	}
+
+	for _, key := range tables {
+		sub := append(append([]string{}, path...), key)
+
+		header := make([]string, len(sub))
+		for i, name := range sub {
+			header[i] = tomlKey(name)
+		}
+
+		if isTOMLTable(t[key]) {
+			fmt.Fprintf(buf, "\n[%s]\n", strings.Join(header, "."))
+			if err := writeTOMLTable(buf, sub, tomlTable(t[key])); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, item := range t[key].([]interface{}) {
+			fmt.Fprintf(buf, "\n[[%s]]\n", strings.Join(header, "."))
+			if err := writeTOMLTable(buf, sub, tomlTable(item)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func tomlTable(v interface{}) map[string]interface{} {
+	if t, ok := v.(JSON); ok {
+		return t
+	}
+	t, _ := v.(map[string]interface{})
+	return t
+}
+
+func isTOMLTable(v interface{}) bool {
+	return tomlTable(v) != nil
+}
+
+func isTOMLArrayOfTables(v interface{}) bool {
+	a, ok := v.([]interface{})
+	if !ok || len(a) == 0 {
+		return false
+	}
+	for _, item := range a {
+		if !isTOMLTable(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlValue formats the inline value v.
+func tomlValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", fmt.Errorf("null values are not supported")
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return tomlString(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]interface{}, JSON:
+		t := tomlTable(v)
+
+		keys := make([]string, 0, len(t))
+		for key := range t {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, len(keys))
+		for i, key := range keys {
+			s, err := tomlValue(t[key])
+			if err != nil {
+				return "", err
+			}
+			items[i] = tomlKey(key) + " = " + s
+		}
+		return "{" + strings.Join(items, ", ") + "}", nil
+	}
+
+	f, err := toFloat(v)
+	if err != nil {
+		return "", fmt.Errorf("unsupported type %T", v)
+	}
+	switch {
+	case math.IsNaN(f):
+		return "nan", nil
+	case math.IsInf(f, 1):
+		return "inf", nil
+	case math.IsInf(f, -1):
+		return "-inf", nil
+	}
+	return formatConfigFloat(f), nil
+}
+
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isTOMLBareKeyChar(key[i]) {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+// tomlString quotes s as a basic string.
+func tomlString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,834 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlParser decodes the YAML subset used by configuration files:
+// block mappings and sequences, flow collections ([a, b] and {a: 1}),
+// plain, quoted and block (| and >) scalars, comments.
+// Anchors, aliases, tags and multiple documents are not supported.
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// decodeYAML decodes a YAML mapping into the configuration model:
+// objects are JSON, numbers float64, null nil.
+func decodeYAML(b []byte) (JSON, error) {
+	p := &yamlParser{lines: strings.Split(strings.Replace(string(b), "\r\n", "\n", -1), "\n")}
+
+	// Skip the document start marker.
+	if i, ok := p.peek(); ok && strings.TrimSpace(p.lines[i]) == "---" {
+		p.pos = i + 1
+	}
+
+	data := JSON{}
+
+	i, ok := p.peek()
+	if !ok {
+		return data, nil
+	}
+
+	v, err := p.parseNode(indentOf(p.lines[i]))
+	if err != nil {
+		return nil, err
+	}
+
+	if i, ok := p.peek(); ok && strings.TrimSpace(p.lines[i]) != "..." {
+		return nil, p.errorf(i, "unexpected content")
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("yaml: expected a mapping, got %T", v)
+	}
+	for key, value := range m {
+		data[key] = value
+	}
+	return data, nil
+}
+
+func (p *yamlParser) errorf(line int, format string, a ...interface{}) error {
+	return fmt.Errorf("yaml: line %d: %s", line+1, fmt.Sprintf(format, a...))
+}
+
+// peek returns the index of the next line with content.
+func (p *yamlParser) peek() (int, bool) {
+	for i := p.pos; i < len(p.lines); i++ {
+		text := strings.TrimSpace(p.lines[i])
+		if text != "" && !strings.HasPrefix(text, "#") {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseNode parses the mapping, the sequence or the scalar starting at the next line,
+// indented by indent.
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	i, _ := p.peek()
+	text := stripYAMLComment(strings.TrimSpace(p.lines[i]))
+	if isYAMLSequenceItem(text) {
+		return p.parseSequence(indent)
+	}
+	if yamlMappingColon(text) > 0 {
+		return p.parseMapping(indent)
+	}
+
+	p.pos = i + 1
+	return p.parseValue(i, text, indent-1)
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+
+	for {
+		i, ok := p.peek()
+		if !ok {
+			return m, nil
+		}
+
+		line := p.lines[i]
+		ind := indentOf(line)
+		if line[ind] == '\t' {
+			return nil, p.errorf(i, "tabs are not allowed in indentation")
+		}
+		if ind < indent {
+			return m, nil
+		}
+		if ind > indent {
+			return nil, p.errorf(i, "unexpected indentation")
+		}
+
+		text := stripYAMLComment(strings.TrimSpace(line))
+		if text == "..." || text == "---" || isYAMLSequenceItem(text) {
+			return m, nil
+		}
+
+		colon := yamlMappingColon(text)
+		if colon <= 0 {
+			return nil, p.errorf(i, "expected a key")
+		}
+
+		key, err := yamlKey(text[:colon])
+		if err != nil {
+			return nil, p.errorf(i, "%v", err)
+		}
+		if _, ok := m[key]; ok {
+			return nil, p.errorf(i, "duplicate key %s", key)
+		}
+
+		p.pos = i + 1
+		rest := strings.TrimSpace(text[colon+1:])
+
+		if rest != "" {
+			if m[key], err = p.parseValue(i, rest, indent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// The value is on the next lines, a sequence can be at the same indentation.
+		next, ok := p.peek()
+		switch {
+		case !ok:
+			m[key] = nil
+		case indentOf(p.lines[next]) > indent:
+			if m[key], err = p.parseNode(indentOf(p.lines[next])); err != nil {
+				return nil, err
+			}
+		case indentOf(p.lines[next]) == indent && isYAMLSequenceItem(stripYAMLComment(strings.TrimSpace(p.lines[next]))):
+			if m[key], err = p.parseSequence(indent); err != nil {
+				return nil, err
+			}
+		default:
+			m[key] = nil
+		}
+	}
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	s := []interface{}{}
+
+	for {
+		i, ok := p.peek()
+		if !ok {
+			return s, nil
+		}
+
+		line := p.lines[i]
+		ind := indentOf(line)
+		if line[ind] == '\t' {
+			return nil, p.errorf(i, "tabs are not allowed in indentation")
+		}
+		if ind < indent {
+			return s, nil
+		}
+		if ind > indent {
+			return nil, p.errorf(i, "unexpected indentation")
+		}
+
+		text := strings.TrimSpace(line)
+		if !isYAMLSequenceItem(stripYAMLComment(text)) {
+			return s, nil
+		}
+
+		content := strings.TrimLeft(text[1:], " ")
+		if stripYAMLComment(content) == "" {
+			p.pos = i + 1
+
+			next, ok := p.peek()
+			if !ok || indentOf(p.lines[next]) <= indent {
+				s = append(s, nil)
+				continue
+			}
+
+			v, err := p.parseNode(indentOf(p.lines[next]))
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+			continue
+		}
+
+		// The item content starts a node at its column: "- a: 1" is parsed as "  a: 1".
+		column := len(line) - len(content)
+		p.lines[i] = strings.Repeat(" ", column) + content
+
+		v, err := p.parseNode(column)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+}
+
+// parseValue parses the scalar or the flow collection text of line i.
+// Block scalars and multi-line flow collections read the next lines, indented more than parent.
+func (p *yamlParser) parseValue(i int, text string, parent int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">"):
+		return p.parseBlockScalar(i, text, parent)
+	case strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{"):
+		// Join the lines of a multi-line flow collection.
+		for !yamlFlowClosed(text) {
+			if p.pos >= len(p.lines) {
+				return nil, p.errorf(i, "unterminated flow collection")
+			}
+			text += " " + stripYAMLComment(strings.TrimSpace(p.lines[p.pos]))
+			p.pos++
+		}
+
+		f := &yamlFlow{s: text}
+		v, err := f.parse()
+		if err != nil {
+			return nil, p.errorf(i, "%v", err)
+		}
+		if f.skipSpaces(); f.pos != len(f.s) {
+			return nil, p.errorf(i, "unexpected %q after flow collection", f.s[f.pos:])
+		}
+		return v, nil
+	}
+
+	v, err := parseYAMLScalar(text)
+	if err != nil {
+		return nil, p.errorf(i, "%v", err)
+	}
+	return v, nil
+}
+
+func (p *yamlParser) parseBlockScalar(i int, header string, parent int) (interface{}, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+
+	for _, c := range []byte(header[1:]) {
+		switch c {
+		case '-', '+':
+			chomp = c
+		default:
+			return nil, p.errorf(i, "unsupported block scalar header %q", header)
+		}
+	}
+
+	var lines []string
+	indent := -1
+
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+
+		ind := indentOf(line)
+		if ind <= parent || (indent >= 0 && ind < indent) {
+			break
+		}
+		if indent < 0 {
+			indent = ind
+		}
+		lines = append(lines, line[indent:])
+	}
+
+	// Trailing blank lines are kept by "+" only.
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	trailing := lines[content:]
+	lines = lines[:content]
+
+	var buf bytes.Buffer
+	for n, line := range lines {
+		if n > 0 {
+			switch {
+			case !folded:
+				buf.WriteByte('\n')
+			case line == "" || lines[n-1] == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(lines[n-1], " "):
+				if line != "" || lines[n-1] == "" {
+					buf.WriteByte('\n')
+				}
+			default:
+				buf.WriteByte(' ')
+			}
+		}
+		buf.WriteString(line)
+	}
+
+	switch chomp {
+	case '-':
+	case '+':
+		buf.WriteByte('\n')
+		for range trailing {
+			buf.WriteByte('\n')
+		}
+	default:
+		if len(lines) > 0 {
+			buf.WriteByte('\n')
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// stripYAMLComment removes a "#" comment outside the quoted strings.
+func stripYAMLComment(text string) string {
+	quote := byte(0)
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case (c == '"' || c == '\'') && yamlTokenStart(text, i):
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return text
+}
+
+// yamlTokenStart reports whether a quote at i starts a quoted string.
+func yamlTokenStart(text string, i int) bool {
+	return i == 0 || strings.IndexByte(" \t[{,:-", text[i-1]) >= 0
+}
+
+// yamlMappingColon returns the index of the key separator, -1 if text isn't a mapping entry.
+func yamlMappingColon(text string) int {
+	quote := byte(0)
+	depth := 0
+
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return -1
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && yamlTokenStart(text, i):
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ':' && depth == 0 && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlKey(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("empty key")
+	}
+
+	if text[0] == '"' || text[0] == '\'' {
+		v, err := parseYAMLScalar(text)
+		if err != nil {
+			return "", err
+		}
+		return v.(string), nil
+	}
+	if strings.ContainsAny(text[:1], "&*!|>%@`?") {
+		return "", fmt.Errorf("unsupported key %q", text)
+	}
+	return text, nil
+}
+
+// parseYAMLScalar resolves a quoted or plain scalar.
+func parseYAMLScalar(text string) (interface{}, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	switch text[0] {
+	case '"':
+		s, n, err := unquoteYAMLDouble(text)
+		if err != nil {
+			return nil, err
+		}
+		if n != len(text) {
+			return nil, fmt.Errorf("unexpected %q after string", text[n:])
+		}
+		return s, nil
+	case '\'':
+		s, n, err := unquoteYAMLSingle(text)
+		if err != nil {
+			return nil, err
+		}
+		if n != len(text) {
+			return nil, fmt.Errorf("unexpected %q after string", text[n:])
+		}
+		return s, nil
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported: %q", text)
+	case '@', '`':
+		return nil, fmt.Errorf("reserved character in %q", text)
+	}
+
+	return resolveYAMLPlain(text), nil
+}
+
+// resolveYAMLPlain resolves the null, boolean and number plain scalars (YAML 1.2 core schema).
+func resolveYAMLPlain(text string) interface{} {
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+
+	if f, ok := parseYAMLNumber(text); ok {
+		return f
+	}
+	return text
+}
+
+func parseYAMLNumber(text string) (float64, bool) {
+	c := text[0]
+	if c != '-' && c != '+' && c != '.' && (c < '0' || c > '9') {
+		return 0, false
+	}
+
+	if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0o") {
+		base := 16
+		if text[1] == 'o' {
+			base = 8
+		}
+		n, err := strconv.ParseUint(text[2:], base, 64)
+		return float64(n), err == nil
+	}
+
+	// Go accepts forms that aren't YAML numbers.
+	if strings.ContainsAny(text, "_xXpP") || strings.EqualFold(strings.TrimLeft(text, "+-"), "inf") ||
+		strings.EqualFold(strings.TrimLeft(text, "+-"), "infinity") || strings.EqualFold(text, "nan") {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(text, 64)
+	return f, err == nil
+}
+
+// unquoteYAMLDouble decodes the double quoted string at the start of text,
+// it returns the number of bytes read.
+func unquoteYAMLDouble(text string) (string, int, error) {
+	var buf bytes.Buffer
+
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch c {
+		case '"':
+			return buf.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(text) {
+				return "", 0, fmt.Errorf("unterminated string %s", text)
+			}
+
+			switch text[i] {
+			case '0':
+				buf.WriteByte(0)
+			case 'a':
+				buf.WriteByte('\a')
+			case 'b':
+				buf.WriteByte('\b')
+			case 't', '\t':
+				buf.WriteByte('\t')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'v':
+				buf.WriteByte('\v')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'e':
+				buf.WriteByte(0x1b)
+			case ' ', '"', '/', '\\':
+				buf.WriteByte(text[i])
+			case 'N':
+				buf.WriteString("\u0085")
+			case '_':
+				buf.WriteString("\u00a0")
+			case 'L':
+				buf.WriteString("\u2028")
+			case 'P':
+				buf.WriteString("\u2029")
+			case 'x', 'u', 'U':
+				size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[text[i]]
+				if i+size >= len(text) {
+					return "", 0, fmt.Errorf("invalid escape in %s", text)
+				}
+				n, err := strconv.ParseUint(text[i+1:i+1+size], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape in %s", text)
+				}
+				buf.WriteRune(rune(n))
+				i += size
+			default:
+				return "", 0, fmt.Errorf("invalid escape \\%c in %s", text[i], text)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string %s", text)
+}
+
+// unquoteYAMLSingle decodes the single quoted string at the start of text,
+// it returns the number of bytes read.
+func unquoteYAMLSingle(text string) (string, int, error) {
+	var buf bytes.Buffer
+
+	for i := 1; i < len(text); i++ {
+		if text[i] != '\'' {
+			buf.WriteByte(text[i])
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '\'' {
+			buf.WriteByte('\'')
+			i++
+			continue
+		}
+		return buf.String(), i + 1, nil
+	}
+
+	return "", 0, fmt.Errorf("unterminated string %s", text)
+}
+
+// yamlFlowClosed reports whether the brackets of a flow collection are balanced.
+func yamlFlowClosed(text string) bool {
+	depth := 0
+	quote := byte(0)
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && yamlTokenStart(text, i):
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// yamlFlow parses a flow collection.
+type yamlFlow struct {
+	s   string
+	pos int
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.pos < len(f.s) && (f.s[f.pos] == ' ' || f.s[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) parse() (interface{}, error) {
+	f.skipSpaces()
+	if f.pos == len(f.s) {
+		return nil, fmt.Errorf("unexpected end of flow collection")
+	}
+
+	switch f.s[f.pos] {
+	case '[':
+		return f.parseCollection(']')
+	case '{':
+		return f.parseCollection('}')
+	case '"':
+		s, n, err := unquoteYAMLDouble(f.s[f.pos:])
+		f.pos += n
+		return s, err
+	case '\'':
+		s, n, err := unquoteYAMLSingle(f.s[f.pos:])
+		f.pos += n
+		return s, err
+	}
+
+	// Plain scalar up to the next indicator.
+	start := f.pos
+	for f.pos < len(f.s) {
+		c := f.s[f.pos]
+		if c == ',' || c == ']' || c == '}' || (c == ':' && (f.pos+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.pos+1]) >= 0)) {
+			break
+		}
+		f.pos++
+	}
+	return parseYAMLScalar(strings.TrimSpace(f.s[start:f.pos]))
+}
+
+func (f *yamlFlow) parseCollection(end byte) (interface{}, error) {
+	f.pos++
+
+	s := []interface{}{}
+	m := map[string]interface{}{}
+
+	for {
+		f.skipSpaces()
+		if f.pos == len(f.s) {
+			return nil, fmt.Errorf("unterminated flow collection")
+		}
+		if f.s[f.pos] == end {
+			f.pos++
+			if end == ']' {
+				return s, nil
+			}
+			return m, nil
+		}
+
+		v, err := f.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		f.skipSpaces()
+		if end == '}' {
+			if f.pos == len(f.s) || f.s[f.pos] != ':' {
+				return nil, fmt.Errorf("expected ':' in flow mapping")
+			}
+			f.pos++
+
+			key := fmt.Sprint(v)
+			if key == "<nil>" {
+				key = ""
+			}
+			if m[key], err = f.parse(); err != nil {
+				return nil, err
+			}
+			f.skipSpaces()
+		} else {
+			s = append(s, v)
+		}
+
+		if f.pos < len(f.s) && f.s[f.pos] == ',' {
+			f.pos++
+		} else if f.pos == len(f.s) || f.s[f.pos] != end {
+			return nil, fmt.Errorf("expected ',' or '%c' in flow collection", end)
+		}
+	}
+}
+
+// encodeYAML encodes the configuration as YAML, keys are sorted.
+func encodeYAML(data JSON) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeYAMLMapping(&buf, data, 0, false); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeYAMLMapping writes the keys indented by indent, inline writes the first key
+// on the current line (after a sequence dash).
+func writeYAMLMapping(buf *bytes.Buffer, m map[string]interface{}, indent int, inline bool) error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for n, key := range keys {
+		if n > 0 || !inline {
+			buf.WriteString(strings.Repeat(" ", indent))
+		}
+		buf.WriteString(yamlString(key))
+		buf.WriteByte(':')
+
+		if err := writeYAMLValue(buf, m[key], indent); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// writeYAMLValue writes the value after a key or a sequence dash, with the new line.
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) error {
+	switch v := v.(type) {
+	case JSON:
+		return writeYAMLValue(buf, map[string]interface{}(v), indent)
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" {}\n")
+			return nil
+		}
+		buf.WriteByte('\n')
+		return writeYAMLMapping(buf, v, indent+2, false)
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" []\n")
+			return nil
+		}
+		buf.WriteByte('\n')
+		for _, item := range v {
+			buf.WriteString(strings.Repeat(" ", indent))
+			buf.WriteByte('-')
+
+			// A mapping item starts on the dash line.
+			if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+				buf.WriteByte(' ')
+				if err := writeYAMLMapping(buf, m, indent+2, true); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writeYAMLValue(buf, item, indent+2); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, err := yamlScalar(v)
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(s)
+	buf.WriteByte('\n')
+	return nil
+}
+
+func yamlScalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return yamlString(v), nil
+	}
+
+	f, err := toFloat(v)
+	if err != nil {
+		return "", fmt.Errorf("unsupported type %T", v)
+	}
+	switch {
+	case math.IsNaN(f):
+		return ".nan", nil
+	case math.IsInf(f, 1):
+		return ".inf", nil
+	case math.IsInf(f, -1):
+		return "-.inf", nil
+	}
+	return formatConfigFloat(f), nil
+}
+
+// yamlString returns s as a plain scalar when it's read back as the same string,
+// otherwise as a double quoted string.
+func yamlString(s string) string {
+	plain := s != "" && s == strings.TrimSpace(s) && utf8.ValidString(s) &&
+		resolveYAMLPlain(s) == interface{}(s) && !strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.HasSuffix(s, ":")
+
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			plain = false
+		}
+	}
+
+	if plain {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// formatConfigFloat formats the numbers without exponent when possible, 8080 not 8.08e+03.
+func formatConfigFloat(f float64) string {
+	if math.Abs(f) < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -5,11 +5,15 @@
 package framework
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"time"
 
 	"io/ioutil"
 
@@ -18,6 +22,8 @@ import (
 
 type (
 	// Context wraps Request and Response. It also provides methods for handling responses.
+	// Context implements context.Context using the request context, values added
+	// with AddShared are available through Value.
 	Context struct {
 		Request  *Request
 		Response ResponseWriter
@@ -29,6 +35,20 @@ type (
 		Shared   map[string]interface{}
 
 		Data map[string]interface{}
+
+		// afterFuncs are called when the request has been served.
+		afterFuncs []HandlerFunc
+		// static is true when the request has been served from the static directory.
+		static bool
+		// route is the pattern of the matched route.
+		route string
+		// cancel releases the request timeout set by SetTimeout.
+		cancel context.CancelFunc
+		// detachMu guards detached and the changes of the request by the spans,
+		// a timed out handler may still be running (see executeWithTimeout).
+		detachMu sync.Mutex
+		// detached is true when a timed out handler still owns the context.
+		detached bool
 	}
 )
 
@@ -45,10 +65,45 @@ func NewContext(w ResponseWriter, r *Request) *Context {
 }
 
 // Reset the context information.
+// Every field is cleared, maps are emptied and reused: the Context and its maps
+// must not be retained by a handler after it returns.
 func (c *Context) Reset() {
-	c.Data = make(map[string]interface{})
-	c.Params = make(map[string]string)
-	c.meta = make(map[string]string)
+	c.Request = nil
+	c.Response = nil
+	c.Router = nil
+	c.Session = nil
+	c.I18n = nil
+	c.afterFuncs = c.afterFuncs[:0]
+	c.static = false
+	c.route = ""
+	c.cancel = nil
+	c.detached = false
+
+	for k := range c.Data {
+		delete(c.Data, k)
+	}
+	for k := range c.Params {
+		delete(c.Params, k)
+	}
+	for k := range c.meta {
+		delete(c.meta, k)
+	}
+	for k := range c.Shared {
+		delete(c.Shared, k)
+	}
+}
+
+// After registers a function called when the request has been served,
+// after all the handlers returned (f.e. to log the response).
+func (c *Context) After(fn HandlerFunc) {
+	c.afterFuncs = append(c.afterFuncs, fn)
+}
+
+// callAfter calls the functions registered with After, last registered first.
+func (c *Context) callAfter() {
+	for i := len(c.afterFuncs) - 1; i >= 0; i-- {
+		c.afterFuncs[i](c)
+	}
 }
 
 // Header sets or deletes the response headers.
@@ -95,7 +150,9 @@ func (c *Context) Render(name string) {
 		}
 	}
 
-	_ = App.View.Render(c.Response, name, c.Data)
+	span := c.startSpan("render " + name)
+	span.SetError(App.View.Render(c.Response, name, c.Data))
+	c.endSpan(span)
 }
 
 // Meta sets or deletes the meta tags.
@@ -159,6 +216,11 @@ func (c *Context) Error(code int, err error) {
 	if code == http.StatusInternalServerError {
 		Log.Critical(fmt.Sprintf("%v", err))
 		debug.PrintStack()
+
+		if Profile().DebugErrors {
+			c.debugError(code, err, debug.Stack())
+			return
+		}
 	} else {
 		Log.Error(err)
 	}
@@ -166,6 +228,40 @@ func (c *Context) Error(code int, err error) {
 	c.Plain(code, err.Error())
 }
 
+// debugError responds with the error page showing err and the stack trace, see ModeProfile.DebugErrors.
+func (c *Context) debugError(code int, err interface{}, stack []byte) {
+	c.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response.WriteHeader(code)
+	_, _ = fmt.Fprintf(c.Response, debugErrorPage,
+		code, http.StatusText(code),
+		template.HTMLEscapeString(fmt.Sprint(err)),
+		template.HTMLEscapeString(c.Request.Method), template.HTMLEscapeString(c.Request.URL.String()),
+		template.HTMLEscapeString(string(stack)))
+}
+
+const debugErrorPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>%d %s</title></head>
+<body style="font-family: sans-serif">
+<h1>%s</h1>
+<p>%s %s</p>
+<pre style="background: #f4f4f4; padding: 1em; overflow: auto">%s</pre>
+</body>
+</html>
+`
+
+// Log returns the framework Logger bound to the request, messages include the request ID.
+func (c *Context) Log() *Logger {
+	return Log.WithContext(c)
+}
+
+// NewEmail returns a new Email bound to the request, the request ID is sent as X-Request-ID header.
+func (c *Context) NewEmail() *Email {
+	m := NewEmail()
+	m.WithContext(c)
+	return m
+}
+
 // AddShared append value to context shared values
 func (c *Context) AddShared(key string, value interface{}) {
 	c.Shared[key] = value
@@ -176,4 +272,55 @@ func (c *Context) GetShared(key string) interface{} {
 	return c.Shared[key]
 }
 
+// SetTimeout sets a deadline on the request context.
+// Handlers executed after SetTimeout are interrupted with a 503 response when the deadline expires,
+// and downstream work using the Context (or Request.Context()) is cancelled.
+func (c *Context) SetTimeout(d time.Duration) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+	if c.cancel != nil {
+		parent := c.cancel
+		c.cancel = func() {
+			cancel()
+			parent()
+		}
+	} else {
+		c.cancel = cancel
+	}
+	c.Request.Request = c.Request.WithContext(ctx)
+}
+
+// Deadline returns the request deadline, see context.Context.
+func (c *Context) Deadline() (time.Time, bool) {
+	return c.requestContext().Deadline()
+}
+
+// Done returns a channel closed when the client goes away or the request times out.
+func (c *Context) Done() <-chan struct{} {
+	return c.requestContext().Done()
+}
+
+// Err returns the reason why Done was closed.
+func (c *Context) Err() error {
+	return c.requestContext().Err()
+}
+
+// Value returns the shared value for a string key added via AddShared,
+// otherwise the value associated to key in the request context.
+func (c *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if v, ok := c.Shared[k]; ok {
+			return v
+		}
+	}
+	return c.requestContext().Value(key)
+}
+
+// requestContext returns the request context.
+func (c *Context) requestContext() context.Context {
+	if c.Request == nil || c.Request.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
+
 // ParseUploads
@@ -0,0 +1,201 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrPathTraversal is returned when a path tries to escape its root directory.
+var ErrPathTraversal = errors.New("invalid path: traversal detected")
+
+// File serves the file inline, the browser displays it when possible.
+// Range and conditional requests (If-Modified-Since, If-None-Match) are handled by http.ServeContent.
+// Paths containing ".." elements are rejected, use FileFromDir when the name comes from user input.
+func (c *Context) File(path string) error {
+	return c.serveFile(path, "inline", "")
+}
+
+// FileFromDir serves the file name, relative to root, inline.
+// name is usually user input: it returns ErrPathTraversal if it resolves outside root.
+func (c *Context) FileFromDir(root, name string) error {
+	path, err := SafePath(root, name)
+	if err != nil {
+		c.Error(http.StatusBadRequest, fmt.Errorf("400 invalid path"))
+		return err
+	}
+
+	return c.serveFile(path, "inline", "")
+}
+
+// Attachment serves the file as a download using filename as the suggested name.
+// If filename is empty the base name of path is used.
+func (c *Context) Attachment(path, filename string) error {
+	return c.serveFile(path, "attachment", filename)
+}
+
+// Stream copies r to the response with the given content type.
+// The response is flushed when the copy ends, r is not closed.
+func (c *Context) Stream(contentType string, r io.Reader) error {
+	c.Header("Content-Type", contentType)
+	c.Response.WriteHeader(http.StatusOK)
+
+	_, err := io.Copy(c.Response, r)
+	if f, ok := c.Response.(http.Flusher); ok {
+		f.Flush()
+	}
+	return err
+}
+
+// Blob sends b with the given status code and content type.
+func (c *Context) Blob(code int, contentType string, b []byte) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.Itoa(len(b)))
+	c.Response.WriteHeader(code)
+	_, _ = c.Response.Write(b)
+}
+
+// serveFile opens path and serves it with the provided Content-Disposition type.
+func (c *Context) serveFile(path, disposition, filename string) error {
+	if containsDotDot(path) {
+		c.Error(http.StatusBadRequest, fmt.Errorf("400 invalid path"))
+		return ErrPathTraversal
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			c.Error(http.StatusNotFound, fmt.Errorf("404 file not found"))
+		case os.IsPermission(err):
+			c.Error(http.StatusForbidden, fmt.Errorf("403 forbidden"))
+		default:
+			c.Error(http.StatusInternalServerError, err)
+		}
+		return err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		c.Error(http.StatusInternalServerError, err)
+		return err
+	}
+
+	// We don't provide directory listing
+	if fileInfo.IsDir() {
+		c.Error(http.StatusNotFound, fmt.Errorf("404 file not found"))
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	if filename == "" {
+		filename = filepath.Base(path)
+	}
+
+	c.Header("Content-Disposition", ContentDisposition(disposition, filename))
+	http.ServeContent(c.Response, c.Request.Request, filename, fileInfo.ModTime(), file)
+	return nil
+}
+
+// SafePath joins name to root and returns the resulting path.
+// It returns ErrPathTraversal if name is absolute, contains ".." elements
+// or resolves outside root through a symbolic link.
+func SafePath(root, name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, 0) || filepath.IsAbs(name) || containsDotDot(name) {
+		return "", ErrPathTraversal
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(root, filepath.FromSlash(name))
+
+	// Resolve symbolic links, a missing file is left to the caller.
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return path, nil
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path, nil
+	}
+
+	rel, err := filepath.Rel(realRoot, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrPathTraversal
+	}
+
+	return path, nil
+}
+
+// containsDotDot reports whether v contains a ".." path element.
+func containsDotDot(v string) bool {
+	if !strings.Contains(v, "..") {
+		return false
+	}
+
+	for _, element := range strings.FieldsFunc(v, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContentDisposition returns an RFC 6266 Content-Disposition header value.
+// An ASCII fallback is sent as filename and the UTF-8 name as filename* (RFC 5987).
+func ContentDisposition(disposition, filename string) string {
+	ascii := make([]byte, 0, len(filename))
+	encoded := make([]byte, 0, len(filename))
+	plain := true
+
+	for i := 0; i < len(filename); i++ {
+		b := filename[i]
+
+		switch {
+		case b >= 0x80:
+			plain = false
+			if b >= 0xC0 {
+				ascii = append(ascii, '_')
+			}
+		case b < 0x20 || b == 0x7F || b == '"' || b == '\\':
+			plain = false
+			ascii = append(ascii, '_')
+		default:
+			ascii = append(ascii, b)
+		}
+
+		if isAttrChar(b) {
+			encoded = append(encoded, b)
+		} else {
+			encoded = append(encoded, '%', "0123456789ABCDEF"[b>>4], "0123456789ABCDEF"[b&15])
+		}
+	}
+
+	if plain {
+		return fmt.Sprintf(`%s; filename="%s"`, disposition, ascii)
+	}
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, ascii, encoded)
+}
+
+// isAttrChar reports whether b can be sent without encoding in an RFC 5987 ext-value.
+func isAttrChar(b byte) bool {
+	if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' {
+		return true
+	}
+
+	return strings.IndexByte("!#$&+-.^_`|~", b) != -1
+}
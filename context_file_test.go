@@ -0,0 +1,127 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition string
+		filename    string
+		want        string
+	}{
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", `a"b.txt`, `inline; filename="a_b.txt"; filename*=UTF-8''a%22b.txt`},
+		{"attachment", "résumé 2017.pdf", `attachment; filename="r_sum_ 2017.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%202017.pdf`},
+	}
+
+	for _, tt := range tests {
+		if got := ContentDisposition(tt.disposition, tt.filename); got != tt.want {
+			t.Errorf("ContentDisposition(%q, %q) = %s, want %s", tt.disposition, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "framework")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "report.txt")
+	if err = ioutil.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	w := httptest.NewRecorder()
+	c := NewContext(NewResponseWriter(w), &Request{Request: r})
+
+	if err = c.Attachment(path, "relatório.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Fatalf("Range request returned %d %q", w.Code, w.Body.String())
+	}
+
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") || !strings.Contains(cd, "filename*=UTF-8''relat%C3%B3rio.txt") {
+		t.Fatalf("unexpected Content-Disposition %s", cd)
+	}
+
+	// Traversal
+	w = httptest.NewRecorder()
+	c = NewContext(NewResponseWriter(w), &Request{Request: r})
+
+	if err = c.File(dir + "/../" + filepath.Base(dir) + "/report.txt"); err != ErrPathTraversal {
+		t.Fatalf("File() traversal error = %v", err)
+	}
+
+	if err = c.FileFromDir(dir, "../etc/passwd"); err != ErrPathTraversal {
+		t.Fatalf("FileFromDir() traversal error = %v", err)
+	}
+
+	if _, err = SafePath(dir, "report.txt"); err != nil {
+		t.Fatalf("SafePath() error = %v", err)
+	}
+}
+
+func TestBlobAndStream(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	c := NewContext(NewResponseWriter(w), &Request{Request: r})
+
+	c.Blob(http.StatusCreated, "application/octet-stream", []byte("blob"))
+	if w.Code != http.StatusCreated || w.Body.String() != "blob" || w.Header().Get("Content-Length") != "4" {
+		t.Fatalf("Blob() returned %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	c = NewContext(NewResponseWriter(w), &Request{Request: r})
+
+	if err := c.Stream("text/csv", strings.NewReader("a,b\n")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Content-Type") != "text/csv" || w.Body.String() != "a,b\n" || !w.Flushed {
+		t.Fatalf("Stream() returned %q", w.Body.String())
+	}
+
+	// A ResponseWriter implemented by the application, without Flush nor Size.
+	w = httptest.NewRecorder()
+	c = NewContext(&plainResponseWriter{NewResponseWriter(w)}, &Request{Request: r})
+
+	if err := c.Stream("text/csv", strings.NewReader("a,b\n")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != "a,b\n" || w.Flushed || responseSize(c.Response) != 0 {
+		t.Fatalf("Stream() returned %q", w.Body.String())
+	}
+}
+
+// plainResponseWriter hides the optional interfaces of the wrapped ResponseWriter.
+type plainResponseWriter struct {
+	rw ResponseWriter
+}
+
+func (p *plainResponseWriter) Header() http.Header         { return p.rw.Header() }
+func (p *plainResponseWriter) Write(b []byte) (int, error) { return p.rw.Write(b) }
+func (p *plainResponseWriter) WriteHeader(code int)        { p.rw.WriteHeader(code) }
+func (p *plainResponseWriter) Before(before BeforeFunc)    { p.rw.Before(before) }
+func (p *plainResponseWriter) Status() int                 { return p.rw.Status() }
+func (p *plainResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return p.rw.Hijack()
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrCookieKeys is returned when cookie_keys is missing from the configuration.
+	ErrCookieKeys = errors.New("cookie: no cookie_keys configured")
+	// ErrCookieSignature is returned when a signed cookie fails verification.
+	ErrCookieSignature = errors.New("cookie: invalid signature")
+	// ErrCookieDecrypt is returned when an encrypted cookie can not be decrypted.
+	ErrCookieDecrypt = errors.New("cookie: unable to decrypt value")
+)
+
+// cookieKeys returns the configured cookie keys.
+// The first key is used to sign and encrypt, the others are only accepted
+// while verifying to allow key rotation.
+func cookieKeys() ([][]byte, error) {
+	var keys [][]byte
+
+	for _, key := range toStrings(Config.Get("cookie_keys")) {
+		keys = append(keys, []byte(key))
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrCookieKeys
+	}
+
+	return keys, nil
+}
+
+// cookieSameSite converts the cookie_same_site config value.
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(Config.String("cookie_same_site")) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+
+	return http.SameSiteDefaultMode
+}
+
+// NewCookie returns a cookie with Path, Domain, Secure, HttpOnly and SameSite
+// initialized from the configuration.
+//
+// maxAge follows the http.Cookie convention: 0 creates a session cookie,
+// a negative value deletes the cookie.
+func NewCookie(name, value string, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     Config.String("cookie_path"),
+		Domain:   Config.String("cookie_domain"),
+		Secure:   Config.Bool("cookie_secure"),
+		HttpOnly: Config.Bool("cookie_http_only"),
+		SameSite: cookieSameSite(),
+		MaxAge:   maxAge,
+	}
+
+	if maxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	} else if maxAge < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	}
+
+	return cookie
+}
+
+// SetCookie adds a Set-Cookie header to the response.
+// The value is URL encoded.
+func (c *Context) SetCookie(name, value string, maxAge int) {
+	http.SetCookie(c.Response, NewCookie(name, url.QueryEscape(value), maxAge))
+}
+
+// Cookie returns the URL decoded value of the named request cookie.
+// If the cookie is not found it returns http.ErrNoCookie.
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	return url.QueryUnescape(cookie.Value)
+}
+
+// DeleteCookie expires the named cookie on the client.
+func (c *Context) DeleteCookie(name string) {
+	http.SetCookie(c.Response, NewCookie(name, "", -1))
+}
+
+// SetSignedCookie adds a cookie signed with HMAC-SHA256.
+// The value is readable by the client but can not be modified.
+func (c *Context) SetSignedCookie(name, value string, maxAge int) error {
+	keys, err := cookieKeys()
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	mac := signCookie(keys[0], name, encoded)
+
+	http.SetCookie(c.Response, NewCookie(name, encoded+"."+mac, maxAge))
+	return nil
+}
+
+// SignedCookie returns the value of a cookie set with SetSignedCookie.
+// The signature is checked against every configured key.
+func (c *Context) SignedCookie(name string) (string, error) {
+	keys, err := cookieKeys()
+	if err != nil {
+		return "", err
+	}
+
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	i := strings.LastIndex(cookie.Value, ".")
+	if i == -1 {
+		return "", ErrCookieSignature
+	}
+
+	encoded, mac := cookie.Value[:i], cookie.Value[i+1:]
+
+	for _, key := range keys {
+		if hmac.Equal([]byte(mac), []byte(signCookie(key, name, encoded))) {
+			value, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err != nil {
+				return "", ErrCookieSignature
+			}
+			return string(value), nil
+		}
+	}
+
+	return "", ErrCookieSignature
+}
+
+// SetEncryptedCookie adds a cookie encrypted and authenticated with AES-GCM.
+// The value can not be read or modified by the client.
+func (c *Context) SetEncryptedCookie(name, value string, maxAge int) error {
+	keys, err := cookieKeys()
+	if err != nil {
+		return err
+	}
+
+	aead, err := cookieAEAD(keys[0])
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	http.SetCookie(c.Response, NewCookie(name, base64.RawURLEncoding.EncodeToString(sealed), maxAge))
+	return nil
+}
+
+// EncryptedCookie returns the value of a cookie set with SetEncryptedCookie.
+// Decryption is attempted with every configured key.
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	keys, err := cookieKeys()
+	if err != nil {
+		return "", err
+	}
+
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return "", ErrCookieDecrypt
+	}
+
+	for _, key := range keys {
+		aead, err := cookieAEAD(key)
+		if err != nil {
+			return "", err
+		}
+
+		if len(sealed) < aead.NonceSize() {
+			return "", ErrCookieDecrypt
+		}
+
+		value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+		if err == nil {
+			return string(value), nil
+		}
+	}
+
+	return "", ErrCookieDecrypt
+}
+
+// signCookie returns the base64 HMAC-SHA256 of the cookie name and value.
+// The name is included so a signed value can not be moved to another cookie.
+func signCookie(key []byte, name, value string) string {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte("|"))
+	_, _ = h.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// cookieAEAD derives an AES-256 key from the configured key and returns an AES-GCM cipher.
+// A different key is derived so signing and encryption never share the same secret.
+func cookieAEAD(key []byte) (cipher.AEAD, error) {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte("framework cookie encryption"))
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// cookieRoundTrip calls set on a new context and returns a context whose request
+// carries the cookies written by set.
+func cookieRoundTrip(set func(c *Context)) *Context {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	set(NewContext(NewResponseWriter(w), &Request{Request: r}))
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	return NewContext(NewResponseWriter(httptest.NewRecorder()), &Request{Request: r})
+}
+
+func TestCookie(t *testing.T) {
+	c := cookieRoundTrip(func(c *Context) {
+		c.SetCookie("plain", "hello world; =", 60)
+	})
+
+	value, err := c.Cookie("plain")
+	if err != nil || value != "hello world; =" {
+		t.Fatalf("Cookie() = %q, %v", value, err)
+	}
+
+	if _, err = c.Cookie("missing"); err != http.ErrNoCookie {
+		t.Fatalf("Cookie() missing error = %v", err)
+	}
+}
+
+func TestNewCookieDefaults(t *testing.T) {
+	cookie := NewCookie("name", "value", 0)
+
+	if cookie.Path != "/" || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected defaults: %+v", cookie)
+	}
+}
+
+func TestSignedCookie(t *testing.T) {
+	Config.Set("cookie_keys", []interface{}{"old-key"})
+
+	c := cookieRoundTrip(func(c *Context) {
+		if err := c.SetSignedCookie("signed", "user:1", 60); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Rotate keys, the old key must still be accepted.
+	Config.Set("cookie_keys", []interface{}{"new-key", "old-key"})
+
+	value, err := c.SignedCookie("signed")
+	if err != nil || value != "user:1" {
+		t.Fatalf("SignedCookie() = %q, %v", value, err)
+	}
+
+	// Drop the old key.
+	Config.Set("cookie_keys", []interface{}{"new-key"})
+
+	if _, err = c.SignedCookie("signed"); err != ErrCookieSignature {
+		t.Fatalf("SignedCookie() with removed key error = %v", err)
+	}
+
+	// Tampered value.
+	c = cookieRoundTrip(func(c *Context) {
+		_ = c.SetSignedCookie("signed", "user:1", 60)
+	})
+	cookie, _ := c.Request.Cookie("signed")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "signed", Value: "dXNlcjoy" + cookie.Value[8:]})
+	c.Request = &Request{Request: r}
+
+	if _, err = c.SignedCookie("signed"); err != ErrCookieSignature {
+		t.Fatalf("SignedCookie() tampered error = %v", err)
+	}
+}
+
+func TestEncryptedCookie(t *testing.T) {
+	Config.Set("cookie_keys", "old-key")
+
+	c := cookieRoundTrip(func(c *Context) {
+		if err := c.SetEncryptedCookie("secret", "user:1", 60); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	cookie, _ := c.Request.Cookie("secret")
+	if cookie.Value == "user:1" {
+		t.Fatal("EncryptedCookie value is not encrypted")
+	}
+
+	Config.Set("cookie_keys", []string{"new-key", "old-key"})
+
+	value, err := c.EncryptedCookie("secret")
+	if err != nil || value != "user:1" {
+		t.Fatalf("EncryptedCookie() = %q, %v", value, err)
+	}
+
+	Config.Set("cookie_keys", []string{"new-key"})
+
+	if _, err = c.EncryptedCookie("secret"); err != ErrCookieDecrypt {
+		t.Fatalf("EncryptedCookie() with removed key error = %v", err)
+	}
+
+	Config.Set("cookie_keys", nil)
+
+	if err = c.SetEncryptedCookie("secret", "value", 0); err != ErrCookieKeys {
+		t.Fatalf("SetEncryptedCookie() without keys error = %v", err)
+	}
+}
@@ -6,6 +6,7 @@ package framework
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
@@ -35,6 +36,7 @@ type (
 	// Email struct contains the email parameters.
 	Email struct {
 		engine *Engine
+		ctx    context.Context
 
 		fromEmail   string
 		fromName    string
@@ -102,6 +104,11 @@ func (m *Email) Bcc(emails ...string) {
 	// }
 }
 
+// WithContext binds the email to ctx, the request ID found in ctx is sent as X-Request-ID header.
+func (m *Email) WithContext(ctx context.Context) {
+	m.ctx = ctx
+}
+
 // Subject sets the email subject.
 func (m *Email) Subject(subject string) {
 	m.subject = subject
@@ -122,6 +129,24 @@ func (m *Email) Attach(filename, path string) {
 
 // Send attempts to send the built email.
 func (m *Email) Send() error {
+	_, span := Tracing.Start(m.ctx, "smtp send", SpanKindClient)
+	span.SetAttribute("smtp.server", Config.String("smtp_server"))
+	span.SetAttribute("smtp.recipients", len(m.to)+len(m.bcc))
+
+	err := m.send()
+	span.SetError(err)
+	span.End()
+
+	if err != nil {
+		emailSent.Inc("error")
+	} else {
+		emailSent.Inc("success")
+	}
+	return err
+}
+
+// send builds the message and sends it with the configured SMTP server.
+func (m *Email) send() error {
 	var buf bytes.Buffer
 	var err error
 	var alternative *multipart.Writer
@@ -142,6 +167,10 @@ func (m *Email) Send() error {
 
 	fmt.Fprintf(&buf, "Subject: %s\r\n", m.subject)
 
+	if id := RequestIDFromContext(m.ctx); id != "" {
+		fmt.Fprintf(&buf, "%s: %s\r\n", HeaderRequestID, id)
+	}
+
 	for _, to := range m.to {
 		fmt.Fprintf(&buf, "To: %s\r\n", to)
 	}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/kardianos/osext"
 
@@ -40,6 +41,7 @@ type (
 	// Engine is the framework struct.
 	Engine struct {
 		cache       cache.Cache
+		cacheLoader *cache.Loader
 		Controllers []Controller
 		pool        *ContextPool
 		Router      Router
@@ -54,40 +56,53 @@ type (
 		staticDir   string
 		sharedData  map[string]string
 		middlewares []HandlerFunc
+
+		health       healthChecks
+		probes       map[string]HandlerFunc
+		servers      []*http.Server
+		serversMu    sync.Mutex
+		shuttingDown int32
+		done         chan struct{}
 	}
 
 	// ContextPool contains the framework Context pool.
 	ContextPool struct {
-		c chan *Context
+		pool sync.Pool
 	}
 )
 
 // NewContextPool create a new pool.
 func NewContextPool() *ContextPool {
-	return &ContextPool{
-		c: make(chan *Context),
+	cp := &ContextPool{}
+	cp.pool.New = func() interface{} {
+		return NewContext(nil, nil)
 	}
+	return cp
 }
 
 // Get a context from the pool.
-func (cp *ContextPool) Get(rw ResponseWriter, req *Request) (c *Context) {
-	select {
-	case c = <-cp.c:
-	// reuse existing context
-	default:
-		// create new context
-		c = NewContext(rw, req)
-	}
-	return
+func (cp *ContextPool) Get(rw ResponseWriter, req *Request) *Context {
+	c := cp.pool.Get().(*Context)
+	c.Response = rw
+	c.Request = req
+	return c
 }
 
 // Put a context inside the pool.
+// The context is reset and must not be used after Put.
 func (cp *ContextPool) Put(c *Context) {
-	c.Reset()
-	select {
-	case cp.c <- c:
-	default: // Discard the buffer if the pool is full.
+	// Release the request timeout
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	// A timed out handler may still use the context, leave it to the GC.
+	if c.detached {
+		return
 	}
+
+	c.Reset()
+	cp.pool.Put(c)
 }
 
 // Use appends a new global middleware.
@@ -98,7 +113,7 @@ func Use(filter HandlerFunc) {
 
 // New initialize the engine and return an Engine struct.
 func New() *Engine {
-	engine := &Engine{}
+	engine := &Engine{done: make(chan struct{})}
 
 	Log = NewLogger(os.Stdout)
 
@@ -121,12 +136,19 @@ func New() *Engine {
 	}
 
 	if flag.Lookup("test.v") != nil {
-		SetMode("test")
+		_ = SetMode(TestMode)
 		engine.Path = engine.Path + "../example"
 	}
 
 	// Load configuration file.
-	Config = LoadConfig(engine.Path + "config/app.json")
+	Config = LoadConfig(FindConfigFile(engine.Path + "config"))
+
+	// The mode set in the configuration, f.e. by APP_MODE, selects the mode profile.
+	// The modes registered by the application after the package init are set by Init.
+	if mode := configMode(Config); mode != "" && Mode() != TestMode {
+		_ = SetMode(mode)
+	}
+	configureLogger(Log, Config)
 
 	return engine
 }
@@ -135,6 +157,23 @@ func New() *Engine {
 func (engine *Engine) Init() {
 	var err error
 
+	if err = configureMode(); err != nil {
+		Log.Fatal(err)
+	}
+
+	// Fail fast on invalid or unknown keys.
+	if err = Config.Validate(); err != nil {
+		Log.Fatal(err)
+	}
+	if config, ok := Config.(*ConfigData); ok {
+		for _, key := range config.UnknownEnv() {
+			Log.Warning(fmt.Sprintf("unknown key %s (%s), ignored", key, config.Source(key)))
+		}
+	}
+
+	// Reload on SIGHUP and on file changes.
+	engine.watchConfig()
+
 	// Parse views from views directory.
 	engine.View, err = NewView(engine.Path + "views")
 	if err != nil {
@@ -148,7 +187,7 @@ func (engine *Engine) Init() {
 	}
 
 	// Fancy banner and information about running application
-	if Mode() == DebugMode {
+	if Profile().Banner {
 		Log.Info(fmt.Sprintf("%s", strings.Repeat("=", 80)))
 		Log.Info(fmt.Sprintf("%-15s: v%s", "Framework", VERSION))
 		Log.Info(fmt.Sprintf("%s", strings.Repeat("=", 80)))
@@ -162,9 +201,64 @@ func (engine *Engine) Init() {
 		Log.Info(fmt.Sprintf("%s", strings.Repeat("=", 80)))
 	}
 
+	// Proxies allowed to set the client IP, scheme and host.
+	if err = SetTrustedProxies(Config.StringSlice("trusted_proxies")...); err != nil {
+		Log.Error(err)
+	}
+
+	// Access log is the first middleware, to measure the whole request.
+	if format := Config.String("access_log"); format != "" {
+		filter := AccessLog(AccessLogConfig{
+			Format:    format,
+			SkipPaths: Config.StringSlice("access_log_skip"),
+		})
+		engine.middlewares = append([]HandlerFunc{filter}, engine.middlewares...)
+	}
+
+	// Metrics on a route or on a dedicated address.
+	if addr := Config.String("metrics"); addr != "" {
+		engine.middlewares = append([]HandlerFunc{HTTPMetrics()}, engine.middlewares...)
+		engine.grpcUnaryInterceptors = append([]grpc.UnaryServerInterceptor{MetricsUnaryInterceptor()}, engine.grpcUnaryInterceptors...)
+		engine.grpcStreamInterceptors = append([]grpc.StreamServerInterceptor{MetricsStreamInterceptor()}, engine.grpcStreamInterceptors...)
+
+		if strings.HasPrefix(addr, "/") {
+			engine.Router.Add(addr, "GET", func(c *Context) {
+				Metrics.ServeHTTP(c.Response, c.Request.Request)
+			})
+		} else {
+			go func() {
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", Metrics)
+				Log.Info(fmt.Sprintf("metrics enabled and listening on %s", addr))
+				Log.Error(http.ListenAndServe(addr, mux))
+			}()
+		}
+	}
+
+	// Tracing exporter
+	if exporter := Config.String("trace_exporter"); exporter != "" {
+		switch exporter {
+		case "stdout":
+			Tracing.SetExporter(NewStdoutExporter(os.Stdout))
+		case "otlp":
+			Tracing.SetExporter(&OTLPExporter{Endpoint: Config.String("trace_endpoint"), ServiceName: Config.String("name")})
+		default:
+			Log.Error(fmt.Errorf("unknown trace exporter %s", exporter))
+		}
+
+		if Config.Get("trace_sample_ratio") != nil {
+			Tracing.SetSampleRatio(Config.Float("trace_sample_ratio"))
+		}
+
+		if Tracing.Enabled() {
+			engine.grpcUnaryInterceptors = append([]grpc.UnaryServerInterceptor{TracingUnaryInterceptor()}, engine.grpcUnaryInterceptors...)
+			engine.grpcStreamInterceptors = append([]grpc.StreamServerInterceptor{TracingStreamInterceptor()}, engine.grpcStreamInterceptors...)
+		}
+	}
+
 	// Check if caching is enabled: register and assign it to the framework instance
 	if Config.Get("cache") != nil {
-		if Config.String("mode") == DebugMode {
+		if Profile().Verbose {
 			Log.Debug(fmt.Sprintf("registering cache: %s", Config.String("cache")))
 		}
 
@@ -173,18 +267,42 @@ func (engine *Engine) Init() {
 			_ = cache.Register("file", cache.NewFileCache)
 		case "memory":
 			_ = cache.Register("memory", cache.NewMemoryCache)
+		case "redis":
+			_ = cache.Register("redis", cache.NewRedisCache)
+		case "tiered":
+			// The L2 adapter is chosen by cache_config.
+			_ = cache.Register("tiered", cache.NewTieredCache)
+			_ = cache.Register("file", cache.NewFileCache)
+			_ = cache.Register("memory", cache.NewMemoryCache)
+			_ = cache.Register("redis", cache.NewRedisCache)
 		}
 
 		engine.cache, err = cache.NewCache(Config.String("cache"), Config.String("cache_config"))
 		if err != nil {
 			Log.Error(err)
+		} else {
+			// f.e. the tiered write-behind errors and the corrupted files.
+			if c, ok := engine.cache.(interface {
+				OnError(func(key string, err error))
+			}); ok {
+				c.OnError(func(key string, err error) {
+					Log.Error(fmt.Errorf("cache %s: %v", key, err))
+				})
+			}
+			// The adapter Loader, shared with cache.GetOrLoad.
+			engine.cacheLoader = cache.LoaderOf(engine.cache)
+			engine.cacheLoader.Stale = Config.Duration("cache_stale")
+			engine.cacheLoader.Beta = Config.Float("cache_beta")
+			engine.cacheLoader.OnError = func(key string, err error) {
+				Log.Error(fmt.Errorf("cache load %s: %v", key, err))
+			}
 		}
 	}
 
 	// Load translations
 	_, err = os.Stat("i18n")
 	if err == nil {
-		if Config.String("mode") == DebugMode {
+		if Profile().Verbose {
 			Log.Debug("Importing I18N translations.")
 		}
 		if err := i18n.Load("i18n"); err != nil {
@@ -200,6 +318,9 @@ func (engine *Engine) Init() {
 		}
 	}
 
+	// Health checks and endpoints
+	engine.registerHealth()
+
 	// Enable pprof
 	if Config.Get("pprof") != nil {
 		go func() {
@@ -209,38 +330,79 @@ func (engine *Engine) Init() {
 	}
 }
 
+// configureMode sets the mode of the configuration or of FRAMEWORK_MODE, now that the
+// application modes are registered (see RegisterMode), and loads the configuration again
+// when it changes, with the files of the modes it extends.
+func configureMode() error {
+	mode := configMode(Config)
+	if mode == "" || mode == Mode() || Mode() == TestMode {
+		return nil
+	}
+	if err := SetMode(mode); err != nil {
+		return err
+	}
+
+	config, ok := Config.(*ConfigData)
+	if !ok {
+		return nil
+	}
+	if _, err := config.load(true); err != nil {
+		return err
+	}
+	configureLogger(Log, Config)
+	return nil
+}
+
 // Run start listening on configured HTTP port.
+// On SIGINT or SIGTERM the server is shut down gracefully, see Shutdown.
+// "./app config ..." runs the config subcommand instead, see ConfigLoader.Command.
 func Run() {
+	runCommand()
 	App.Init()
 
-	if Config.String("address") != "" {
-		Log.Info(fmt.Sprintf("listening on %s", Config.String("address")))
-		Log.Error(http.ListenAndServe(Config.String("address"), App.Router))
+	addr := Config.String("address")
+	if addr != "" {
+		Log.Info(fmt.Sprintf("listening on %s", addr))
 	} else {
-		Log.Info(fmt.Sprintf("listening on port :%d", Config.Int("port")))
-		Log.Error(http.ListenAndServe(fmt.Sprintf(":%d", Config.Int("port")), App.Router))
+		addr = fmt.Sprintf(":%d", Config.Int("port"))
+		Log.Info(fmt.Sprintf("listening on port %s", addr))
 	}
+
+	go App.handleSignals()
+
+	server := &http.Server{Addr: addr, Handler: App.Router}
+	App.serve(server, server.ListenAndServe)
 }
 
 // RunTLS start HTTPS listening on configured port.
+// On SIGINT or SIGTERM the server is shut down gracefully, see Shutdown.
 func RunTLS() {
+	runCommand()
 	App.Init()
 
 	if Config.String("cert") == "" || Config.String("cert_key") == "" {
 		panic("Invalid cert files or key. Please review your configuration.")
 	}
 
-	if Config.String("address") != "" {
-		Log.Info(fmt.Sprintf("listening TLS on %s", Config.String("address")))
-		Log.Error(http.ListenAndServeTLS(Config.String("address"), Config.String("cert"), Config.String("cert_key"), App.Router))
+	addr := Config.String("address")
+	if addr != "" {
+		Log.Info(fmt.Sprintf("listening TLS on %s", addr))
 	} else {
-		Log.Info(fmt.Sprintf("listening TLS on port :%d", Config.Int("port")))
-		Log.Error(http.ListenAndServeTLS(fmt.Sprintf(":%d", Config.Int("port")), Config.String("cert"), Config.String("cert_key"), App.Router))
+		addr = fmt.Sprintf(":%d", Config.Int("port"))
+		Log.Info(fmt.Sprintf("listening TLS on port %s", addr))
 	}
+
+	go App.handleSignals()
+
+	server := &http.Server{Addr: addr, Handler: App.Router}
+	App.serve(server, func() error {
+		return server.ListenAndServeTLS(Config.String("cert"), Config.String("cert_key"))
+	})
 }
 
 // RunGRPC start gRPC listening on configured port.
 func RunGRPC() {
+	runCommand()
 	App.Init()
 
 	Log.Info(fmt.Sprintf("listening gRPC on port :%d", Config.Int("grpc_port")))
@@ -284,7 +446,17 @@ func RunGRPC() {
 		}
 	}
 
-	Log.Error(App.GRPCServer.Serve(l))
+	go App.handleSignals()
+
+	if err := App.GRPCServer.Serve(l); err != nil {
+		Log.Error(err)
+		return
+	}
+
+	// Serve returns on GracefulStop, wait for the shutdown to complete.
+	if App.ShuttingDown() {
+		<-App.done
+	}
 }
 
 // Create a new framework instance on application init.
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestContextPoolReset(t *testing.T) {
+	pool := NewContextPool()
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	c := pool.Get(NewResponseWriter(httptest.NewRecorder()), &Request{Request: r})
+	c.AddShared("user", "1")
+	c.Data["title"] = "private"
+	c.Params["id"] = "1"
+	c.Meta("description", "private")
+	c.Session = &FileSessionProvider{}
+	pool.Put(c)
+
+	// Reset must clear every field, whether or not the same context is returned.
+	if c.Request != nil || c.Response != nil || c.Session != nil || c.I18n != nil {
+		t.Fatal("Reset() left request state on the context")
+	}
+	if len(c.Shared) != 0 || len(c.Data) != 0 || len(c.Params) != 0 || len(c.meta) != 0 {
+		t.Fatal("Reset() left values on the context")
+	}
+}
+
+func TestContextPoolConcurrent(t *testing.T) {
+	r := NewRouter()
+	r.Add("/user/:id", "GET", func(c *Context) {
+		if c.GetShared("user") != nil || len(c.Data) != 0 || c.Session != nil {
+			c.Plain(http.StatusInternalServerError, "leaked state")
+			return
+		}
+
+		id := c.Request.URL.Query().Get(":id")
+		c.AddShared("user", id)
+		c.Data["user"] = id
+
+		if c.GetShared("user") != id || c.Data["user"] != id {
+			c.Plain(http.StatusInternalServerError, "shared state")
+			return
+		}
+		c.Plain(http.StatusOK, id)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				id := fmt.Sprintf("%d-%d", i, j)
+				req, _ := http.NewRequest("GET", "/user/"+id, nil)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if w.Code != http.StatusOK || w.Body.String() != id {
+					t.Errorf("request %s returned %d %q", id, w.Code, w.Body.String())
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+var benchmarkContext *Context
+
+// BenchmarkNewContext allocates a Context per request, as done without pooling.
+func BenchmarkNewContext(b *testing.B) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	req := &Request{Request: r}
+	rw := NewResponseWriter(httptest.NewRecorder())
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := NewContext(rw, req)
+		c.AddShared("user", i)
+		benchmarkContext = c
+	}
+}
+
+// BenchmarkContextPool reuses contexts from the pool.
+func BenchmarkContextPool(b *testing.B) {
+	pool := NewContextPool()
+	r, _ := http.NewRequest("GET", "/", nil)
+	req := &Request{Request: r}
+	rw := NewResponseWriter(httptest.NewRecorder())
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := pool.Get(rw, req)
+		c.AddShared("user", i)
+		benchmarkContext = c
+		pool.Put(c)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	r := NewRouter()
+	r.Add("/", "GET", func(c *Context) {
+		c.Plain(http.StatusOK, "ok")
+	})
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"golang.org/x/net/context"
 
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type (
@@ -15,8 +16,11 @@ type (
 	GRPCServices interface{}
 
 	// GRPCServer is the structure that contains the gRPC server.
+	// The standard health service (grpc.health.v1.Health) is registered automatically.
 	GRPCServer struct {
 		*grpc.Server
+
+		health *grpcHealthServer
 	}
 
 	// GRPCService implements the gRPC Service.
@@ -26,7 +30,9 @@ type (
 
 // NewGRPC instantiates a new gRPC server.
 func NewGRPC(opt ...grpc.ServerOption) *GRPCServer {
-	return &GRPCServer{grpc.NewServer(opt...)}
+	s := &GRPCServer{Server: grpc.NewServer(opt...), health: newGRPCHealthServer()}
+	healthpb.RegisterHealthServer(s.Server, s.health)
+	return s
 }
 
 // RegisterGRPCService registers a new gRPC service.
@@ -0,0 +1,294 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default health endpoints, override them with the health_path and ready_path config keys.
+const (
+	DefaultHealthPath = "/healthz"
+	DefaultReadyPath  = "/readyz"
+)
+
+// ErrShuttingDown is reported by the readiness endpoint during the graceful shutdown.
+var ErrShuttingDown = errors.New("shutting down")
+
+type (
+	// HealthCheck returns an error when the checked dependency is not healthy.
+	// The context is cancelled after health_timeout seconds (5 by default).
+	HealthCheck func(ctx context.Context) error
+
+	// HealthResult contains the result of a single check.
+	HealthResult struct {
+		Status   string  `json:"status"`
+		Error    string  `json:"error,omitempty"`
+		Duration float64 `json:"duration_ms"`
+	}
+
+	// HealthReport is the aggregated result returned by the health endpoints.
+	HealthReport struct {
+		Status string                  `json:"status"`
+		Checks map[string]HealthResult `json:"checks"`
+	}
+
+	// healthChecks contains the registered checks.
+	healthChecks struct {
+		mu     sync.RWMutex
+		checks map[string]HealthCheck
+	}
+)
+
+// Health check statuses.
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// RegisterHealthCheck adds a check to the /readyz endpoint and to the gRPC health service.
+// A check registered with the same name replaces the previous one.
+//
+//	framework.RegisterHealthCheck("database", func(ctx context.Context) error {
+//		return db.PingContext(ctx)
+//	})
+func RegisterHealthCheck(name string, check HealthCheck) {
+	App.health.register(name, check)
+}
+
+func (hc *healthChecks) register(name string, check HealthCheck) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if hc.checks == nil {
+		hc.checks = make(map[string]HealthCheck)
+	}
+	hc.checks[name] = check
+}
+
+// run executes the checks concurrently and aggregates the results.
+func (hc *healthChecks) run(ctx context.Context) *HealthReport {
+	timeout := 5 * time.Second
+	if d := Config.Duration("health_timeout"); d > 0 {
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	hc.mu.RLock()
+	checks := make(map[string]HealthCheck, len(hc.checks))
+	for name, check := range hc.checks {
+		checks[name] = check
+	}
+	hc.mu.RUnlock()
+
+	report := &HealthReport{Status: HealthOK, Checks: make(map[string]HealthResult, len(checks))}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := runHealthCheck(ctx, check)
+			result := HealthResult{Status: HealthOK, Duration: float64(time.Since(start)) / float64(time.Millisecond)}
+			if err != nil {
+				result.Status = HealthFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = HealthFail
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+
+	wg.Wait()
+	return report
+}
+
+// runHealthCheck returns the check error, a timeout error if it doesn't return in time
+// or the panic as error.
+func runHealthCheck(ctx context.Context, check HealthCheck) (err error) {
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HealthHandler serves the liveness endpoint: 200 while the process serves requests.
+// The checks aren't run, a failing dependency must not restart the process, see ReadyHandler.
+func HealthHandler(c *Context) {
+	writeHealthReport(c, &HealthReport{Status: HealthOK, Checks: map[string]HealthResult{}})
+}
+
+// ReadyHandler serves the readiness endpoint: 200 when every check passes, 503 otherwise
+// and during the graceful shutdown.
+func ReadyHandler(c *Context) {
+	report := App.health.run(c)
+	if App.ShuttingDown() {
+		report.Status = HealthFail
+		report.Checks["shutdown"] = HealthResult{Status: HealthFail, Error: ErrShuttingDown.Error()}
+	}
+	writeHealthReport(c, report)
+}
+
+func writeHealthReport(c *Context, report *HealthReport) {
+	c.Header("Cache-Control", "no-store")
+
+	code := http.StatusOK
+	if report.Status != HealthOK {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
+
+// registerHealth adds the built-in checks and the health endpoints,
+// served before the global middlewares (see Routes.ServeHTTP).
+func (engine *Engine) registerHealth() {
+	if engine.cache != nil {
+		engine.health.register("cache", cacheHealthCheck)
+	}
+
+	engine.health.register("sessions", sessionsHealthCheck)
+
+	if Config.String("smtp_server") != "" {
+		engine.health.register("smtp", smtpHealthCheck)
+	}
+
+	views := engine.Path + "views"
+	if fi, err := os.Stat(views); err == nil && fi.IsDir() {
+		engine.health.register("views", func(ctx context.Context) error {
+			return dirHealthCheck(views)
+		})
+	}
+
+	healthPath, readyPath := Config.String("health_path"), Config.String("ready_path")
+	if healthPath == "" {
+		healthPath = DefaultHealthPath
+	}
+	if readyPath == "" {
+		readyPath = DefaultReadyPath
+	}
+
+	engine.probes = map[string]HandlerFunc{
+		healthPath: HealthHandler,
+		readyPath:  ReadyHandler,
+	}
+}
+
+// cacheHealthCheck writes, reads and deletes a probe value.
+func cacheHealthCheck(ctx context.Context) error {
+	c := App.cache
+	if c == nil {
+		return errors.New("cache not initialized")
+	}
+
+	key := "framework:health:" + NewRequestID()
+	if err := c.Put(key, "ok", time.Minute); err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.Delete(key)
+	}()
+
+	if v, _ := c.Get(key).(string); v != "ok" {
+		return errors.New("cache probe value not found")
+	}
+	return nil
+}
+
+// sessionsHealthCheck checks the session providers implementing HealthCheck(ctx) error.
+func sessionsHealthCheck(ctx context.Context) error {
+	var failed []string
+
+	for name, session := range sessionProviders {
+		if s, ok := session.(interface{ HealthCheck(context.Context) error }); ok {
+			if err := s.HealthCheck(ctx); err != nil {
+				failed = append(failed, name+": "+err.Error())
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// smtpHealthCheck connects to the SMTP server and reads its greeting.
+func smtpHealthCheck(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", Config.String("smtp_server"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "220") {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	_, _ = conn.Write([]byte("QUIT\r\n"))
+	return nil
+}
+
+// dirHealthCheck checks that dir is a readable directory.
+func dirHealthCheck(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpcHealthServer implements the standard gRPC health service.
+// The overall status ("" service) and the status of each registered check (by name)
+// are refreshed on Check and List, watchers are notified of the changes.
+type grpcHealthServer struct {
+	*health.Server
+}
+
+// newGRPCHealthServer returns the health service registered on GRPCServer.
+func newGRPCHealthServer() *grpcHealthServer {
+	return &grpcHealthServer{Server: health.NewServer()}
+}
+
+// Check runs the checks and returns the status of the requested service.
+func (s *grpcHealthServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.update(ctx)
+	return s.Server.Check(ctx, in)
+}
+
+// List runs the checks and returns the status of every service.
+func (s *grpcHealthServer) List(ctx context.Context, in *healthpb.HealthListRequest) (*healthpb.HealthListResponse, error) {
+	s.update(ctx)
+	return s.Server.List(ctx, in)
+}
+
+// update runs the health checks and sets the serving statuses.
+// After Shutdown every status is NOT_SERVING and updates are ignored.
+func (s *grpcHealthServer) update(ctx context.Context) {
+	if App.ShuttingDown() {
+		return
+	}
+
+	report := App.health.run(ctx)
+
+	for name, result := range report.Checks {
+		s.SetServingStatus(name, servingStatus(result.Status))
+	}
+	s.SetServingStatus("", servingStatus(report.Status))
+}
+
+func servingStatus(status string) healthpb.HealthCheckResponse_ServingStatus {
+	if status == HealthOK {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// withHealthChecks replaces the registered checks during a test.
+func withHealthChecks(checks map[string]HealthCheck) func() {
+	App.health.mu.Lock()
+	saved := App.health.checks
+	App.health.checks = nil
+	App.health.mu.Unlock()
+
+	for name, check := range checks {
+		RegisterHealthCheck(name, check)
+	}
+
+	return func() {
+		App.health.mu.Lock()
+		App.health.checks = saved
+		App.health.mu.Unlock()
+	}
+}
+
+func getHealth(t *testing.T, r Router, path string) (int, *HealthReport) {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := serveWithMiddlewares(r, req)
+
+	report := &HealthReport{}
+	if err := json.Unmarshal(w.Body.Bytes(), report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+	return w.Code, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	r := NewRouter()
+	r.Add("/healthz", "GET", HealthHandler)
+	r.Add("/readyz", "GET", ReadyHandler)
+
+	failing := errors.New("connection refused")
+	var fail int32
+
+	defer withHealthChecks(map[string]HealthCheck{
+		"database": func(ctx context.Context) error {
+			if atomic.LoadInt32(&fail) == 1 {
+				return failing
+			}
+			return nil
+		},
+		"queue": func(ctx context.Context) error {
+			return nil
+		},
+	})()
+
+	code, report := getHealth(t, r, "/readyz")
+	if code != http.StatusOK || report.Status != HealthOK || len(report.Checks) != 2 {
+		t.Fatalf("unexpected report %d %+v", code, report)
+	}
+
+	atomic.StoreInt32(&fail, 1)
+	code, report = getHealth(t, r, "/readyz")
+	if code != http.StatusServiceUnavailable || report.Status != HealthFail ||
+		report.Checks["database"].Error != failing.Error() || report.Checks["queue"].Status != HealthOK {
+		t.Fatalf("unexpected report %d %+v", code, report)
+	}
+
+	// Liveness checks only the process.
+	if code, report = getHealth(t, r, "/healthz"); code != http.StatusOK || len(report.Checks) != 0 {
+		t.Fatalf("unexpected liveness %d %+v", code, report)
+	}
+
+	// Readiness fails during the shutdown, liveness doesn't.
+	atomic.StoreInt32(&fail, 0)
+	atomic.StoreInt32(&App.shuttingDown, 1)
+	defer atomic.StoreInt32(&App.shuttingDown, 0)
+
+	if code, report = getHealth(t, r, "/readyz"); code != http.StatusServiceUnavailable || report.Checks["shutdown"].Status != HealthFail {
+		t.Fatalf("unexpected readiness %d %+v", code, report)
+	}
+	if code, _ = getHealth(t, r, "/healthz"); code != http.StatusOK {
+		t.Fatalf("unexpected liveness %d", code)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	defer withHealthChecks(nil)()
+
+	probes := App.probes
+	defer func() {
+		App.probes = probes
+	}()
+	App.registerHealth()
+
+	// The probes skip the global middlewares.
+	r := NewRouter()
+	r.Add("/private", "GET", func(c *Context) {
+		c.Plain(http.StatusOK, "private")
+	})
+	auth := func(c *Context) {
+		c.Plain(http.StatusUnauthorized, "denied")
+	}
+
+	for _, path := range []string{DefaultHealthPath, DefaultReadyPath} {
+		req, _ := http.NewRequest("GET", path, nil)
+		if w := serveWithMiddlewares(r, req, auth); w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected response %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/private", nil)
+	if w := serveWithMiddlewares(r, req, auth); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected response %d", w.Code)
+	}
+}
+
+func TestHealthCheckTimeoutAndPanic(t *testing.T) {
+	defer withHealthChecks(map[string]HealthCheck{
+		"slow": func(ctx context.Context) error {
+			time.Sleep(time.Minute)
+			return nil
+		},
+		"panic": func(ctx context.Context) error {
+			panic("boom")
+		},
+	})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report := App.health.run(ctx)
+	if report.Status != HealthFail || report.Checks["slow"].Error != context.DeadlineExceeded.Error() ||
+		report.Checks["panic"].Error != "panic: boom" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestSMTPHealthCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("220 localhost ESMTP\r\n"))
+			_, _ = ioutil.ReadAll(conn)
+			_ = conn.Close()
+		}
+	}()
+
+	saved := Config.Get("smtp_server")
+	Config.Set("smtp_server", ln.Addr().String())
+	defer Config.Set("smtp_server", saved)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := smtpHealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	var fail int32
+	defer withHealthChecks(map[string]HealthCheck{
+		"database": func(ctx context.Context) error {
+			if atomic.LoadInt32(&fail) == 1 {
+				return errors.New("down")
+			}
+			return nil
+		},
+	})()
+
+	s := NewGRPC()
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := s.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+
+	if check("") != healthpb.HealthCheckResponse_SERVING || check("database") != healthpb.HealthCheckResponse_SERVING {
+		t.Fatal("expected SERVING")
+	}
+
+	atomic.StoreInt32(&fail, 1)
+	if check("") != healthpb.HealthCheckResponse_NOT_SERVING || check("database") != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatal("expected NOT_SERVING")
+	}
+
+	atomic.StoreInt32(&fail, 0)
+	s.health.Shutdown()
+	atomic.StoreInt32(&App.shuttingDown, 1)
+	defer atomic.StoreInt32(&App.shuttingDown, 0)
+
+	if check("") != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatal("expected NOT_SERVING after shutdown")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	engine := &Engine{done: make(chan struct{})}
+
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan struct{})
+	go func() {
+		engine.serve(server, func() error {
+			return server.Serve(ln)
+		})
+		close(served)
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		body <- string(b)
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := engine.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !engine.ShuttingDown() {
+		t.Fatal("expected shutting down")
+	}
+
+	// The in-flight request is completed.
+	if b := <-body; b != "done" {
+		t.Fatalf("unexpected response %q", b)
+	}
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return")
+	}
+
+	// Further calls wait for the first one.
+	if err := engine.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,11 +6,18 @@ package framework
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -47,7 +54,20 @@ var (
 		"INFO",
 		"DEBU",
 	}
-	currentBackend io.Writer
+	lvlStrings = []string{
+		"critical",
+		"error",
+		"warning",
+		"info",
+		"debug",
+	}
+
+	// logBuffers reduces allocations while encoding log entries.
+	logBuffers = sync.Pool{
+		New: func() interface{} {
+			return &bytes.Buffer{}
+		},
+	}
 )
 
 type (
@@ -56,9 +76,57 @@ type (
 	// Level is the log gravity level
 	Level int
 
-	// Logger is the logger structure
+	// Field is a key/value pair attached to a log entry.
+	Field struct {
+		Key   string
+		Value interface{}
+	}
+
+	// Entry is a single log message.
+	Entry struct {
+		Time    time.Time
+		Level   Level
+		Message string
+		Fields  []Field
+	}
+
+	// Encoder writes a log entry to buf.
+	// Line based encoders must append a trailing new line.
+	Encoder interface {
+		Encode(buf *bytes.Buffer, e *Entry)
+	}
+
+	// TextEncoder writes entries as a human readable line, colored when Color is true.
+	TextEncoder struct {
+		Color bool
+	}
+
+	// JSONEncoder writes entries as JSON lines.
+	JSONEncoder struct{}
+
+	// Logger is the logger structure.
+	// A Logger is safe for concurrent use, loggers returned by With share
+	// the output, encoder and level of their parent.
 	Logger struct {
 		*log.Logger
+
+		core   *loggerCore
+		fields []Field
+	}
+
+	// Sink is a log destination: entries at Level or above are encoded with Encoder and written to Writer.
+	// Each entry is written with a single Write call.
+	Sink struct {
+		Writer  io.Writer
+		Encoder Encoder
+		Level   Level
+	}
+
+	// loggerCore contains the state shared between a Logger and its children.
+	loggerCore struct {
+		mu    sync.Mutex
+		sinks []*Sink
+		level int32
 	}
 )
 
@@ -69,28 +137,199 @@ func colorSeq(color color) string {
 	return fmt.Sprintf("\033[%dm", int(color))
 }
 
-// NewLogger create and return a new Logger instance
+// NewLogger create and return a new Logger instance.
+// Messages are written as text to out, colored when out is os.Stdout.
 func NewLogger(out io.Writer) *Logger {
-	currentBackend = out
-	l := &Logger{log.New(out, "", log.LstdFlags)}
+	l := &Logger{
+		Logger: log.New(out, "", log.LstdFlags),
+		core: &loggerCore{
+			sinks: []*Sink{NewSink(out, &TextEncoder{Color: out == os.Stdout}, DEBUG)},
+			level: int32(DEBUG),
+		},
+	}
 	return l
 }
 
-// log is the private function to
-func (l *Logger) log(lvl Level, str string) {
-	buf := &bytes.Buffer{}
+// NewSink returns a Sink writing entries at lvl or above to w.
+func NewSink(w io.Writer, encoder Encoder, lvl Level) *Sink {
+	return &Sink{Writer: w, Encoder: encoder, Level: lvl}
+}
 
-	if currentBackend == os.Stdout {
-		col := colors[lvl]
-		buf.Write([]byte(col))
+// ParseLevel returns the Level from its name (critical, error, warning, info, debug).
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(name)
+	for i, s := range lvlStrings {
+		if name == s || name == strings.ToLower(lvlNames[i]) {
+			return Level(i), nil
+		}
 	}
-	buf.WriteString(time.Now().Format("2006-01-02 15:04:05"))
-	buf.WriteString(" " + lvlNames[lvl] + " ")
-	if currentBackend == os.Stdout {
-		buf.Write([]byte("\033[0m"))
+	if name == "warn" {
+		return WARNING, nil
 	}
-	buf.WriteString(str)
-	fmt.Println(buf.String())
+
+	return DEBUG, fmt.Errorf("log: unknown level %s", name)
+}
+
+// String returns the level name.
+func (lvl Level) String() string {
+	if lvl < CRITICAL || lvl > DEBUG {
+		return "level(" + strconv.Itoa(int(lvl)) + ")"
+	}
+	return lvlStrings[lvl]
+}
+
+// configureLogger applies the log_level and log_format config values.
+// Without log_level, the level of the mode Profile is used.
+func configureLogger(l *Logger, config Configuration) {
+	lvl := Profile().LogLevel
+	name := config.String("log_level")
+	if name != "" {
+		var err error
+		if lvl, err = ParseLevel(name); err != nil {
+			l.Error(err)
+		}
+	}
+	l.SetLevel(lvl)
+
+	switch config.String("log_format") {
+	case "json":
+		l.SetEncoder(&JSONEncoder{})
+	case "text":
+		l.SetEncoder(&TextEncoder{Color: l.Logger.Writer() == os.Stdout})
+	}
+
+	if config.Get("log_sinks") != nil {
+		sinks, err := newSinksFromConfig(config.Get("log_sinks"), lvl)
+		if err != nil {
+			l.Error(err)
+			return
+		}
+		l.SetSinks(sinks...)
+
+		// Without log_level, the most verbose sink sets the level.
+		if name == "" {
+			for _, sink := range sinks {
+				if sink.Level > lvl {
+					lvl = sink.Level
+				}
+			}
+			l.SetLevel(lvl)
+		}
+	}
+}
+
+// SetLevel sets the minimum level, messages below lvl are discarded.
+func (l *Logger) SetLevel(lvl Level) {
+	atomic.StoreInt32(&l.core.level, int32(lvl))
+}
+
+// Enabled reports whether messages at lvl are written.
+func (l *Logger) Enabled(lvl Level) bool {
+	return int32(lvl) <= atomic.LoadInt32(&l.core.level)
+}
+
+// SetEncoder sets the encoder used to format the messages of the first sink.
+func (l *Logger) SetEncoder(encoder Encoder) {
+	l.core.mu.Lock()
+	if len(l.core.sinks) > 0 {
+		l.core.sinks[0].Encoder = encoder
+	}
+	l.core.mu.Unlock()
+}
+
+// SetOutput sets the output destination of the first sink.
+func (l *Logger) SetOutput(out io.Writer) {
+	l.core.mu.Lock()
+	if len(l.core.sinks) > 0 {
+		l.core.sinks[0].Writer = out
+	}
+	l.core.mu.Unlock()
+	l.Logger.SetOutput(out)
+}
+
+// SetSinks replaces the log destinations, each entry is written to every sink accepting its level.
+// Replaced sinks implementing io.Closer are closed.
+func (l *Logger) SetSinks(sinks ...*Sink) {
+	l.core.mu.Lock()
+	old := l.core.sinks
+	l.core.sinks = sinks
+	l.core.mu.Unlock()
+
+	_ = closeSinks(old, sinks)
+}
+
+// AddSink adds a log destination.
+func (l *Logger) AddSink(sink *Sink) {
+	l.core.mu.Lock()
+	l.core.sinks = append(l.core.sinks, sink)
+	l.core.mu.Unlock()
+}
+
+// Close closes the sinks implementing io.Closer.
+func (l *Logger) Close() error {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+
+	return closeSinks(l.core.sinks, nil)
+}
+
+// With returns a Logger that adds the key/value pairs to each message.
+//
+//	Log.With("user", id, "action", "login").Info("user logged in")
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]Field, len(l.fields), len(l.fields)+(len(keyvals)+1)/2)
+	copy(fields, l.fields)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 == len(keyvals) {
+			fields = append(fields, Field{Key: "!BADKEY", Value: key})
+			break
+		}
+		fields = append(fields, Field{Key: key, Value: keyvals[i+1]})
+	}
+
+	return &Logger{Logger: l.Logger, core: l.core, fields: fields}
+}
+
+// WithContext returns a Logger that adds the request ID found in ctx to each message.
+//
+//	Log.WithContext(c).Info("user logged in")
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		return l
+	}
+
+	return l.With("request_id", id)
+}
+
+// log is the private function to encode and write the entry.
+func (l *Logger) log(lvl Level, str string) {
+	if !l.Enabled(lvl) {
+		return
+	}
+
+	e := Entry{Time: time.Now(), Level: lvl, Message: str, Fields: l.fields}
+
+	buf := logBuffers.Get().(*bytes.Buffer)
+
+	l.core.mu.Lock()
+	for _, sink := range l.core.sinks {
+		if lvl > sink.Level {
+			continue
+		}
+
+		buf.Reset()
+		sink.Encoder.Encode(buf, &e)
+
+		if _, err := sink.Writer.Write(buf.Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "log: write error: %v\n", err)
+		}
+	}
+	l.core.mu.Unlock()
+
+	logBuffers.Put(buf)
 }
 
 // Critical is an alias to log(CRITICAL, str)
@@ -103,6 +342,18 @@ func (l *Logger) Criticalf(format string, a ...interface{}) {
 	l.log(CRITICAL, fmt.Sprintf(format, a...))
 }
 
+// Fatal logs as CRITICAL and exits.
+func (l *Logger) Fatal(v ...interface{}) {
+	l.log(CRITICAL, fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+// Fatalf logs as CRITICAL and exits.
+func (l *Logger) Fatalf(format string, a ...interface{}) {
+	l.log(CRITICAL, fmt.Sprintf(format, a...))
+	os.Exit(1)
+}
+
 // Error is an alias to log(ERROR, err)
 func (l *Logger) Error(err error) {
 	l.log(ERROR, err.Error())
@@ -142,3 +393,153 @@ func (l *Logger) Debug(str string) {
 func (l *Logger) Debugf(format string, a ...interface{}) {
 	l.log(DEBUG, fmt.Sprintf(format, a...))
 }
+
+// Encode writes "2006-01-02 15:04:05 INFO message key=value".
+func (enc *TextEncoder) Encode(buf *bytes.Buffer, e *Entry) {
+	var tmp [64]byte
+
+	if enc.Color {
+		buf.WriteString(colors[e.Level])
+	}
+	buf.Write(e.Time.AppendFormat(tmp[:0], "2006-01-02 15:04:05"))
+	buf.WriteString(" " + lvlNames[e.Level] + " ")
+	if enc.Color {
+		buf.WriteString("\033[0m")
+	}
+	buf.WriteString(e.Message)
+
+	for _, f := range e.Fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+
+		s := fieldString(f.Value)
+		if s == "" || strings.ContainsAny(s, " \"=\t\r\n") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+
+	buf.WriteByte('\n')
+}
+
+// Encode writes {"time":"...","level":"info","msg":"message","key":"value"}.
+func (enc *JSONEncoder) Encode(buf *bytes.Buffer, e *Entry) {
+	var tmp [64]byte
+
+	buf.WriteString(`{"time":"`)
+	buf.Write(e.Time.AppendFormat(tmp[:0], time.RFC3339Nano))
+	buf.WriteString(`","level":"`)
+	buf.WriteString(e.Level.String())
+	buf.WriteString(`","msg":`)
+	writeJSONString(buf, e.Message)
+
+	for _, f := range e.Fields {
+		buf.WriteByte(',')
+		writeJSONString(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, f.Value)
+	}
+
+	buf.WriteString("}\n")
+}
+
+// fieldString formats a field value for the text encoder.
+func fieldString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeJSONValue writes v as a JSON value without reflection for common types.
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	switch value := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case string:
+		writeJSONString(buf, value)
+	case int:
+		buf.WriteString(strconv.Itoa(value))
+	case int64:
+		buf.WriteString(strconv.FormatInt(value, 10))
+	case int32:
+		buf.WriteString(strconv.FormatInt(int64(value), 10))
+	case uint:
+		buf.WriteString(strconv.FormatUint(uint64(value), 10))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(value, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	case bool:
+		buf.WriteString(strconv.FormatBool(value))
+	case time.Duration:
+		writeJSONString(buf, value.String())
+	case time.Time:
+		writeJSONString(buf, value.Format(time.RFC3339Nano))
+	case error:
+		writeJSONString(buf, value.Error())
+	case fmt.Stringer:
+		writeJSONString(buf, value.String())
+	default:
+		b, err := json.Marshal(value)
+		if err != nil {
+			writeJSONString(buf, fmt.Sprint(value))
+			return
+		}
+		buf.Write(b)
+	}
+}
+
+// writeJSONString writes s as a quoted JSON string.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case b == '\n':
+				buf.WriteString(`\n`)
+			case b == '\r':
+				buf.WriteString(`\r`)
+			case b == '\t':
+				buf.WriteString(`\t`)
+			case b < 0x20:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[b>>4])
+				buf.WriteByte(hex[b&0xF])
+			default:
+				buf.WriteByte(b)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString("\ufffd")
+		} else {
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+}
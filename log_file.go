@@ -0,0 +1,230 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is appended to the rotated file names.
+const rotatedTimeFormat = "20060102T150405.000"
+
+// RotatingFile is an io.WriteCloser writing to Filename and rotating it by size or age.
+// Rotated files are renamed to name-<timestamp>.ext, optionally compressed with gzip
+// and removed when older than MaxAge or exceeding MaxBackups.
+type RotatingFile struct {
+	// Filename is the file to write to, directories are created when needed.
+	Filename string
+	// MaxSize rotates the file before it exceeds MaxSize bytes. 0 disables size rotation.
+	MaxSize int64
+	// RotateEvery rotates the file when it has been open for longer than RotateEvery. 0 disables age rotation.
+	RotateEvery time.Duration
+	// MaxAge removes rotated files older than MaxAge. 0 keeps them.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep. 0 keeps them.
+	MaxBackups int
+	// Compress compresses rotated files with gzip.
+	Compress bool
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	wg     sync.WaitGroup
+}
+
+// Write writes b to the file, rotating it first when required.
+func (rf *RotatingFile) Write(b []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if (rf.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(b)) > rf.MaxSize) ||
+		(rf.RotateEvery > 0 && time.Since(rf.opened) >= rf.RotateEvery) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(b)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it and opens a new one.
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.rotate()
+}
+
+// Close closes the file and waits for pending compressions.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	var err error
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.mu.Unlock()
+
+	rf.wg.Wait()
+	return err
+}
+
+// open opens or creates the log file in append mode.
+func (rf *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.Filename), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(rf.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	rf.file = f
+	rf.size = fi.Size()
+	rf.opened = time.Now()
+	return nil
+}
+
+// rotate renames the current file and opens a new one, the old files are
+// compressed and cleaned in background.
+func (rf *RotatingFile) rotate() error {
+	if rf.file != nil {
+		if err := rf.file.Close(); err != nil {
+			return err
+		}
+		rf.file = nil
+	}
+
+	if _, err := os.Stat(rf.Filename); err == nil {
+		ext := filepath.Ext(rf.Filename)
+		prefix := strings.TrimSuffix(rf.Filename, ext) + "-"
+		rotated := prefix + time.Now().Format(rotatedTimeFormat) + ext
+
+		for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+			rotated = fmt.Sprintf("%s%s.%d%s", prefix, time.Now().Format(rotatedTimeFormat), i, ext)
+		}
+
+		if err := os.Rename(rf.Filename, rotated); err != nil {
+			return err
+		}
+
+		rf.wg.Add(1)
+		go func() {
+			defer rf.wg.Done()
+
+			if rf.Compress {
+				if err := gzipFile(rotated); err != nil {
+					fmt.Fprintf(os.Stderr, "log: compress error: %v\n", err)
+				}
+			}
+			rf.clean()
+		}()
+	}
+
+	return rf.open()
+}
+
+// clean removes the rotated files exceeding MaxBackups or older than MaxAge.
+func (rf *RotatingFile) clean() {
+	if rf.MaxBackups <= 0 && rf.MaxAge <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(rf.Filename)
+	prefix := strings.TrimSuffix(rf.Filename, ext) + "-"
+
+	matches, err := filepath.Glob(prefix + "*")
+	if err != nil {
+		return
+	}
+
+	// Keep only the rotated files, other logs may share the prefix.
+	var files []string
+	for _, file := range matches {
+		name := strings.TrimPrefix(file, prefix)
+		if len(name) < len(rotatedTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(rotatedTimeFormat, name[:len(rotatedTimeFormat)]); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	// Rotated names contain the timestamp: lexical order is chronological.
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	for i, file := range files {
+		remove := rf.MaxBackups > 0 && i >= rf.MaxBackups
+
+		if !remove && rf.MaxAge > 0 {
+			if fi, err := os.Stat(file); err == nil && time.Since(fi.ModTime()) > rf.MaxAge {
+				remove = true
+			}
+		}
+
+		if remove {
+			_ = os.Remove(file)
+		}
+	}
+}
+
+// gzipFile compresses path to path.gz and removes path.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+
+	_ = in.Close()
+	return os.Remove(path)
+}
+
+// fileExists reports whether the file exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Unrelated files sharing the prefix must not be removed.
+	other := filepath.Join(dir, "app-other.log")
+	if err := ioutil.WriteFile(other, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rf := &RotatingFile{Filename: filepath.Join(dir, "app.log"), MaxSize: 10, MaxBackups: 2, Compress: true}
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for the background compression to keep the names unique and ordered.
+		rf.wg.Wait()
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(rf.Filename)
+	if err != nil || string(data) != "line 4\n" {
+		t.Fatalf("unexpected current file %q, %v", data, err)
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "app-*.log.gz"))
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", rotated)
+	}
+
+	f, err := os.Open(rotated[len(rotated)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadAll(gz)
+	if string(data) != "line 3\n" {
+		t.Fatalf("unexpected rotated content %q", data)
+	}
+
+	if !fileExists(other) {
+		t.Fatal("unrelated file removed")
+	}
+}
+
+func TestLoggerSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sinks, err := newSinksFromConfig([]interface{}{
+		map[string]interface{}{"type": "file", "path": filepath.Join(dir, "all.log"), "format": "json"},
+		map[string]interface{}{"type": "file", "path": filepath.Join(dir, "errors.log"), "level": "error", "max_size": 1024.0},
+	}, DEBUG)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLogger(ioutil.Discard)
+	l.SetSinks(sinks...)
+	l.Info("info message")
+	l.Errorf("error message")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	all, _ := ioutil.ReadFile(filepath.Join(dir, "all.log"))
+	errs, _ := ioutil.ReadFile(filepath.Join(dir, "errors.log"))
+
+	if strings.Count(string(all), "\n") != 2 || !strings.HasPrefix(string(all), "{") {
+		t.Fatalf("unexpected all.log %q", all)
+	}
+	if strings.Contains(string(errs), "info message") || !strings.Contains(string(errs), "ERRO error message") {
+		t.Fatalf("unexpected errors.log %q", errs)
+	}
+
+	for _, invalid := range []interface{}{
+		[]interface{}{map[string]interface{}{"type": "kafka"}},
+		[]interface{}{map[string]interface{}{"type": "file"}},
+		[]interface{}{map[string]interface{}{"type": "stdout", "level": "verbose"}},
+		[]interface{}{map[string]interface{}{"type": "file", "path": "x.log", "max_age": "1 week"}},
+	} {
+		if _, err := newSinksFromConfig(invalid, DEBUG); err == nil {
+			t.Errorf("expected error for %v", invalid)
+		}
+	}
+}
+
+func TestLoggerSinkLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	withMode(t, ProductionMode)
+	debug, info := filepath.Join(dir, "debug.log"), filepath.Join(dir, "info.log")
+	path := writeConfigFile(t, dir, "app.json", `{"log_sinks": [
+		{"type": "file", "path": "`+debug+`", "level": "debug"},
+		{"type": "file", "path": "`+info+`"}
+	]}`)
+
+	// Without log_level, the debug sink gets the debug messages, the other one the production level.
+	l := NewLogger(ioutil.Discard)
+	configureLogger(l, LoadConfig(path))
+	l.Debug("debug message")
+	l.Info("info message")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	debugLog, _ := ioutil.ReadFile(debug)
+	infoLog, _ := ioutil.ReadFile(info)
+	if !strings.Contains(string(debugLog), "debug message") || !strings.Contains(string(debugLog), "info message") {
+		t.Fatalf("unexpected debug.log %q", debugLog)
+	}
+	if strings.Contains(string(infoLog), "debug message") || !strings.Contains(string(infoLog), "info message") {
+		t.Fatalf("unexpected info.log %q", infoLog)
+	}
+
+	// log_level caps the sinks.
+	path = writeConfigFile(t, dir, "app.json", `{"log_level": "info", "log_sinks": [
+		{"type": "file", "path": "`+debug+`", "level": "debug"}
+	]}`)
+	configureLogger(l, LoadConfig(path))
+	if l.Enabled(DEBUG) {
+		t.Fatal("debug enabled with log_level info")
+	}
+	_ = l.Close()
+}
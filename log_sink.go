@@ -0,0 +1,188 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// sinkConfig is a log_sinks entry, f.e.
+//
+//	"log_sinks": [
+//		{"type": "stdout", "level": "info"},
+//		{"type": "file", "path": "logs/app.log", "format": "json", "max_size": 10485760, "max_backups": 7, "compress": true},
+//		{"type": "syslog", "network": "udp", "address": "localhost:514", "facility": 16, "level": "warning"}
+//	]
+type sinkConfig struct {
+	Type   string `json:"type"`
+	Level  string `json:"level"`
+	Format string `json:"format"`
+
+	// file
+	Path        string `json:"path"`
+	MaxSize     int64  `json:"max_size"`
+	RotateEvery string `json:"rotate_every"`
+	MaxAge      string `json:"max_age"`
+	MaxBackups  int    `json:"max_backups"`
+	Compress    bool   `json:"compress"`
+
+	// syslog
+	Network  string `json:"network"`
+	Address  string `json:"address"`
+	Facility int    `json:"facility"`
+	AppName  string `json:"app_name"`
+}
+
+// newSinksFromConfig creates the sinks described by the log_sinks config value,
+// lvl is the level of the sinks without one.
+func newSinksFromConfig(value interface{}, lvl Level) ([]*Sink, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []sinkConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("log: invalid log_sinks: %v", err)
+	}
+
+	sinks := make([]*Sink, 0, len(configs))
+	for _, config := range configs {
+		sink, err := config.newSink(lvl)
+		if err != nil {
+			_ = closeSinks(sinks, nil)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// newSink creates the writer and the encoder of the sink, at lvl without level.
+func (config *sinkConfig) newSink(lvl Level) (*Sink, error) {
+	if config.Level != "" {
+		var err error
+		if lvl, err = ParseLevel(config.Level); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		w       io.Writer
+		encoder Encoder
+	)
+
+	switch strings.ToLower(config.Type) {
+	case "", "stdout":
+		w = os.Stdout
+		encoder = &TextEncoder{Color: true}
+	case "stderr":
+		w = os.Stderr
+		encoder = &TextEncoder{}
+	case "file":
+		if config.Path == "" {
+			return nil, fmt.Errorf("log: file sink without path")
+		}
+
+		rf := &RotatingFile{
+			Filename:   config.Path,
+			MaxSize:    config.MaxSize,
+			MaxBackups: config.MaxBackups,
+			Compress:   config.Compress,
+		}
+
+		var err error
+		if rf.RotateEvery, err = parseSinkDuration(config.RotateEvery); err != nil {
+			return nil, err
+		}
+		if rf.MaxAge, err = parseSinkDuration(config.MaxAge); err != nil {
+			return nil, err
+		}
+
+		w = rf
+		encoder = &TextEncoder{}
+	case "syslog":
+		network := config.Network
+		if network == "" {
+			network = "udp"
+		}
+
+		sw, err := NewSyslogWriter(network, config.Address)
+		if err != nil {
+			return nil, fmt.Errorf("log: syslog sink: %v", err)
+		}
+
+		facility := config.Facility
+		if facility == 0 {
+			facility = SyslogUser
+		}
+
+		w = sw
+		encoder = NewSyslogEncoder(facility, config.AppName)
+	default:
+		return nil, fmt.Errorf("log: unknown sink type %s", config.Type)
+	}
+
+	switch config.Format {
+	case "json":
+		encoder = &JSONEncoder{}
+	case "text":
+		encoder = &TextEncoder{Color: w == os.Stdout}
+	case "":
+	default:
+		return nil, fmt.Errorf("log: unknown sink format %s", config.Format)
+	}
+
+	return NewSink(w, encoder, lvl), nil
+}
+
+// parseSinkDuration parses a duration string, empty is 0.
+func parseSinkDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("log: invalid duration %s", s)
+	}
+	return d, nil
+}
+
+// closeSinks closes the writers of old not used by keep. Standard outputs are never closed.
+func closeSinks(old, keep []*Sink) error {
+	var first error
+
+	for _, sink := range old {
+		if sink.Writer == os.Stdout || sink.Writer == os.Stderr {
+			continue
+		}
+
+		used := false
+		for _, k := range keep {
+			if k.Writer == sink.Writer {
+				used = true
+				break
+			}
+		}
+		if used {
+			continue
+		}
+
+		if c, ok := sink.Writer.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog facilities (RFC 5424).
+const (
+	SyslogKern = iota
+	SyslogUser
+	SyslogMail
+	SyslogDaemon
+	SyslogAuth
+	SyslogSyslog
+	SyslogLpr
+	SyslogNews
+	SyslogUucp
+	SyslogCron
+	SyslogAuthPriv
+	SyslogFtp
+	_
+	_
+	_
+	_
+	SyslogLocal0
+	SyslogLocal1
+	SyslogLocal2
+	SyslogLocal3
+	SyslogLocal4
+	SyslogLocal5
+	SyslogLocal6
+	SyslogLocal7
+)
+
+// syslogSeverities maps the log levels to the syslog severities.
+var syslogSeverities = []int{
+	CRITICAL: 2,
+	ERROR:    3,
+	WARNING:  4,
+	INFO:     6,
+	DEBUG:    7,
+}
+
+type (
+	// SyslogEncoder formats the entries as RFC 5424 messages.
+	// Fields are sent as structured data with the fields@32473 id.
+	SyslogEncoder struct {
+		Facility int
+		Hostname string
+		AppName  string
+	}
+
+	// SyslogWriter sends messages to a syslog server over udp, tcp, unix or unixgram sockets.
+	// TCP and unix stream messages use the octet counting framing (RFC 6587).
+	// The connection is reopened on write errors.
+	SyslogWriter struct {
+		Network string
+		Address string
+		Timeout time.Duration
+
+		mu   sync.Mutex
+		conn net.Conn
+	}
+)
+
+// NewSyslogEncoder returns a SyslogEncoder using the host name and the executable name.
+func NewSyslogEncoder(facility int, appName string) *SyslogEncoder {
+	hostname, _ := os.Hostname()
+	if appName == "" {
+		appName = os.Args[0]
+		if i := strings.LastIndexAny(appName, `/\`); i != -1 {
+			appName = appName[i+1:]
+		}
+	}
+
+	return &SyslogEncoder{Facility: facility, Hostname: hostname, AppName: appName}
+}
+
+// Encode writes <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG.
+func (enc *SyslogEncoder) Encode(buf *bytes.Buffer, e *Entry) {
+	var tmp [64]byte
+
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(enc.Facility*8 + syslogSeverities[e.Level]))
+	buf.WriteString(">1 ")
+	buf.Write(e.Time.UTC().AppendFormat(tmp[:0], "2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteByte(' ')
+	buf.WriteString(syslogHeaderValue(enc.Hostname, 255))
+	buf.WriteByte(' ')
+	buf.WriteString(syslogHeaderValue(enc.AppName, 48))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(os.Getpid()))
+	buf.WriteString(" - ")
+
+	if len(e.Fields) == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString("[fields@32473")
+		for _, f := range e.Fields {
+			buf.WriteByte(' ')
+			buf.WriteString(syslogParamName(f.Key))
+			buf.WriteString(`="`)
+			buf.WriteString(syslogParamValue(fieldString(f.Value)))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte(']')
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(e.Message)
+}
+
+// syslogHeaderValue returns printable US-ASCII characters only, "-" when empty.
+func syslogHeaderValue(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		if s[i] > 32 && s[i] < 127 {
+			b = append(b, s[i])
+		}
+	}
+
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// syslogParamName removes the characters not allowed in a SD-NAME.
+func syslogParamName(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < 32; i++ {
+		if c := s[i]; c > 32 && c < 127 && c != '=' && c != ']' && c != '"' && c != ' ' {
+			b = append(b, c)
+		}
+	}
+
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// syslogParamValue escapes '"', '\' and ']' in a PARAM-VALUE.
+func syslogParamValue(s string) string {
+	if !strings.ContainsAny(s, `"\]`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' || s[i] == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// NewSyslogWriter returns a SyslogWriter connected to address.
+func NewSyslogWriter(network, address string) (*SyslogWriter, error) {
+	w := &SyslogWriter{Network: network, Address: address, Timeout: 5 * time.Second}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends a single syslog message.
+func (w *SyslogWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Retry once with a new connection.
+	var err error
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				return 0, err
+			}
+		}
+
+		if err = w.send(b); err == nil {
+			return len(b), nil
+		}
+
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	return 0, err
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.Network, w.Address, w.Timeout)
+	if err != nil {
+		return err
+	}
+
+	w.conn = conn
+	return nil
+}
+
+// send writes the message, stream sockets are framed with the message length.
+func (w *SyslogWriter) send(b []byte) error {
+	if w.Timeout > 0 {
+		_ = w.conn.SetWriteDeadline(time.Now().Add(w.Timeout))
+	}
+
+	b = bytes.TrimRight(b, "\n")
+
+	switch w.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		frame := make([]byte, 0, len(b)+8)
+		frame = strconv.AppendInt(frame, int64(len(b)), 10)
+		frame = append(frame, ' ')
+		frame = append(frame, b...)
+		_, err := w.conn.Write(frame)
+		return err
+	}
+
+	_, err := w.conn.Write(b)
+	return err
+}
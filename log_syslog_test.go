@@ -0,0 +1,111 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bufio"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var syslogLine = regexp.MustCompile(`^<131>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z host app \d+ - \[fields@32473 user="1" q="a\\"b\\]"\] failed$`)
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := NewSyslogWriter("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLogger(nil)
+	l.SetSinks(NewSink(w, &SyslogEncoder{Facility: SyslogLocal0, Hostname: "host", AppName: "app"}, ERROR))
+	defer l.Close()
+
+	l.Info("skipped")
+	l.With("user", 1, "q", `a"b]`).Errorf("failed")
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !syslogLine.Match(b[:n]) {
+		t.Fatalf("unexpected syslog message %q", b[:n])
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// Octet counting framing: "<len> <message>"
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			msg := make([]byte, n)
+			if _, err := r.Read(msg); err != nil {
+				return
+			}
+			messages <- string(msg)
+		}
+	}()
+
+	w, err := NewSyslogWriter("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	enc := &SyslogEncoder{Facility: SyslogLocal0, Hostname: "host", AppName: "app"}
+	l := NewLogger(nil)
+	l.SetSinks(NewSink(w, enc, DEBUG))
+
+	l.With("user", 1, "q", `a"b]`).Errorf("failed")
+	l.Debug("second")
+
+	select {
+	case msg := <-messages:
+		if !syslogLine.MatchString(msg) {
+			t.Fatalf("unexpected syslog message %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	select {
+	case msg := <-messages:
+		if !strings.HasPrefix(msg, "<135>1 ") || !strings.HasSuffix(msg, " - - second") {
+			t.Fatalf("unexpected syslog message %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoggerText(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf)
+
+	l.With("user", 1, "name", "John Doe").Info("logged in")
+
+	line := buf.String()
+	if !strings.HasSuffix(line, " INFO logged in user=1 name=\"John Doe\"\n") {
+		t.Fatalf("unexpected text line %q", line)
+	}
+	if strings.Contains(line, "\033[") {
+		t.Fatal("colors written to a non terminal writer")
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf)
+	l.SetEncoder(&JSONEncoder{})
+
+	l.With("user", 1, "err", errors.New("failed \"quoted\"\n"), "ok", true).Warning("message")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+
+	if entry["level"] != "warning" || entry["msg"] != "message" || entry["user"] != float64(1) ||
+		entry["err"] != "failed \"quoted\"\n" || entry["ok"] != true || entry["time"] == nil {
+		t.Fatalf("unexpected JSON entry %v", entry)
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf)
+	l.SetLevel(WARNING)
+
+	child := l.With("key", "value")
+	child.Debug("debug")
+	child.Info("info")
+	child.Warning("warning")
+	l.Error(errors.New("error"))
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", lines, buf.String())
+	}
+
+	if lvl, err := ParseLevel("INFO"); err != nil || lvl != INFO {
+		t.Fatalf("ParseLevel() = %v, %v", lvl, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatal("ParseLevel() accepted an unknown level")
+	}
+}
+
+func TestLoggerConcurrent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf)
+	l.SetEncoder(&JSONEncoder{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.With("goroutine", i).Info("message")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Fatalf("interleaved line %q", line)
+		}
+	}
+}
+
+func BenchmarkLoggerJSON(b *testing.B) {
+	l := NewLogger(ioutil.Discard)
+	l.SetEncoder(&JSONEncoder{})
+	l = l.With("request_id", "abc", "status", 200)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("request")
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metric types.
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+type (
+	// Registry contains the metrics exposed in the Prometheus text format.
+	// It implements http.Handler.
+	Registry struct {
+		mu         sync.RWMutex
+		collectors map[string]collector
+	}
+
+	// Counter is a monotonically increasing value, partitioned by label values.
+	Counter struct{ m *metric }
+
+	// Gauge is a value that can go up and down, partitioned by label values.
+	Gauge struct{ m *metric }
+
+	// Histogram samples observations in buckets, partitioned by label values.
+	Histogram struct{ m *metric }
+
+	// Sample is a value with its label values, returned by the metric functions.
+	Sample struct {
+		LabelValues []string
+		Value       float64
+	}
+
+	// collector writes a metric family.
+	collector interface {
+		write(buf *bytes.Buffer)
+	}
+
+	// metric contains the series of a counter, gauge or histogram.
+	metric struct {
+		name    string
+		help    string
+		typ     string
+		labels  []string
+		buckets []float64
+
+		mu     sync.RWMutex
+		series map[string]*series
+	}
+
+	// series is a single labeled value.
+	series struct {
+		labelValues []string
+		bits        uint64 // float64 value for counters and gauges
+
+		mu     sync.Mutex
+		counts []uint64
+		sum    float64
+		count  uint64
+	}
+
+	// metricFunc reads the samples on each scrape.
+	metricFunc struct {
+		name   string
+		help   string
+		typ    string
+		labels []string
+		fn     func() []Sample
+	}
+)
+
+// Metrics is the framework metrics registry.
+// Set the metrics config key to a path (f.e. "/metrics") to expose it with the application
+// routes or to an address (f.e. "localhost:9100") to listen on a dedicated port.
+var Metrics = NewRegistry()
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// NewCounter registers a counter. It panics if the name is invalid or already registered.
+//
+//	orders := framework.Metrics.NewCounter("orders_total", "Number of orders.", "country")
+//	orders.Inc("IT")
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.newMetric(name, help, metricCounter, labels, nil)}
+}
+
+// NewGauge registers a gauge. It panics if the name is invalid or already registered.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.newMetric(name, help, metricGauge, labels, nil)}
+}
+
+// NewHistogram registers a histogram with the given upper bounds, DefBuckets when nil.
+// It panics if the name is invalid or already registered.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	return &Histogram{r.newMetric(name, help, metricHistogram, labels, b)}
+}
+
+// NewCounterFunc registers a counter whose samples are returned by fn on each scrape.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(name, &metricFunc{name: name, help: help, typ: metricCounter, labels: labels, fn: fn})
+}
+
+// NewGaugeFunc registers a gauge whose samples are returned by fn on each scrape.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(name, &metricFunc{name: name, help: help, typ: metricGauge, labels: labels, fn: fn})
+}
+
+// Unregister removes the metric.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.collectors, name)
+	r.mu.Unlock()
+}
+
+func (r *Registry) newMetric(name, help, typ string, labels []string, buckets []float64) *metric {
+	m := &metric{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.register(name, m)
+	return m
+}
+
+func (r *Registry) register(name string, c collector) {
+	if !metricName.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid name %q", name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[name]; ok {
+		panic(fmt.Sprintf("metrics: %s already registered", name))
+	}
+	r.collectors[name] = c
+}
+
+// WriteTo writes the metrics in the Prometheus text format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	collectors := make([]collector, len(names))
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.mu.RUnlock()
+
+	buf := &bytes.Buffer{}
+	for _, c := range collectors {
+		c.write(buf)
+	}
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// ServeHTTP writes the metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.m.get(labelValues).add(1)
+}
+
+// Add adds v to the counter. It panics if v is negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.m.get(labelValues).add(v)
+}
+
+// Value returns the counter value.
+func (c *Counter) Value(labelValues ...string) float64 {
+	if s := c.m.lookup(labelValues); s != nil {
+		return s.value()
+	}
+	return 0
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	atomic.StoreUint64(&g.m.get(labelValues).bits, math.Float64bits(v))
+}
+
+// Inc increments the gauge by 1.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.m.get(labelValues).add(1)
+}
+
+// Dec decrements the gauge by 1.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.m.get(labelValues).add(-1)
+}
+
+// Add adds v to the gauge.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.get(labelValues).add(v)
+}
+
+// Value returns the gauge value.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	if s := g.m.lookup(labelValues); s != nil {
+		return s.value()
+	}
+	return 0
+}
+
+// Observe adds an observation.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	s := h.m.get(labelValues)
+
+	s.mu.Lock()
+	for i, bound := range h.m.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+	s.mu.Unlock()
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	s := h.m.lookup(labelValues)
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// get returns the series of the label values, creating it when needed.
+// It panics if the number of values doesn't match the labels.
+func (m *metric) get(labelValues []string) *series {
+	s := m.lookup(labelValues)
+	if s != nil {
+		return s
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s = m.series[key]; s == nil {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if m.typ == metricHistogram {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// lookup returns the series of the label values, nil when missing: reading a value
+// doesn't add a series. It panics if the number of values doesn't match the labels.
+func (m *metric) lookup(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.series[strings.Join(labelValues, "\xff")]
+}
+
+func (m *metric) write(buf *bytes.Buffer) {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]*series, len(keys))
+	for i, key := range keys {
+		list[i] = m.series[key]
+	}
+	m.mu.RUnlock()
+
+	writeMetricHeader(buf, m.name, m.help, m.typ)
+
+	for _, s := range list {
+		if m.typ != metricHistogram {
+			writeSample(buf, m.name, m.labels, s.labelValues, "", "", s.value())
+			continue
+		}
+
+		s.mu.Lock()
+		for i, bound := range m.buckets {
+			writeSample(buf, m.name+"_bucket", m.labels, s.labelValues, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+		writeSample(buf, m.name+"_bucket", m.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(buf, m.name+"_sum", m.labels, s.labelValues, "", "", s.sum)
+		writeSample(buf, m.name+"_count", m.labels, s.labelValues, "", "", float64(s.count))
+		s.mu.Unlock()
+	}
+}
+
+func (f *metricFunc) write(buf *bytes.Buffer) {
+	writeMetricHeader(buf, f.name, f.help, f.typ)
+
+	for _, sample := range f.fn() {
+		if len(sample.LabelValues) != len(f.labels) {
+			continue
+		}
+		writeSample(buf, f.name, f.labels, sample.LabelValues, "", "", sample.Value)
+	}
+}
+
+// add atomically adds v to the value.
+func (s *series) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&s.bits)
+		if atomic.CompareAndSwapUint64(&s.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (s *series) value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.bits))
+}
+
+// writeMetricHeader writes the HELP and TYPE lines.
+func writeMetricHeader(buf *bytes.Buffer, name, help, typ string) {
+	buf.WriteString("# HELP ")
+	buf.WriteString(name)
+	buf.WriteByte(' ')
+	buf.WriteString(strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	buf.WriteString("\n# TYPE ")
+	buf.WriteString(name)
+	buf.WriteByte(' ')
+	buf.WriteString(typ)
+	buf.WriteByte('\n')
+}
+
+// writeSample writes name{labels} value, extraLabel is appended when not empty (f.e. le).
+func writeSample(buf *bytes.Buffer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	buf.WriteString(name)
+
+	if len(labels) > 0 || extraLabel != "" {
+		buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeLabel(buf, label, values[i])
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				buf.WriteByte(',')
+			}
+			writeLabel(buf, extraLabel, extraValue)
+		}
+		buf.WriteByte('}')
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(v))
+	buf.WriteByte('\n')
+}
+
+func writeLabel(buf *bytes.Buffer, label, value string) {
+	buf.WriteString(label)
+	buf.WriteString(`="`)
+	buf.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value))
+	buf.WriteByte('"')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/AnUnnamedProject/framework/cache"
+)
+
+// Built-in metrics.
+var (
+	httpRequests = Metrics.NewCounter("http_requests_total",
+		"Number of HTTP requests by method, route pattern and status.", "method", "route", "status")
+	httpDuration = Metrics.NewHistogram("http_request_duration_seconds",
+		"HTTP request latency by method and route pattern.", nil, "method", "route")
+	grpcHandled = Metrics.NewCounter("grpc_server_handled_total",
+		"Number of gRPC calls by method and status code.", "method", "code")
+	grpcDuration = Metrics.NewHistogram("grpc_server_handling_seconds",
+		"gRPC call latency by method.", nil, "method")
+	emailSent = Metrics.NewCounter("email_sent_total",
+		"Number of emails sent by result (success or error).", "result")
+)
+
+// HTTPMetrics returns a middleware counting the requests and measuring their latency
+// by route pattern and status. Static files are reported as the "static" route,
+// requests not matching any route as "unmatched".
+// It is registered on Init when the metrics config key is set.
+func HTTPMetrics() HandlerFunc {
+	return func(c *Context) {
+		start := time.Now()
+
+		c.After(func(c *Context) {
+			route := c.route
+			if c.static {
+				route = "static"
+			} else if route == "" {
+				route = "unmatched"
+			}
+
+			status := c.Response.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			method := metricsMethod(c.Request.Method)
+			httpRequests.Inc(method, route, strconv.Itoa(status))
+			httpDuration.Observe(time.Since(start).Seconds(), method, route)
+		})
+	}
+}
+
+// metricsMethod limits the method label to the standard methods.
+func metricsMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+// MetricsUnaryInterceptor measures the gRPC unary calls.
+func MetricsUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeGRPC(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// MetricsStreamInterceptor measures the gRPC streams.
+func MetricsStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		observeGRPC(info.FullMethod, start, err)
+		return err
+	}
+}
+
+func observeGRPC(method string, start time.Time, err error) {
+	grpcHandled.Inc(method, status.Code(err).String())
+	grpcDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+// cacheStats returns the hits, misses and evictions of the application cache.
+func cacheStats() (cache.Stats, bool) {
+	if App == nil || App.cache == nil {
+		return cache.Stats{}, false
+	}
+
+	s, ok := App.cache.(interface{ Stats() cache.Stats })
+	if !ok {
+		return cache.Stats{}, false
+	}
+	return s.Stats(), true
+}
+
+func init() {
+	Metrics.NewCounterFunc("cache_hits_total", "Number of cache hits by adapter.", []string{"adapter"}, func() []Sample {
+		if stats, ok := cacheStats(); ok {
+			return []Sample{{LabelValues: []string{Config.String("cache")}, Value: float64(stats.Hits)}}
+		}
+		return nil
+	})
+
+	Metrics.NewCounterFunc("cache_misses_total", "Number of cache misses by adapter.", []string{"adapter"}, func() []Sample {
+		if stats, ok := cacheStats(); ok {
+			return []Sample{{LabelValues: []string{Config.String("cache")}, Value: float64(stats.Misses)}}
+		}
+		return nil
+	})
+
+	Metrics.NewCounterFunc("cache_evictions_total", "Number of values removed from the cache by adapter and reason.", []string{"adapter", "reason"}, func() []Sample {
+		if stats, ok := cacheStats(); ok {
+			return []Sample{
+				{LabelValues: []string{Config.String("cache"), cache.Evicted.String()}, Value: float64(stats.Evictions)},
+				{LabelValues: []string{Config.String("cache"), cache.Expired.String()}, Value: float64(stats.Expirations)},
+			}
+		}
+		return nil
+	})
+
+	Metrics.NewGaugeFunc("sessions_active", "Number of active sessions by provider.", []string{"provider"}, func() []Sample {
+		var samples []Sample
+		for name, session := range sessionProviders {
+			if s, ok := session.(interface{ Count() int }); ok {
+				samples = append(samples, Sample{LabelValues: []string{name}, Value: float64(s.Count())})
+			}
+		}
+		return samples
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounter("requests_total", "Number of requests.", "path")
+	temperature := r.NewGauge("temperature", "Current \"temperature\".")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.5, 0.1})
+	r.NewGaugeFunc("queue_size", "Queue size.", []string{"queue"}, func() []Sample {
+		return []Sample{{LabelValues: []string{"mail"}, Value: 3}}
+	})
+
+	requests.Inc("/a")
+	requests.Add(2, "/b\"")
+	requests.Inc("/a")
+	temperature.Set(21.5)
+	temperature.Dec()
+	latency.Observe(0.05)
+	latency.Observe(0.3)
+	latency.Observe(2)
+
+	// Reading unseen label values adds no series.
+	if requests.Value("/c") != 0 || requests.Value("/a") != 2 || temperature.Value() != 20.5 || latency.Count() != 3 {
+		t.Fatal("unexpected values")
+	}
+	wait := r.NewHistogram("wait_seconds", "Wait.", []float64{1}, "path")
+	if wait.Count("/a") != 0 || r.NewGauge("unseen", "Unseen.", "path").Value("/a") != 0 {
+		t.Fatal("unexpected values of unseen labels")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="0.5"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 2.35
+latency_seconds_count 3
+# HELP queue_size Queue size.
+# TYPE queue_size gauge
+queue_size{queue="mail"} 3
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{path="/a"} 2
+requests_total{path="/b\""} 2
+# HELP temperature Current "temperature".
+# TYPE temperature gauge
+temperature 20.5
+# HELP unseen Unseen.
+# TYPE unseen gauge
+# HELP wait_seconds Wait.
+# TYPE wait_seconds histogram
+`
+	if w.Body.String() != expected {
+		t.Fatalf("unexpected output:\n%s", w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %s", w.Header().Get("Content-Type"))
+	}
+
+	for _, fn := range []func(){
+		func() { r.NewCounter("requests_total", "duplicate") },
+		func() { r.NewCounter("invalid-name", "invalid") },
+		func() { requests.Inc() },
+		func() { requests.Value() },
+		func() { requests.Add(-1, "/a") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	r := NewRouter()
+	r.Add("/user/:id", "GET", func(c *Context) {
+		c.Plain(http.StatusCreated, "ok")
+	})
+
+	before := httpRequests.Value("GET", "/user/:id", "201")
+	missing := httpRequests.Value("GET", "unmatched", "404")
+	count := httpDuration.Count("GET", "/user/:id")
+
+	for _, path := range []string{"/user/1", "/user/2", "/missing"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		serveWithMiddlewares(r, req, HTTPMetrics())
+	}
+
+	if v := httpRequests.Value("GET", "/user/:id", "201") - before; v != 2 {
+		t.Fatalf("expected 2 requests, got %v", v)
+	}
+	if v := httpRequests.Value("GET", "unmatched", "404") - missing; v != 1 {
+		t.Fatalf("expected 1 unmatched request, got %v", v)
+	}
+	if n := httpDuration.Count("GET", "/user/:id") - count; n != 2 {
+		t.Fatalf("expected 2 observations, got %d", n)
+	}
+
+	buf := &bytes.Buffer{}
+	_, _ = Metrics.WriteTo(buf)
+	if !strings.Contains(buf.String(), `http_requests_total{method="GET",route="/user/:id",status="201"}`) {
+		t.Fatalf("route series not exposed:\n%s", buf.String())
+	}
+}
+
+func TestGRPCMetrics(t *testing.T) {
+	interceptor := MetricsUnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	before := grpcHandled.Value(info.FullMethod, "NotFound")
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("unknown")
+	})
+
+	if v := grpcHandled.Value(info.FullMethod, "NotFound") - before; v != 1 {
+		t.Fatalf("expected 1 NotFound call, got %v", v)
+	}
+	if grpcHandled.Value(info.FullMethod, "Unknown") < 1 {
+		t.Fatal("expected Unknown call")
+	}
+}
@@ -4,7 +4,11 @@
 
 package framework
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"sync"
+)
 
 const (
 	// DebugMode - set the framework in debug mode.
@@ -15,27 +19,127 @@ const (
 	TestMode string = "test"
 )
 
-var currentMode = DebugMode
+// ModeProfile declares the framework behaviors of a mode, see RegisterMode.
+type ModeProfile struct {
+	// Extends is the parent mode, its config file is loaded before the mode one.
+	Extends string
+	// Banner logs the application name and version at startup.
+	Banner bool
+	// Verbose logs the routes and the services registered at startup.
+	Verbose bool
+	// DebugErrors responds to the 500 errors and panics with the error and the stack trace.
+	DebugErrors bool
+	// ReloadTemplates parses the views again when they change.
+	ReloadTemplates bool
+	// LogLevel is the log level used without log_level.
+	LogLevel Level
+}
+
+var (
+	modesMu sync.RWMutex
+	modes   = map[string]ModeProfile{
+		DebugMode:      {Banner: true, Verbose: true, DebugErrors: true, ReloadTemplates: true, LogLevel: DEBUG},
+		ProductionMode: {LogLevel: INFO},
+		TestMode:       {LogLevel: DEBUG},
+	}
+	currentMode = DebugMode
+)
 
 func init() {
-	mode := os.Getenv("FRAMEWORK_MODE")
-	if mode == "" {
-		SetMode(DebugMode)
-	} else {
-		SetMode(mode)
+	// The modes registered by the application are set by Init, see configMode.
+	if mode := os.Getenv("FRAMEWORK_MODE"); mode != "" {
+		_ = SetMode(mode)
+	}
+}
+
+// configMode returns the mode of the "mode" configuration key or else of FRAMEWORK_MODE,
+// empty when both are unset.
+func configMode(config Configuration) string {
+	if config, ok := config.(*ConfigData); ok && config.Source("mode").Layer != ConfigDefault {
+		return config.String("mode")
 	}
+	return os.Getenv("FRAMEWORK_MODE")
 }
 
-// SetMode change the current mode.
-func SetMode(value string) {
-	if value == DebugMode || value == ProductionMode || value == TestMode {
-		currentMode = value
-	} else {
-		currentMode = DebugMode
+// RegisterMode registers the mode name extending parent: its profile is a copy of
+// the parent profile changed by configure, which can be nil.
+// f.e. RegisterMode("staging", ProductionMode, func(p *ModeProfile) { p.Banner = true })
+// Register the modes before Init, which sets the mode of FRAMEWORK_MODE or of the configuration.
+func RegisterMode(name, parent string, configure func(*ModeProfile)) error {
+	modesMu.Lock()
+	defer modesMu.Unlock()
+
+	if name == "" {
+		return fmt.Errorf("mode: empty name")
+	}
+	if _, ok := modes[name]; ok {
+		return fmt.Errorf("mode: %s already registered", name)
+	}
+
+	profile, ok := modes[parent]
+	if !ok {
+		return fmt.Errorf("mode: unknown parent mode %s", parent)
 	}
+
+	profile.Extends = parent
+	if configure != nil {
+		configure(&profile)
+		profile.Extends = parent
+	}
+
+	modes[name] = profile
+	return nil
+}
+
+// SetMode change the current mode, the mode must be registered.
+func SetMode(value string) error {
+	modesMu.Lock()
+	defer modesMu.Unlock()
+
+	if _, ok := modes[value]; !ok {
+		return fmt.Errorf("mode: unknown mode %s", value)
+	}
+
+	currentMode = value
+	return nil
 }
 
 // Mode retreives the current mode.
 func Mode() string {
+	modesMu.RLock()
+	defer modesMu.RUnlock()
+
 	return currentMode
 }
+
+// Profile returns the profile of the current mode.
+func Profile() ModeProfile {
+	modesMu.RLock()
+	defer modesMu.RUnlock()
+
+	return modes[currentMode]
+}
+
+// IsMode reports whether the current mode is name or extends it,
+// f.e. IsMode(ProductionMode) is true in a staging mode extending production.
+func IsMode(name string) bool {
+	for _, mode := range modeChain(Mode()) {
+		if mode == name {
+			return true
+		}
+	}
+	return false
+}
+
+// modeChain returns the mode and its ancestors, the root first.
+// Unregistered modes have no ancestors.
+func modeChain(name string) []string {
+	modesMu.RLock()
+	defer modesMu.RUnlock()
+
+	chain := []string{name}
+	for profile, ok := modes[name]; ok && profile.Extends != ""; profile, ok = modes[profile.Extends] {
+		chain = append([]string{profile.Extends}, chain...)
+	}
+	return chain
+}
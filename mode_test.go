@@ -0,0 +1,208 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withMode registers the staging mode extending production and sets mode until the test ends.
+func withMode(t *testing.T, mode string) {
+	if err := RegisterMode("staging", ProductionMode, func(p *ModeProfile) {
+		p.Banner = true
+		p.Extends = "ignored"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMode(mode); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = SetMode(TestMode)
+		modesMu.Lock()
+		delete(modes, "staging")
+		modesMu.Unlock()
+	})
+}
+
+func TestRegisterMode(t *testing.T) {
+	withMode(t, "staging")
+
+	if Mode() != "staging" || !IsMode("staging") || !IsMode(ProductionMode) || IsMode(DebugMode) {
+		t.Fatalf("unexpected mode %s", Mode())
+	}
+
+	profile := Profile()
+	if profile.Extends != ProductionMode || !profile.Banner || profile.DebugErrors || profile.LogLevel != INFO {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+
+	if err := RegisterMode("staging", DebugMode, nil); err == nil {
+		t.Error("expected an error registering a mode twice")
+	}
+	if err := RegisterMode("qa", "unknown", nil); err == nil {
+		t.Error("expected an error with an unknown parent")
+	}
+
+	if err := SetMode("unknown"); err == nil || Mode() != "staging" {
+		t.Fatalf("expected an error and the mode unchanged, got %v %s", err, Mode())
+	}
+
+	if got := strings.Join(modeChain("staging"), ","); got != "production,staging" {
+		t.Fatalf("unexpected chain %s", got)
+	}
+}
+
+func TestModeConfigFiles(t *testing.T) {
+	withMode(t, TestMode)
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "app.json", `{"name": "app", "port": 8000, "log_level": "debug"}`)
+	writeConfigFile(t, dir, "app.production.json", `{"port": 80, "log_level": "warning"}`)
+	writeConfigFile(t, dir, "app.staging.json", `{"port": 8080}`)
+
+	config, err := (&ConfigLoader{Path: path, Mode: "staging"}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Int("port") != 8080 || config.String("log_level") != "warning" || config.String("name") != "app" {
+		t.Fatalf("unexpected config %v", config)
+	}
+	if len(config.files) != 3 {
+		t.Fatalf("unexpected watched files %v", config.files)
+	}
+}
+
+func TestModeInit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "app.json", `{"name": "app", "port": 8000}`)
+	writeConfigFile(t, dir, "app.production.json", `{"port": 80, "log_level": "warning"}`)
+	writeConfigFile(t, dir, "app.staging.json", `{"log_level": "error"}`)
+
+	config, log := Config, Log
+	t.Setenv("FRAMEWORK_MODE", "staging")
+
+	// The package init: the application hasn't registered staging yet.
+	engine := New()
+	Config = LoadConfig(path)
+	t.Cleanup(func() {
+		close(engine.done)
+		Config, Log = config, log
+	})
+	if Config.Int("port") != 8000 {
+		t.Fatalf("unexpected port %d", Config.Int("port"))
+	}
+
+	withMode(t, DebugMode)
+	engine.Init()
+
+	if Mode() != "staging" || !IsMode(ProductionMode) {
+		t.Fatalf("unexpected mode %s", Mode())
+	}
+	// The production file is layered before the staging one, the static keys included.
+	if Config.Int("port") != 80 || Config.String("log_level") != "error" || Config.String("name") != "app" {
+		t.Fatalf("unexpected config %v", Config)
+	}
+}
+
+func TestModeProfile(t *testing.T) {
+	withMode(t, DebugMode)
+
+	r := NewRouter()
+	r.Add("/error", "GET", func(c *Context) {
+		c.Error(http.StatusInternalServerError, errors.New("<db> failed"))
+	})
+	r.Add("/panic", "GET", func(c *Context) {
+		panic("boom")
+	})
+
+	for path, want := range map[string]string{"/error": "&lt;db&gt; failed", "/panic": "boom"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), want) ||
+			!strings.Contains(w.Body.String(), "goroutine") {
+			t.Errorf("%s: unexpected response %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	// Production hides the stack trace.
+	_ = SetMode(ProductionMode)
+
+	req, _ := http.NewRequest("GET", "/error", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Body.String() != "<db> failed" {
+		t.Errorf("unexpected response %s", w.Body.String())
+	}
+}
+
+func TestViewReload(t *testing.T) {
+	withMode(t, DebugMode)
+
+	dir, err := ioutil.TempDir("", "views")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	index := filepath.Join(dir, "index.html")
+	if err := ioutil.WriteFile(index, []byte(`v1 {{ template "footer" }}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	view, err := NewView(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := view.Parse("footer", []byte("footer")); err != nil {
+		t.Fatal(err)
+	}
+
+	render := func() string {
+		var buf bytes.Buffer
+		if err := view.Render(&buf, "index", nil); err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(buf.String())
+	}
+
+	if got := render(); got != "v1 footer" {
+		t.Fatalf("unexpected render %q", got)
+	}
+
+	if err := ioutil.WriteFile(index, []byte(`v2 {{ template "footer" }}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(index, future, future)
+
+	if got := render(); got != "v2 footer" {
+		t.Fatalf("unexpected render after change %q", got)
+	}
+}
@@ -5,9 +5,11 @@
 package framework
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 type (
@@ -19,24 +21,241 @@ type (
 		// JsonRaw contains the raw json message.
 		JSONRaw string
 	}
+
+	// forwardedElement is a single hop of the RFC 7239 Forwarded header.
+	forwardedElement struct {
+		For   string
+		Proto string
+		Host  string
+	}
 )
 
-func (r *Request) IP() string {
-	// cloudflare: cf-connecting-ip
-	if cf := r.Header.Get("cf-connecting-ip"); cf != "" {
-		cf = strings.Split(cf, ",")[0]
-		if cf != "" {
-			return cf
+var (
+	trustedProxiesMu sync.RWMutex
+	trustedProxies   []*net.IPNet
+)
+
+// SetTrustedProxies sets the proxies allowed to provide the client IP, scheme and host
+// through the Forwarded and X-Forwarded-* headers.
+// Each value is a CIDR (10.0.0.0/8) or a single IP address.
+// It's called on Init with the trusted_proxies config value.
+func SetTrustedProxies(proxies ...string) error {
+	var nets []*net.IPNet
+
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("trusted proxies: invalid address %s", proxy)
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("trusted proxies: %v", err)
 		}
+		nets = append(nets, n)
 	}
 
-	// x-forwarded-for: client, proxy1, proxy2, ...
-	if proxy := r.Header.Get("x-forwarded-for"); proxy != "" {
-		proxy = strings.Split(proxy, ",")[0]
-		if proxy != "" {
-			return proxy
+	trustedProxiesMu.Lock()
+	trustedProxies = nets
+	trustedProxiesMu.Unlock()
+
+	return nil
+}
+
+// isTrustedProxy reports whether ip belongs to the trusted proxies.
+func isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
 		}
 	}
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	return false
+}
+
+// remoteIP returns the IP of the direct peer.
+func (r *Request) remoteIP() string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
 	return ip
 }
+
+// fromTrustedProxy reports whether the direct peer is a trusted proxy.
+func (r *Request) fromTrustedProxy() bool {
+	return isTrustedProxy(net.ParseIP(r.remoteIP()))
+}
+
+// IP returns the client IP address.
+//
+// Forwarding headers are only read when the request comes from a trusted proxy (trusted_proxies).
+// The Forwarded (RFC 7239) or X-Forwarded-For chain is read right to left, skipping
+// trusted hops: the first untrusted address is the client.
+// If client_ip_header is configured (f.e. CF-Connecting-IP), that header is used instead.
+func (r *Request) IP() string {
+	remote := r.remoteIP()
+	if !isTrustedProxy(net.ParseIP(remote)) {
+		return remote
+	}
+
+	if header := Config.String("client_ip_header"); header != "" {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get(header))); ip != nil {
+			return ip.String()
+		}
+	}
+
+	var chain []string
+
+	if forwarded := r.forwarded(); len(forwarded) > 0 {
+		for _, element := range forwarded {
+			chain = append(chain, element.For)
+		}
+	} else {
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			chain = append(chain, strings.Split(value, ",")...)
+		}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseForwardedIP(chain[i])
+		if ip == nil {
+			// Unknown or obfuscated hop, we can't go further.
+			break
+		}
+		if !isTrustedProxy(ip) || i == 0 {
+			return ip.String()
+		}
+	}
+
+	return remote
+}
+
+// Scheme returns the request scheme, http or https.
+// Forwarded proto and X-Forwarded-Proto are only read from trusted proxies.
+func (r *Request) Scheme() string {
+	if r.fromTrustedProxy() {
+		if forwarded := r.forwarded(); len(forwarded) > 0 {
+			if proto := strings.ToLower(forwarded[len(forwarded)-1].Proto); proto == "http" || proto == "https" {
+				return proto
+			}
+		} else if proto := strings.ToLower(lastValue(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			return proto
+		}
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host returns the host requested by the client.
+// Forwarded host and X-Forwarded-Host are only read from trusted proxies.
+func (r *Request) Host() string {
+	if r.fromTrustedProxy() {
+		if forwarded := r.forwarded(); len(forwarded) > 0 {
+			if host := forwarded[len(forwarded)-1].Host; host != "" {
+				return host
+			}
+		} else if host := lastValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+			return host
+		}
+	}
+
+	return r.Request.Host
+}
+
+// forwarded parses the RFC 7239 Forwarded headers.
+func (r *Request) forwarded() []forwardedElement {
+	var elements []forwardedElement
+
+	for _, value := range r.Header.Values("Forwarded") {
+		for _, part := range splitQuoted(value, ',') {
+			var element forwardedElement
+
+			for _, pair := range splitQuoted(part, ';') {
+				i := strings.Index(pair, "=")
+				if i == -1 {
+					continue
+				}
+
+				key := strings.ToLower(strings.TrimSpace(pair[:i]))
+				v := strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+
+				switch key {
+				case "for":
+					element.For = v
+				case "proto":
+					element.Proto = v
+				case "host":
+					element.Host = v
+				}
+			}
+
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
+}
+
+// splitQuoted splits s by sep, ignoring separators inside quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// parseForwardedIP parses a node from X-Forwarded-For or Forwarded for=,
+// accepting "1.2.3.4", "1.2.3.4:80", "2001:db8::1" and "[2001:db8::1]:80".
+func parseForwardedIP(node string) net.IP {
+	node = strings.TrimSpace(node)
+
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return net.ParseIP(host)
+	}
+
+	return net.ParseIP(strings.Trim(node, "[]"))
+}
+
+// lastValue returns the last element of a comma separated header value,
+// the one added by the nearest proxy.
+func lastValue(value string) string {
+	if i := strings.LastIndex(value, ","); i != -1 {
+		value = value[i+1:]
+	}
+	return strings.TrimSpace(value)
+}
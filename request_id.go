@@ -0,0 +1,141 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderRequestID is the HTTP header (and gRPC metadata key) carrying the request ID.
+const HeaderRequestID = "X-Request-ID"
+
+type (
+	requestIDKey struct{}
+
+	// requestIDStream overrides the stream context with the request ID context.
+	requestIDStream struct {
+		grpc.ServerStream
+		ctx context.Context
+	}
+)
+
+// RequestID returns a middleware that reads the X-Request-ID header, or creates a new ID,
+// and stores it on the Context and in the response headers.
+// Use it globally, before other middlewares, to have the ID available on every log line:
+//
+//	framework.Use(framework.RequestID())
+func RequestID() HandlerFunc {
+	return func(c *Context) {
+		id := c.Request.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+
+		c.Request.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Header(HeaderRequestID, id)
+	}
+}
+
+// RequestID returns the request ID set by the RequestID middleware.
+func (c *Context) RequestID() string {
+	return RequestIDFromContext(c)
+}
+
+// NewRequestID returns a new random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts client IDs of printable ASCII characters up to 128 bytes,
+// anything else could be used to inject data in logs and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= 0x20 || id[i] >= 0x7F {
+			return false
+		}
+	}
+
+	return true
+}
+
+// grpcRequestID reads the request ID from the incoming metadata, or creates a new one,
+// and sends it back to the client in the response header.
+func grpcRequestID(ctx context.Context) context.Context {
+	var id string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(HeaderRequestID); len(values) > 0 {
+			id = values[0]
+		}
+	}
+
+	if !validRequestID(id) {
+		id = NewRequestID()
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(HeaderRequestID, id))
+
+	return WithRequestID(ctx, id)
+}
+
+// RequestIDUnaryInterceptor propagates the x-request-id metadata on unary calls.
+//
+//	framework.UseGRPCUnaryInterceptor(framework.RequestIDUnaryInterceptor())
+func RequestIDUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(grpcRequestID(ctx), req)
+	}
+}
+
+// RequestIDStreamInterceptor propagates the x-request-id metadata on streams.
+//
+//	framework.UseGRPCStreamInterceptor(framework.RequestIDStreamInterceptor())
+func RequestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &requestIDStream{ServerStream: stream, ctx: grpcRequestID(stream.Context())})
+	}
+}
+
+// RequestIDClientInterceptor adds the request ID found in ctx to outgoing gRPC calls.
+//
+//	conn, err := grpc.Dial(addr, grpc.WithUnaryInterceptor(framework.RequestIDClientInterceptor()))
+func RequestIDClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := RequestIDFromContext(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, HeaderRequestID, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// Context returns the stream context carrying the request ID.
+func (s *requestIDStream) Context() context.Context {
+	return s.ctx
+}
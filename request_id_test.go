@@ -0,0 +1,74 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"propagated", "abc-123", true},
+		{"invalid", "abc\r\nX-Injected: 1", false},
+	}
+
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if tt.incoming != "" {
+			r.Header.Set(HeaderRequestID, tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		c := NewContext(NewResponseWriter(w), &Request{Request: r})
+
+		RequestID()(c)
+
+		id := c.RequestID()
+		if id == "" || (id == tt.incoming) != tt.keep {
+			t.Errorf("%s: RequestID() = %q", tt.name, id)
+		}
+		if w.Header().Get(HeaderRequestID) != id {
+			t.Errorf("%s: response header = %q, want %q", tt.name, w.Header().Get(HeaderRequestID), id)
+		}
+		if l := c.Log(); len(l.fields) != 1 || l.fields[0].Value != id {
+			t.Errorf("%s: Log() fields = %v", tt.name, l.fields)
+		}
+	}
+}
+
+func TestRequestIDUnaryInterceptor(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "grpc-1"))
+
+	var got string
+	_, _ = RequestIDUnaryInterceptor()(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = RequestIDFromContext(ctx)
+		return nil, nil
+	})
+
+	if got != "grpc-1" {
+		t.Fatalf("interceptor request ID = %q", got)
+	}
+
+	var outgoing metadata.MD
+	_ = RequestIDClientInterceptor()(WithRequestID(context.Background(), "grpc-1"), "/test", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			outgoing, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		})
+
+	if values := outgoing.Get(HeaderRequestID); len(values) != 1 || values[0] != "grpc-1" {
+		t.Fatalf("client interceptor metadata = %v", outgoing)
+	}
+}
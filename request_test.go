@@ -0,0 +1,76 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequestIP(t *testing.T) {
+	if err := SetTrustedProxies("10.0.0.0/8", "192.168.1.1", "2001:db8::/32"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies()
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "203.0.113.1:1234", nil, "203.0.113.1"},
+		{"spoofed from untrusted", "203.0.113.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1", "CF-Connecting-IP": "1.1.1.1"}, "203.0.113.1"},
+		{"trusted proxy", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"spoofed first hop", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 192.168.1.1"}, "198.51.100.7"},
+		{"all trusted", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"forwarded", "10.0.0.1:1234", map[string]string{"Forwarded": `for=1.1.1.1, for="[2001:db9::17]:4711";proto=https, for=10.0.0.2`}, "2001:db9::17"},
+		{"forwarded unknown", "10.0.0.1:1234", map[string]string{"Forwarded": "for=unknown"}, "10.0.0.1"},
+		{"ipv6 proxy", "[2001:db8::1]:443", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+
+		if got := (&Request{Request: r}).IP(); got != tt.want {
+			t.Errorf("%s: IP() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if err := SetTrustedProxies("invalid"); err == nil {
+		t.Error("SetTrustedProxies() accepted an invalid address")
+	}
+}
+
+func TestRequestSchemeHost(t *testing.T) {
+	if err := SetTrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies()
+
+	r, _ := http.NewRequest("GET", "http://internal:8080/", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "example.com")
+	req := &Request{Request: r}
+
+	r.RemoteAddr = "203.0.113.1:1234"
+	if req.Scheme() != "http" || req.Host() != "internal:8080" {
+		t.Errorf("untrusted: Scheme() = %s, Host() = %s", req.Scheme(), req.Host())
+	}
+
+	r.RemoteAddr = "10.0.0.1:1234"
+	if req.Scheme() != "https" || req.Host() != "example.com" {
+		t.Errorf("trusted: Scheme() = %s, Host() = %s", req.Scheme(), req.Host())
+	}
+
+	r.Header.Set("Forwarded", `for=198.51.100.7;proto=http;host="forwarded.example.com"`)
+	if req.Scheme() != "http" || req.Host() != "forwarded.example.com" {
+		t.Errorf("forwarded: Scheme() = %s, Host() = %s", req.Scheme(), req.Host())
+	}
+}
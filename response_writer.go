@@ -21,10 +21,17 @@ type (
 		Before(BeforeFunc)
 		Status() int
 	}
+	// ResponseSizer is implemented by the ResponseWriters counting the bytes written
+	// to the response body, like the one of NewResponseWriter.
+	ResponseSizer interface {
+		// Size returns the number of bytes written to the response body.
+		Size() int
+	}
 	responseWriter struct {
 		http.ResponseWriter
 		beforeFuncs []BeforeFunc
 		status      int
+		size        int
 	}
 	// BeforeFunc defines a function called before the end of response.
 	BeforeFunc func(ResponseWriter)
@@ -32,7 +39,7 @@ type (
 
 // NewResponseWriter creates a ResponseWriter that wraps an http.ResponseWriter
 func NewResponseWriter(rw http.ResponseWriter) ResponseWriter {
-	return &responseWriter{rw, nil, 0}
+	return &responseWriter{ResponseWriter: rw}
 }
 
 // WriteHeader writes a custom status code to header.
@@ -42,6 +49,13 @@ func (rw *responseWriter) WriteHeader(s int) {
 	rw.ResponseWriter.WriteHeader(s)
 }
 
+// Write writes the data and counts the written bytes.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
 // Before add a BeforeFunc to the functions called before the end of response.
 func (rw *responseWriter) Before(before BeforeFunc) {
 	rw.beforeFuncs = append(rw.beforeFuncs, before)
@@ -52,6 +66,19 @@ func (rw *responseWriter) Status() int {
 	return rw.status
 }
 
+// Size returns the number of bytes written to the response body.
+func (rw *responseWriter) Size() int {
+	return rw.size
+}
+
+// responseSize returns the number of bytes written to the body of rw, 0 without ResponseSizer.
+func responseSize(rw ResponseWriter) int {
+	if s, ok := rw.(ResponseSizer); ok {
+		return s.Size()
+	}
+	return 0
+}
+
 func (rw *responseWriter) callBefore() {
 	for i := len(rw.beforeFuncs) - 1; i >= 0; i-- {
 		rw.beforeFuncs[i](rw)
@@ -66,3 +93,10 @@ func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	}
 	return hj.Hijack()
 }
+
+// Flush sends any buffered data to the client (required for streaming responses)
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
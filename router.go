@@ -13,6 +13,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +36,7 @@ type (
 
 	// Route contain the single route structure
 	Route struct {
+		pattern  string
 		method   string
 		regex    *regexp.Regexp
 		params   map[int]string
@@ -66,6 +68,7 @@ func (r *Routes) Add(pattern string, method string, handlers ...HandlerFunc) {
 		Log.Error(errors.New("please enter a valid method"))
 	}
 
+	original := pattern
 	parts := strings.Split(pattern, "/")
 
 	// Update dynamic parts that contains a : with a regexp
@@ -95,12 +98,13 @@ func (r *Routes) Add(pattern string, method string, handlers ...HandlerFunc) {
 	}
 
 	route := &Route{}
+	route.pattern = original
 	route.method = method
 	route.regex = regex
 	route.handlers = reverseHandlers
 	route.params = params
 
-	if Mode() == DebugMode {
+	if Profile().Verbose {
 		Log.Info(fmt.Sprintf("Adding route [%s] %s", method, pattern))
 	}
 
@@ -111,36 +115,59 @@ func (r *Routes) Add(pattern string, method string, handlers ...HandlerFunc) {
 func (r *Routes) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	c := App.pool.Get(NewResponseWriter(rw), &Request{Request: req})
 	defer App.pool.Put(c)
+	defer c.callAfter()
 
 	// Recover
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Println(r)
+
+			if Profile().DebugErrors && c.Response.Status() == 0 && responseSize(c.Response) == 0 {
+				c.debugError(http.StatusInternalServerError, r, debug.Stack())
+			}
 		}
 	}()
 
 	path := req.URL.Path
 	routeFound := false
 
+	// The health probes skip the global middlewares, f.e. the authentication and the timeouts.
+	if probe := App.probes[path]; probe != nil && (req.Method == "GET" || req.Method == "HEAD") {
+		probe(c)
+		return
+	}
+
 	language := c.Request.Header.Get("Accept-Language")
 	if language != "" && strings.Contains(language, ",") {
 		language = language[:strings.Index(language, ",")]
 	}
 	c.I18n = i18n.New(language)
 
-	// Execute global middlewares
-	for _, filter := range App.middlewares {
-		filter(c)
+	// Global request timeout
+	if timeout := Config.Duration("request_timeout"); timeout > 0 {
+		c.SetTimeout(timeout)
+	}
 
-		// Manage middleware error (f.e. BasicAuth error)
-		if c.Response.Status() != 0 {
-			return
-		}
+	// Tracing
+	if Tracing.Enabled() {
+		c.startRequestSpan()
+	}
+
+	// Execute global middlewares
+	span := c.startSpan("middleware")
+	next := executeHandlers(c, App.middlewares)
+	c.endSpan(span)
+	if !next {
+		return
 	}
 
 	// Check if requested path is a static file.
+	routing := c.startSpan("routing")
+	defer c.endSpan(routing)
+
 	servedStatic := r.ServeStaticFiles(c)
 	if servedStatic {
+		c.static = true
 		return
 	}
 
@@ -177,13 +204,14 @@ func (r *Routes) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 
 		// Route found, invoke handler(s)
-		for _, handler := range route.handlers {
-			handler(c)
+		c.route = route.pattern
+		c.endSpan(routing)
 
-			// Manage http errors
-			if c.Response.Status() != 0 {
-				return
-			}
+		span = c.startSpan("handler")
+		next = executeHandlers(c, route.handlers)
+		c.endSpan(span)
+		if !next {
+			return
 		}
 		routeFound = true
 	}
@@ -210,8 +238,12 @@ func (r *Routes) ServeStaticFiles(c *Context) bool {
 			var css string
 			req = "file:" + req
 
-			// If file is not already cached: read, minify and put in cache
-			if !App.cache.Exists(req) {
+			// If file is not already cached: read, minify and put in cache.
+			// A single Lookup, the value can expire or be evicted between two calls.
+			v, _ := c.Cache().Lookup(req)
+			if s, ok := v.(string); ok {
+				css = s
+			} else {
 				filePath, fileInfo, _ := lookupFile(c.Request.URL.Path)
 				if fileInfo == nil {
 					// TODO: Logger should log this as an error
@@ -225,9 +257,7 @@ func (r *Routes) ServeStaticFiles(c *Context) bool {
 				css = MinifyCSS(data)
 
 				// Store in cache for one day
-				_ = App.cache.Put(req, css, 3600*24*time.Second)
-			} else {
-				css = App.cache.Get(req).(string)
+				_ = c.Cache().Put(req, css, 3600*24*time.Second)
 			}
 
 			r := strings.NewReader(css)
@@ -245,8 +275,12 @@ func (r *Routes) ServeStaticFiles(c *Context) bool {
 			var js string
 			req = "file:" + req
 
-			// If file is not already cached: read, minify and put in cache
-			if !App.cache.Exists(req) {
+			// If file is not already cached: read, minify and put in cache.
+			// A single Lookup, the value can expire or be evicted between two calls.
+			v, _ := c.Cache().Lookup(req)
+			if s, ok := v.(string); ok {
+				js = s
+			} else {
 				filePath, fileInfo, _ := lookupFile(c.Request.URL.Path)
 				if fileInfo == nil {
 					// TODO: Logger should log this as an error
@@ -260,9 +294,7 @@ func (r *Routes) ServeStaticFiles(c *Context) bool {
 				js = MinifyJS(data)
 
 				// Store in cache for one day
-				_ = App.cache.Put(req, js, 3600*24*time.Second)
-			} else {
-				js = App.cache.Get(req).(string)
+				_ = c.Cache().Put(req, js, 3600*24*time.Second)
 			}
 
 			r := strings.NewReader(js)
@@ -148,26 +148,13 @@ func DecodeCookie(key []byte, maxlifetime int, signedValue string, req *http.Req
 }
 
 func createSignature(req *http.Request) string {
-	ip, _, err := net.SplitHostPort(req.RemoteAddr)
-	if err != nil {
-		return ""
-	}
-
-	userIP := net.ParseIP(ip)
-	if userIP == nil {
+	// The client IP is resolved from forwarding headers only when sent by a trusted proxy.
+	ip := net.ParseIP((&Request{Request: req}).IP())
+	if ip == nil {
 		return ""
 	}
 
-	// This will only be defined when site is accessed via non-anonymous proxy
-	// and takes precedence over RemoteAddr
-	// Header.Get is case-insensitive
-	forward := req.Header.Get("X-Forwarded-For")
-
-	if forward != "" {
-		ip = forward
-	}
-
-	return ip + "/" + req.Header.Get("user-agent")
+	return ip.String() + "/" + req.Header.Get("user-agent")
 }
 
 // GetSessionID return the cookie from http request.
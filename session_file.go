@@ -5,6 +5,7 @@
 package framework
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -254,6 +255,39 @@ func (fsp *FileSessionProvider) SessionID() string {
 	return fsp.sessionID
 }
 
+// Count returns the number of active (not expired) sessions.
+func (fsp *FileSessionProvider) Count() int {
+	files, err := ioutil.ReadDir(fsp.config.SavePath)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, info := range files {
+		if !info.IsDir() && info.ModTime().Unix()+int64(fsp.config.MaxLifetime) >= time.Now().Unix() {
+			count++
+		}
+	}
+	return count
+}
+
+// HealthCheck checks that the sessions directory is writable.
+func (fsp *FileSessionProvider) HealthCheck(ctx context.Context) error {
+	f, err := ioutil.TempFile(fsp.config.SavePath, ".health")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write([]byte("ok"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
 // GC clean expired sessions.
 func (fsp *FileSessionProvider) GC() {
 	time.AfterFunc(time.Duration(fsp.config.MaxLifetime)*time.Second, func() {
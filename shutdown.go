@@ -0,0 +1,139 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Shutdown gracefully stops the application servers, see Engine.Shutdown.
+func Shutdown(ctx context.Context) error {
+	return App.Shutdown(ctx)
+}
+
+// Shutdown gracefully stops the servers started with Run, RunTLS and RunGRPC:
+// the readiness endpoint and the gRPC health service start failing, after shutdown_delay
+// seconds the listeners are closed and the in-flight requests are completed until ctx is done.
+// Pending traces are exported and the cache is closed.
+// Run, RunTLS and RunGRPC call it on SIGINT and SIGTERM, with a shutdown_timeout seconds
+// deadline (30 by default).
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&engine.shuttingDown, 0, 1) {
+		select {
+		case <-engine.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+	defer close(engine.done)
+
+	Log.Info("shutting down")
+
+	if engine.GRPCServer != nil {
+		engine.GRPCServer.health.Shutdown()
+	}
+
+	// Leave time to the load balancers to notice the failing readiness.
+	if delay := Config.Duration("shutdown_delay"); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	var err error
+
+	engine.serversMu.Lock()
+	servers := engine.servers
+	engine.serversMu.Unlock()
+
+	for _, server := range servers {
+		if serr := server.Shutdown(ctx); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	if engine.GRPCServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			engine.GRPCServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			engine.GRPCServer.Stop()
+			if err == nil {
+				err = ctx.Err()
+			}
+		}
+	}
+
+	if terr := Tracing.Close(); terr != nil {
+		Log.Error(terr)
+	}
+
+	if closer, ok := engine.cache.(io.Closer); ok {
+		if cerr := closer.Close(); cerr != nil {
+			Log.Error(cerr)
+		}
+	}
+
+	return err
+}
+
+// ShuttingDown reports whether Shutdown has been called.
+func (engine *Engine) ShuttingDown() bool {
+	return atomic.LoadInt32(&engine.shuttingDown) == 1
+}
+
+// serve runs the server until it fails or it is shut down.
+// listen is f.e. server.ListenAndServe.
+func (engine *Engine) serve(server *http.Server, listen func() error) {
+	engine.serversMu.Lock()
+	engine.servers = append(engine.servers, server)
+	engine.serversMu.Unlock()
+
+	if err := listen(); err != http.ErrServerClosed {
+		Log.Error(err)
+		return
+	}
+
+	// Wait for the in-flight requests.
+	<-engine.done
+}
+
+// handleSignals calls Shutdown on SIGINT or SIGTERM.
+func (engine *Engine) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	sig := <-signals
+	signal.Stop(signals)
+
+	Log.Info(fmt.Sprintf("received %s", sig))
+
+	timeout := 30 * time.Second
+	if d := Config.Duration("shutdown_timeout"); d > 0 {
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := engine.Shutdown(ctx); err != nil {
+		Log.Error(err)
+	}
+}
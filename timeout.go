@@ -0,0 +1,208 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// timeoutWriter guards the ResponseWriter while handlers run under a deadline.
+	// After the deadline expires every write returns http.ErrHandlerTimeout.
+	timeoutWriter struct {
+		ResponseWriter
+
+		mu          sync.Mutex
+		header      http.Header
+		status      int
+		wroteHeader bool
+		timedOut    bool
+	}
+)
+
+// Timeout returns a middleware that interrupts the following handlers after d.
+// It can be used globally with Use or as the first handler of a route:
+//
+//	Use(framework.Timeout(10 * time.Second))
+//	c.GET("/report", framework.Timeout(30*time.Second), ReportController.Get)
+//
+// On timeout the client receives a 503 and the Context is cancelled.
+// Set request_timeout (seconds) in app.json to apply a timeout to every route.
+func Timeout(d time.Duration) HandlerFunc {
+	return func(c *Context) {
+		c.SetTimeout(d)
+	}
+}
+
+// executeHandlers invokes the handlers in order until one of them writes the response status.
+// It returns false if the chain has been interrupted.
+func executeHandlers(c *Context, handlers []HandlerFunc) bool {
+	for i, handler := range handlers {
+		if _, guarded := c.Response.(*timeoutWriter); c.cancel != nil && !guarded {
+			return executeWithTimeout(c, handlers[i:])
+		}
+
+		handler(c)
+
+		// Manage http errors (f.e. BasicAuth error)
+		if c.Response.Status() != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// executeWithTimeout runs the handlers in a new goroutine and waits for them or for the
+// request deadline. When the deadline wins, a 503 is sent and the context is detached
+// from the pool since the handlers may still be using it.
+func executeWithTimeout(c *Context, handlers []HandlerFunc) bool {
+	tw := &timeoutWriter{ResponseWriter: c.Response, header: make(http.Header)}
+	for k, v := range c.Response.Header() {
+		tw.header[k] = v
+	}
+	c.Response = tw
+
+	done := make(chan bool, 1)
+	panicked := make(chan interface{}, 1)
+	// Read before the handlers change the request, f.e. with their spans.
+	deadline := c.Done()
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		done <- executeHandlers(c, handlers)
+	}()
+
+	select {
+	case p := <-panicked:
+		c.Response = tw.ResponseWriter
+		panic(p)
+	case next := <-done:
+		c.Response = tw.ResponseWriter
+		tw.copyHeader()
+		return next
+	case <-deadline:
+		tw.timeout()
+		c.detach()
+		return false
+	}
+}
+
+// detach leaves the context to the timed out handlers: it's not reused by the pool
+// and their spans don't change its request anymore.
+func (c *Context) detach() {
+	c.detachMu.Lock()
+	c.detached = true
+	c.detachMu.Unlock()
+}
+
+// Header returns the header map used by the handlers.
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader writes the status code unless the handler timed out.
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	tw.copyHeader()
+	tw.wroteHeader = true
+	tw.status = code
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// copyHeader copies the handlers header map to the underlying ResponseWriter.
+func (tw *timeoutWriter) copyHeader() {
+	dst := tw.ResponseWriter.Header()
+	for k := range dst {
+		if _, ok := tw.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+}
+
+// Write writes the data unless the handler timed out.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.copyHeader()
+		tw.wroteHeader = true
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Status returns the status written by the handlers.
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	return tw.status
+}
+
+// Size returns the number of bytes written by the handlers.
+func (tw *timeoutWriter) Size() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	return responseSize(tw.ResponseWriter)
+}
+
+// Flush flushes the written data unless the handler timed out.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok && !tw.timedOut {
+		f.Flush()
+	}
+}
+
+// Hijack is not supported under a timeout.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijacking is not supported with a request timeout")
+}
+
+// timeout sends the 503 response, if nothing has been written yet, and blocks further writes.
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.wroteHeader {
+		h := tw.ResponseWriter.Header()
+		for k := range h {
+			delete(h, k)
+		}
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		tw.status = http.StatusServiceUnavailable
+		tw.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = tw.ResponseWriter.Write([]byte(http.StatusText(http.StatusServiceUnavailable)))
+	}
+	tw.timedOut = true
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	cancelled := make(chan error, 1)
+	written := make(chan error, 1)
+	release := make(chan struct{})
+
+	r := NewRouter()
+	r.Add("/slow", "GET", Timeout(20*time.Millisecond), func(c *Context) {
+		<-c.Done()
+		cancelled <- c.Err()
+
+		// Write once the 503 has been sent.
+		<-release
+		_, err := c.Response.Write([]byte("too late"))
+		written <- err
+	})
+	r.Add("/fast", "GET", Timeout(time.Second), func(c *Context) {
+		c.Header("X-Test", "1")
+		c.Plain(http.StatusOK, "ok")
+	})
+
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("slow handler returned %d, want 503", w.Code)
+	}
+
+	select {
+	case err := <-cancelled:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Context.Err() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler context not cancelled")
+	}
+
+	close(release)
+	if err := <-written; err != http.ErrHandlerTimeout {
+		t.Fatalf("write after timeout error = %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "/fast", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "ok" || w.Header().Get("X-Test") != "1" {
+		t.Fatalf("fast handler returned %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestContextValue(t *testing.T) {
+	type key struct{}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), key{}, "request"))
+	c := NewContext(NewResponseWriter(httptest.NewRecorder()), &Request{Request: r})
+	c.AddShared("user", "1")
+
+	var ctx context.Context = c
+	if ctx.Value("user") != "1" || ctx.Value(key{}) != "request" {
+		t.Fatal("Value() does not return shared and request values")
+	}
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("Deadline() set without timeout")
+	}
+}
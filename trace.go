@@ -0,0 +1,368 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// Span kinds, as defined by OpenTelemetry.
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+)
+
+type (
+	// TraceID identifies a trace.
+	TraceID [16]byte
+
+	// SpanID identifies a span.
+	SpanID [8]byte
+
+	// SpanKind is the span relationship with the remote side.
+	SpanKind int
+
+	// SpanContext is the part of a span propagated to other services.
+	SpanContext struct {
+		TraceID    TraceID
+		SpanID     SpanID
+		Flags      byte
+		TraceState string
+		Remote     bool
+	}
+
+	// Span is a timed operation of a trace.
+	// The methods of a nil or not sampled Span are no-op, the fields must only be read
+	// by exporters, after End.
+	Span struct {
+		Name        string
+		Kind        SpanKind
+		SpanContext SpanContext
+		Parent      SpanID
+		StartTime   time.Time
+		EndTime     time.Time
+		Attributes  []Field
+		// Error is the error message, empty when the operation succeeded.
+		Error string
+
+		tracer     *Tracer
+		parentSpan *Span
+		mu         sync.Mutex
+		ended      bool
+	}
+
+	// Exporter sends the ended spans to a tracing backend.
+	// Exporters implementing io.Closer are closed by Tracer.Close.
+	Exporter interface {
+		Export(spans []*Span) error
+	}
+
+	// Tracer creates the spans and exports them in batches.
+	Tracer struct {
+		// BatchSize is the number of spans exported at once, 512 by default.
+		BatchSize int
+		// Interval is the maximum delay before the ended spans are exported, 5 seconds by default.
+		Interval time.Duration
+
+		mu          sync.Mutex
+		exporter    Exporter
+		sampleRatio float64
+		queue       []*Span
+		stop        chan struct{}
+		wg          sync.WaitGroup
+	}
+
+	spanKey struct{}
+)
+
+// Tracing is the framework Tracer, disabled until an exporter is set.
+// Set the trace_exporter config key to stdout or otlp to enable it on Init.
+var Tracing = NewTracer(nil)
+
+// NewTracer returns a Tracer sampling every trace. A nil exporter disables the tracer.
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{BatchSize: 512, Interval: 5 * time.Second, sampleRatio: 1}
+	t.SetExporter(exporter)
+	return t
+}
+
+// SetExporter sets the exporter and starts the background export.
+func (t *Tracer) SetExporter(exporter Exporter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.exporter = exporter
+	if exporter != nil && t.stop == nil {
+		t.stop = make(chan struct{})
+		t.wg.Add(1)
+		go t.run(t.stop)
+	}
+}
+
+// SetSampleRatio sets the fraction of new traces recorded, between 0 and 1.
+// Traces started by another service follow the sampled flag of the caller.
+func (t *Tracer) SetSampleRatio(ratio float64) {
+	t.mu.Lock()
+	t.sampleRatio = math.Max(0, math.Min(1, ratio))
+	t.mu.Unlock()
+}
+
+// Enabled reports whether an exporter is set.
+func (t *Tracer) Enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.exporter != nil
+}
+
+// Start creates a span, child of the span found in ctx, and returns a copy of ctx carrying it.
+// It returns ctx and a nil span when the tracer is disabled.
+//
+//	ctx, span := framework.Tracing.Start(ctx, "load user", framework.SpanKindInternal)
+//	defer span.End()
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t.mu.Lock()
+	enabled, ratio := t.exporter != nil, t.sampleRatio
+	t.mu.Unlock()
+
+	if !enabled {
+		return ctx, nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{Name: name, Kind: kind, StartTime: time.Now()}
+
+	parent := SpanFromContext(ctx)
+	if parent != nil && parent.SpanContext.IsValid() {
+		span.parentSpan = parent
+		span.Parent = parent.SpanContext.SpanID
+		span.SpanContext.TraceID = parent.SpanContext.TraceID
+		span.SpanContext.Flags = parent.SpanContext.Flags
+		span.SpanContext.TraceState = parent.SpanContext.TraceState
+	} else {
+		span.SpanContext.TraceID = newTraceID()
+		if ratio >= 1 || float64(binary.BigEndian.Uint64(span.SpanContext.TraceID[8:]))/math.MaxUint64 < ratio {
+			span.SpanContext.Flags = 1
+		}
+	}
+	span.SpanContext.SpanID = newSpanID()
+
+	// Not sampled spans are only propagated.
+	if span.SpanContext.IsSampled() {
+		span.tracer = t
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartSpan creates an internal span with the framework Tracer, see Tracer.Start.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return Tracing.Start(ctx, name, SpanKindInternal)
+}
+
+// Flush exports the ended spans.
+func (t *Tracer) Flush() error {
+	t.mu.Lock()
+	spans, exporter := t.queue, t.exporter
+	t.queue = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 || exporter == nil {
+		return nil
+	}
+	return exporter.Export(spans)
+}
+
+// Close stops the background export, exports the ended spans and closes the exporter.
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	stop, exporter := t.stop, t.exporter
+	t.stop = nil
+	t.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		t.wg.Wait()
+	}
+
+	err := t.Flush()
+	if c, ok := exporter.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// run exports the spans every Interval.
+func (t *Tracer) run(stop chan struct{}) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.export()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// export flushes the queue logging the errors.
+func (t *Tracer) export() {
+	if err := t.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "trace: export error: %v\n", err)
+	}
+}
+
+// enqueue adds an ended span, the batch is exported in background when full.
+func (t *Tracer) enqueue(span *Span) {
+	t.mu.Lock()
+	t.queue = append(t.queue, span)
+	full := len(t.queue) >= t.BatchSize
+	t.mu.Unlock()
+
+	if full {
+		go t.export()
+	}
+}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx whose new spans are children of sc,
+// received from another service.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return ContextWithSpan(ctx, &Span{SpanContext: sc})
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// IsRecording reports whether the span is sampled and will be exported.
+func (s *Span) IsRecording() bool {
+	return s != nil && s.tracer != nil
+}
+
+// SetName updates the span name.
+func (s *Span) SetName(name string) {
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute adds a key/value pair to the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.Attributes = append(s.Attributes, Field{Key: key, Value: value})
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil || !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// End ends the span and queues it for export. Calls after the first one are ignored.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.enqueue(s)
+}
+
+// IsValid reports whether trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// IsSampled reports whether the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&1 == 1
+}
+
+// String returns the kind name.
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// String returns the hex encoded ID.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// String returns the hex encoded ID.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func newTraceID() (id TraceID) {
+	for id == (TraceID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	for id == (SpanID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
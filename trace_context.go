@@ -0,0 +1,298 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/AnUnnamedProject/framework/cache"
+)
+
+// tracedCache creates a span for each cache call, child of the request span.
+type tracedCache struct {
+	cache.Cache
+	ctx context.Context
+}
+
+// Span returns the current span of the request, nil when tracing is disabled.
+func (c *Context) Span() *Span {
+	return SpanFromContext(c)
+}
+
+// Cache returns the application cache, nil when cache is not configured.
+// With tracing enabled every call creates a span.
+func (c *Context) Cache() cache.Cache {
+	if App.cache == nil {
+		return nil
+	}
+	if !Tracing.Enabled() {
+		return App.cache
+	}
+	return &tracedCache{Cache: App.cache, ctx: c}
+}
+
+// GetOrLoad returns the cached value of key or, when missing, the value returned by load
+// cached with ttl. Concurrent loads of the same key are collapsed into one call,
+// the cache_stale and cache_beta config keys enable the stale values and the early
+// expiration, see cache.Loader. Without cache, load is called every time.
+func (c *Context) GetOrLoad(key string, ttl time.Duration, load cache.LoadFunc) (interface{}, error) {
+	if App.cacheLoader == nil {
+		return load()
+	}
+
+	span := c.startSpan("cache get_or_load")
+	span.SetAttribute("cache.key", key)
+	defer c.endSpan(span)
+
+	v, err := App.cacheLoader.GetOrLoad(key, ttl, load)
+	span.SetError(err)
+	return v, err
+}
+
+// startRequestSpan starts the server span of the request, child of the traceparent header.
+// The span is named by the route pattern and ended when the request has been served.
+func (c *Context) startRequestSpan() {
+	ctx := ExtractTraceContext(c.Request.Context(), c.Request.Header)
+	ctx, span := Tracing.Start(ctx, c.Request.Method, SpanKindServer)
+	if span == nil {
+		return
+	}
+
+	c.Request.Request = c.Request.WithContext(ctx)
+
+	c.After(func(c *Context) {
+		status := c.Response.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if c.route != "" {
+			span.SetName(c.Request.Method + " " + c.route)
+			span.SetAttribute("http.route", c.route)
+		}
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.target", c.Request.URL.Path)
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(&httpStatusError{status})
+		}
+		span.End()
+	})
+}
+
+// startSpan starts an internal span, child of the current request span, and makes it
+// the current span until endSpan.
+// The request of a detached context isn't changed, it's read by the request span.
+func (c *Context) startSpan(name string) *Span {
+	c.detachMu.Lock()
+	defer c.detachMu.Unlock()
+
+	ctx, span := Tracing.Start(c.Request.Context(), name, SpanKindInternal)
+	if span != nil && !c.detached {
+		c.Request.Request = c.Request.WithContext(ctx)
+	}
+	return span
+}
+
+// endSpan ends the span and restores its parent as current span.
+// Values added to the request context in the meantime (f.e. by middlewares) are kept.
+func (c *Context) endSpan(span *Span) {
+	if span == nil {
+		return
+	}
+
+	span.End()
+
+	c.detachMu.Lock()
+	defer c.detachMu.Unlock()
+
+	// A timed out handler may still use the request.
+	if !c.detached && SpanFromContext(c.Request.Context()) == span {
+		c.Request.Request = c.Request.WithContext(ContextWithSpan(c.Request.Context(), span.parentSpan))
+	}
+}
+
+// httpStatusError reports a server error status on spans.
+type httpStatusError struct {
+	status int
+}
+
+func (e *httpStatusError) Error() string {
+	return http.StatusText(e.status)
+}
+
+// startCacheSpan starts a client span for a cache operation.
+func (tc *tracedCache) startCacheSpan(op, key string) *Span {
+	_, span := Tracing.Start(tc.ctx, "cache "+op, SpanKindClient)
+	span.SetAttribute("cache.operation", op)
+	if key != "" {
+		span.SetAttribute("cache.key", key)
+	}
+	return span
+}
+
+// Get cached value by key.
+func (tc *tracedCache) Get(key string) interface{} {
+	span := tc.startCacheSpan("get", key)
+	defer span.End()
+
+	return tc.Cache.Get(key)
+}
+
+// Lookup returns the cached value by key and whether it was found.
+func (tc *tracedCache) Lookup(key string) (interface{}, bool) {
+	span := tc.startCacheSpan("get", key)
+	defer span.End()
+
+	v, ok := tc.Cache.Lookup(key)
+	span.SetAttribute("cache.hit", ok)
+	return v, ok
+}
+
+// GetMulti values of Get.
+func (tc *tracedCache) GetMulti(keys []string) []interface{} {
+	span := tc.startCacheSpan("get_multi", "")
+	span.SetAttribute("cache.keys", len(keys))
+	defer span.End()
+
+	return tc.Cache.GetMulti(keys)
+}
+
+// Put sets the cache value with key and timeout.
+func (tc *tracedCache) Put(key string, value interface{}, timeout time.Duration) error {
+	span := tc.startCacheSpan("put", key)
+	defer span.End()
+
+	err := tc.Cache.Put(key, value, timeout)
+	span.SetError(err)
+	return err
+}
+
+// PutMulti sets the values of Put with the same timeout.
+func (tc *tracedCache) PutMulti(values map[string]interface{}, timeout time.Duration) error {
+	span := tc.startCacheSpan("put_multi", "")
+	span.SetAttribute("cache.keys", len(values))
+	defer span.End()
+
+	err := tc.Cache.PutMulti(values, timeout)
+	span.SetError(err)
+	return err
+}
+
+// Add sets the cache value only if key is missing.
+func (tc *tracedCache) Add(key string, value interface{}, timeout time.Duration) (bool, error) {
+	span := tc.startCacheSpan("add", key)
+	defer span.End()
+
+	ok, err := tc.Cache.Add(key, value, timeout)
+	span.SetError(err)
+	return ok, err
+}
+
+// Increment adds delta to the integer value of key.
+func (tc *tracedCache) Increment(key string, delta int64) (int64, error) {
+	span := tc.startCacheSpan("increment", key)
+	defer span.End()
+
+	n, err := tc.Cache.Increment(key, delta)
+	span.SetError(err)
+	return n, err
+}
+
+// Decrement subtracts delta from the integer value of key.
+func (tc *tracedCache) Decrement(key string, delta int64) (int64, error) {
+	span := tc.startCacheSpan("decrement", key)
+	defer span.End()
+
+	n, err := tc.Cache.Decrement(key, delta)
+	span.SetError(err)
+	return n, err
+}
+
+// Touch sets a new timeout to key.
+func (tc *tracedCache) Touch(key string, timeout time.Duration) (bool, error) {
+	span := tc.startCacheSpan("touch", key)
+	defer span.End()
+
+	ok, err := tc.Cache.Touch(key, timeout)
+	span.SetError(err)
+	return ok, err
+}
+
+// TTL returns the remaining timeout of key.
+func (tc *tracedCache) TTL(key string) (time.Duration, bool) {
+	span := tc.startCacheSpan("ttl", key)
+	defer span.End()
+
+	return tc.Cache.TTL(key)
+}
+
+// Delete cached value by key.
+func (tc *tracedCache) Delete(key string) error {
+	span := tc.startCacheSpan("delete", key)
+	defer span.End()
+
+	err := tc.Cache.Delete(key)
+	span.SetError(err)
+	return err
+}
+
+// DeleteMulti values of Delete.
+func (tc *tracedCache) DeleteMulti(keys []string) error {
+	span := tc.startCacheSpan("delete_multi", "")
+	span.SetAttribute("cache.keys", len(keys))
+	defer span.End()
+
+	err := tc.Cache.DeleteMulti(keys)
+	span.SetError(err)
+	return err
+}
+
+// Exists check if cached value exists.
+func (tc *tracedCache) Exists(key string) bool {
+	span := tc.startCacheSpan("exists", key)
+	defer span.End()
+
+	return tc.Cache.Exists(key)
+}
+
+// ClearAll removes all cached values.
+func (tc *tracedCache) ClearAll() error {
+	span := tc.startCacheSpan("clear_all", "")
+	defer span.End()
+
+	err := tc.Cache.ClearAll()
+	span.SetError(err)
+	return err
+}
+
+// PutWithTags sets the cache value with key and timeout and tags it.
+func (tc *tracedCache) PutWithTags(key string, value interface{}, timeout time.Duration, tags ...string) error {
+	span := tc.startCacheSpan("put_with_tags", key)
+	span.SetAttribute("cache.tags", len(tags))
+	defer span.End()
+
+	err := tc.Cache.PutWithTags(key, value, timeout, tags...)
+	span.SetError(err)
+	return err
+}
+
+// InvalidateTag deletes the values tagged with tag.
+func (tc *tracedCache) InvalidateTag(tag string) error {
+	span := tc.startCacheSpan("invalidate_tag", "")
+	span.SetAttribute("cache.tag", tag)
+	defer span.End()
+
+	err := tc.Cache.InvalidateTag(tag)
+	span.SetError(err)
+	return err
+}
+
+// Namespace returns a traced view with the keys prefixed by name.
+func (tc *tracedCache) Namespace(name string) cache.Cache {
+	return &tracedCache{Cache: tc.Cache.Namespace(name), ctx: tc.ctx}
+}
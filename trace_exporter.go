@@ -0,0 +1,233 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultOTLPEndpoint is the OTLP/HTTP traces endpoint of a local collector.
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+type (
+	// StdoutExporter writes each span as a JSON line.
+	StdoutExporter struct {
+		mu  sync.Mutex
+		out io.Writer
+	}
+
+	// OTLPExporter sends the spans to an OpenTelemetry collector using OTLP/JSON over HTTP.
+	OTLPExporter struct {
+		// Endpoint is the collector traces URL, DefaultOTLPEndpoint when empty.
+		Endpoint string
+		// ServiceName is the service.name resource attribute.
+		ServiceName string
+		// Headers are added to each export request (f.e. authentication).
+		Headers map[string]string
+		// Client is the HTTP client, a client with a 10 seconds timeout when nil.
+		Client *http.Client
+	}
+)
+
+// NewStdoutExporter returns a StdoutExporter writing to out, os.Stdout when nil.
+func NewStdoutExporter(out io.Writer) *StdoutExporter {
+	if out == nil {
+		out = os.Stdout
+	}
+	return &StdoutExporter{out: out}
+}
+
+// Export writes the spans.
+func (e *StdoutExporter) Export(spans []*Span) error {
+	buf := &bytes.Buffer{}
+
+	for _, s := range spans {
+		buf.WriteString(`{"trace_id":"`)
+		buf.WriteString(s.SpanContext.TraceID.String())
+		buf.WriteString(`","span_id":"`)
+		buf.WriteString(s.SpanContext.SpanID.String())
+		buf.WriteString(`","parent_id":"`)
+		if s.Parent != (SpanID{}) {
+			buf.WriteString(s.Parent.String())
+		}
+		buf.WriteString(`","name":`)
+		writeJSONString(buf, s.Name)
+		buf.WriteString(`,"kind":`)
+		writeJSONString(buf, s.Kind.String())
+		buf.WriteString(`,"start":"`)
+		buf.WriteString(s.StartTime.Format(time.RFC3339Nano))
+		buf.WriteString(`","duration_ms":`)
+		buf.WriteString(strconv.FormatFloat(float64(s.EndTime.Sub(s.StartTime))/float64(time.Millisecond), 'f', 3, 64))
+		buf.WriteString(`,"attributes":{`)
+		for i, f := range s.Attributes {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, f.Key)
+			buf.WriteByte(':')
+			writeJSONValue(buf, f.Value)
+		}
+		buf.WriteByte('}')
+		if s.Error != "" {
+			buf.WriteString(`,"error":`)
+			writeJSONString(buf, s.Error)
+		}
+		buf.WriteString("}\n")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := e.out.Write(buf.Bytes())
+	return err
+}
+
+// Export posts the spans to the collector.
+func (e *OTLPExporter) Export(spans []*Span) error {
+	endpoint := e.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(e.encode(spans)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("trace: collector returned %s: %s", resp.Status, b)
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// encode returns the ExportTraceServiceRequest JSON encoding:
+// IDs are hex strings, 64 bit integers are strings.
+func (e *OTLPExporter) encode(spans []*Span) []byte {
+	buf := &bytes.Buffer{}
+
+	buf.WriteString(`{"resourceSpans":[{"resource":{"attributes":[`)
+	writeOTLPAttribute(buf, "service.name", e.ServiceName)
+	buf.WriteString(`]},"scopeSpans":[{"scope":{"name":"github.com/AnUnnamedProject/framework","version":"`)
+	buf.WriteString(VERSION)
+	buf.WriteString(`"},"spans":[`)
+
+	for i, s := range spans {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		buf.WriteString(`{"traceId":"`)
+		buf.WriteString(s.SpanContext.TraceID.String())
+		buf.WriteString(`","spanId":"`)
+		buf.WriteString(s.SpanContext.SpanID.String())
+		buf.WriteByte('"')
+		if s.Parent != (SpanID{}) {
+			buf.WriteString(`,"parentSpanId":"`)
+			buf.WriteString(s.Parent.String())
+			buf.WriteByte('"')
+		}
+		if s.SpanContext.TraceState != "" {
+			buf.WriteString(`,"traceState":`)
+			writeJSONString(buf, s.SpanContext.TraceState)
+		}
+		buf.WriteString(`,"name":`)
+		writeJSONString(buf, s.Name)
+		buf.WriteString(`,"kind":`)
+		buf.WriteString(strconv.Itoa(int(s.Kind)))
+		buf.WriteString(`,"startTimeUnixNano":"`)
+		buf.WriteString(strconv.FormatInt(s.StartTime.UnixNano(), 10))
+		buf.WriteString(`","endTimeUnixNano":"`)
+		buf.WriteString(strconv.FormatInt(s.EndTime.UnixNano(), 10))
+		buf.WriteString(`","attributes":[`)
+		for j, f := range s.Attributes {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			writeOTLPAttribute(buf, f.Key, f.Value)
+		}
+		buf.WriteString(`],"status":{`)
+		if s.Error != "" {
+			buf.WriteString(`"code":2,"message":`)
+			writeJSONString(buf, s.Error)
+		}
+		buf.WriteString(`}}`)
+	}
+
+	buf.WriteString(`]}]}]}`)
+	return buf.Bytes()
+}
+
+// writeOTLPAttribute writes a KeyValue with its typed AnyValue.
+func writeOTLPAttribute(buf *bytes.Buffer, key string, value interface{}) {
+	buf.WriteString(`{"key":`)
+	writeJSONString(buf, key)
+	buf.WriteString(`,"value":{`)
+
+	switch v := value.(type) {
+	case bool:
+		buf.WriteString(`"boolValue":`)
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		writeOTLPInt(buf, int64(v))
+	case int32:
+		writeOTLPInt(buf, int64(v))
+	case int64:
+		writeOTLPInt(buf, v)
+	case uint32:
+		writeOTLPInt(buf, int64(v))
+	case float64:
+		writeOTLPDouble(buf, v)
+	case float32:
+		writeOTLPDouble(buf, float64(v))
+	default:
+		buf.WriteString(`"stringValue":`)
+		writeJSONString(buf, fieldString(v))
+	}
+
+	buf.WriteString(`}}`)
+}
+
+func writeOTLPInt(buf *bytes.Buffer, v int64) {
+	buf.WriteString(`"intValue":"`)
+	buf.WriteString(strconv.FormatInt(v, 10))
+	buf.WriteByte('"')
+}
+
+func writeOTLPDouble(buf *bytes.Buffer, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		buf.WriteString(`"stringValue":`)
+		writeJSONString(buf, strconv.FormatFloat(v, 'g', -1, 64))
+		return
+	}
+	buf.WriteString(`"doubleValue":`)
+	buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+}
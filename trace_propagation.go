@@ -0,0 +1,222 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// W3C Trace Context headers (and gRPC metadata keys).
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// maxTraceState is the maximum tracestate length propagated.
+const maxTraceState = 512
+
+type (
+	// carrier reads and writes the propagation fields.
+	carrier interface {
+		Get(key string) string
+		Set(key, value string)
+	}
+
+	// metadataCarrier adapts gRPC metadata to carrier.
+	metadataCarrier metadata.MD
+
+	// tracingStream overrides the stream context with the span context.
+	tracingStream struct {
+		grpc.ServerStream
+		ctx context.Context
+	}
+)
+
+// ParseTraceParent parses a traceparent value: version-traceid-spanid-flags.
+func ParseTraceParent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, false
+	}
+
+	version, ok := parseHex(value[0:2])
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(value) != 55) || (len(value) > 55 && value[55] != '-') {
+		return sc, false
+	}
+
+	traceID, ok := parseHex(value[3:35])
+	if !ok {
+		return sc, false
+	}
+	spanID, ok := parseHex(value[36:52])
+	if !ok {
+		return sc, false
+	}
+	flags, ok := parseHex(value[53:55])
+	if !ok {
+		return sc, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+
+	return sc, sc.IsValid()
+}
+
+// TraceParent returns the traceparent value of sc.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.IsSampled() {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// parseHex decodes lowercase hex strings only, as required by the specification.
+func parseHex(s string) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return nil, false
+		}
+	}
+
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// extract returns ctx carrying the remote span context found in c.
+func extract(ctx context.Context, c carrier) context.Context {
+	sc, ok := ParseTraceParent(c.Get(HeaderTraceParent))
+	if !ok {
+		return ctx
+	}
+
+	if state := strings.TrimSpace(c.Get(HeaderTraceState)); len(state) <= maxTraceState {
+		sc.TraceState = state
+	}
+
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// inject writes the span context found in ctx to c.
+func inject(ctx context.Context, c carrier) {
+	span := SpanFromContext(ctx)
+	if span == nil || !span.SpanContext.IsValid() {
+		return
+	}
+
+	c.Set(HeaderTraceParent, span.SpanContext.TraceParent())
+	if span.SpanContext.TraceState != "" {
+		c.Set(HeaderTraceState, span.SpanContext.TraceState)
+	}
+}
+
+// ExtractTraceContext returns ctx carrying the span context of the traceparent and tracestate headers.
+func ExtractTraceContext(ctx context.Context, h http.Header) context.Context {
+	return extract(ctx, http.Header(h))
+}
+
+// InjectTraceContext writes the traceparent and tracestate headers of the span found in ctx,
+// to propagate the trace to outgoing requests:
+//
+//	req, _ := http.NewRequest("GET", url, nil)
+//	framework.InjectTraceContext(c, req.Header)
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	inject(ctx, http.Header(h))
+}
+
+// Get returns the first value of key.
+func (md metadataCarrier) Get(key string) string {
+	if values := metadata.MD(md).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Set sets the value of key.
+func (md metadataCarrier) Set(key, value string) {
+	metadata.MD(md).Set(key, value)
+}
+
+// startGRPCSpan starts the server span of a gRPC call, child of the caller span.
+func startGRPCSpan(ctx context.Context, method string) (context.Context, *Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = extract(ctx, metadataCarrier(md))
+	}
+
+	ctx, span := Tracing.Start(ctx, method, SpanKindServer)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", method)
+	return ctx, span
+}
+
+// endGRPCSpan records the status code and ends the span.
+func endGRPCSpan(span *Span, err error) {
+	code := status.Code(err)
+	span.SetAttribute("rpc.grpc.status_code", int(code))
+	if code != codes.OK {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+// TracingUnaryInterceptor creates a span for each unary call, child of the caller traceparent metadata.
+//
+//	framework.UseGRPCUnaryInterceptor(framework.TracingUnaryInterceptor())
+func TracingUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startGRPCSpan(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endGRPCSpan(span, err)
+		return resp, err
+	}
+}
+
+// TracingStreamInterceptor creates a span for each stream, child of the caller traceparent metadata.
+//
+//	framework.UseGRPCStreamInterceptor(framework.TracingStreamInterceptor())
+func TracingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startGRPCSpan(stream.Context(), info.FullMethod)
+		err := handler(srv, &tracingStream{ServerStream: stream, ctx: ctx})
+		endGRPCSpan(span, err)
+		return err
+	}
+}
+
+// TracingClientInterceptor creates a client span for outgoing calls and sends its traceparent metadata.
+//
+//	conn, err := grpc.Dial(addr, grpc.WithUnaryInterceptor(framework.TracingClientInterceptor()))
+func TracingClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := Tracing.Start(ctx, method, SpanKindClient)
+		span.SetAttribute("rpc.system", "grpc")
+		span.SetAttribute("rpc.method", method)
+
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		inject(ctx, metadataCarrier(md))
+
+		err := invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+		endGRPCSpan(span, err)
+		return err
+	}
+}
+
+// Context returns the stream context carrying the span.
+func (s *tracingStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2017 AnUnnamedProject
+// Distributed under the MIT software license, see the accompanying
+// file LICENSE or http://www.opensource.org/licenses/mit-license.php.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// memoryExporter keeps the exported spans.
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *memoryExporter) Export(spans []*Span) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *memoryExporter) find(t *testing.T, name string) *Span {
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("span %s not exported", name)
+	return nil
+}
+
+// withTracer replaces the framework Tracer during a test.
+func withTracer(t *testing.T, exporter Exporter) func() {
+	saved := Tracing
+	Tracing = NewTracer(exporter)
+	return func() {
+		if err := Tracing.Close(); err != nil {
+			t.Error(err)
+		}
+		Tracing = saved
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := ParseTraceParent(testTraceParent)
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.IsSampled() {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if sc.TraceParent() != testTraceParent {
+		t.Fatalf("unexpected traceparent %s", sc.TraceParent())
+	}
+
+	// Future versions may append fields.
+	if _, ok := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Error("future version rejected")
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceParent(invalid); ok {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+}
+
+func TestTracingRouter(t *testing.T) {
+	exporter := &memoryExporter{}
+	defer withTracer(t, exporter)()
+
+	r := NewRouter()
+	r.Add("/user/:id", "GET", func(c *Context) {
+		_, span := StartSpan(c, "load user")
+		span.End()
+
+		req, _ := http.NewRequest("GET", "http://backend/", nil)
+		InjectTraceContext(c, req.Header)
+		c.Plain(http.StatusOK, req.Header.Get(HeaderTraceParent))
+	})
+
+	req, _ := http.NewRequest("GET", "/user/1", nil)
+	req.Header.Set(HeaderTraceParent, testTraceParent)
+	req.Header.Set(HeaderTraceState, "vendor=value")
+	w := serveWithMiddlewares(r, req, RequestID())
+
+	if err := Tracing.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	root := exporter.find(t, "GET /user/:id")
+	if root.Kind != SpanKindServer || root.Parent.String() != "00f067aa0ba902b7" ||
+		root.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || root.SpanContext.TraceState != "vendor=value" {
+		t.Fatalf("unexpected root span %+v", root)
+	}
+
+	for _, name := range []string{"middleware", "routing", "handler"} {
+		if s := exporter.find(t, name); s.Parent != root.SpanContext.SpanID {
+			t.Errorf("%s is not a child of the request span", name)
+		}
+	}
+
+	handler := exporter.find(t, "handler")
+	user := exporter.find(t, "load user")
+	if user.Parent != handler.SpanContext.SpanID {
+		t.Error("handler span is not the current span")
+	}
+
+	// The outgoing traceparent is the handler span.
+	if sc, ok := ParseTraceParent(w.Body.String()); !ok || sc.SpanID != handler.SpanContext.SpanID {
+		t.Fatalf("unexpected outgoing traceparent %q", w.Body.String())
+	}
+}
+
+func TestTracingTimeout(t *testing.T) {
+	exporter := &memoryExporter{}
+	defer withTracer(t, exporter)()
+
+	// The handler outlives the deadline and keeps starting spans,
+	// while the request span is ended.
+	done := make(chan struct{})
+	r := NewRouter()
+	r.Add("/slow", "GET", Timeout(10*time.Millisecond), func(c *Context) {
+		defer close(done)
+
+		for i := 0; c.Err() == nil || i < 1000; i++ {
+			span := c.startSpan("late")
+			c.endSpan(span)
+		}
+	})
+
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	<-done
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if err := Tracing.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	root := exporter.find(t, "GET /slow")
+	if !strings.Contains(fmt.Sprint(root.Attributes), "http.status_code 503") {
+		t.Fatalf("unexpected request span attributes %v", root.Attributes)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	ctx, span := StartSpan(context.Background(), "noop")
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Fatal("span created without exporter")
+	}
+
+	// Nil spans are no-op.
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("error"))
+	span.End()
+}
+
+func TestTracingSampling(t *testing.T) {
+	exporter := &memoryExporter{}
+	defer withTracer(t, exporter)()
+	Tracing.SetSampleRatio(0)
+
+	ctx, span := StartSpan(context.Background(), "not sampled")
+	if span.IsRecording() || !span.SpanContext.IsValid() {
+		t.Fatal("unexpected sampled span")
+	}
+	span.End()
+
+	// The decision is propagated.
+	h := http.Header{}
+	InjectTraceContext(ctx, h)
+	if !strings.HasSuffix(h.Get(HeaderTraceParent), "-00") {
+		t.Fatalf("unexpected traceparent %s", h.Get(HeaderTraceParent))
+	}
+
+	// Sampled remote parents are recorded.
+	ctx = ExtractTraceContext(context.Background(), http.Header{"Traceparent": {testTraceParent}})
+	if _, span = StartSpan(ctx, "sampled"); !span.IsRecording() {
+		t.Fatal("remote sampled flag ignored")
+	}
+	span.End()
+
+	_ = Tracing.Flush()
+	if len(exporter.spans) != 1 {
+		t.Fatalf("expected 1 exported span, got %d", len(exporter.spans))
+	}
+}
+
+func TestTracingGRPC(t *testing.T) {
+	exporter := &memoryExporter{}
+	defer withTracer(t, exporter)()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(HeaderTraceParent, testTraceParent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	var outgoing string
+	_, _ = TracingUnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			outgoing = md.Get(HeaderTraceParent)[0]
+			return nil
+		}
+		return nil, TracingClientInterceptor()(ctx, "/other.Service/Call", nil, nil, nil, invoker)
+	})
+
+	_ = Tracing.Flush()
+
+	server := exporter.find(t, "/test.Service/Method")
+	client := exporter.find(t, "/other.Service/Call")
+	if server.Parent.String() != "00f067aa0ba902b7" || client.Parent != server.SpanContext.SpanID || client.Kind != SpanKindClient {
+		t.Fatalf("unexpected spans %+v %+v", server, client)
+	}
+	if sc, ok := ParseTraceParent(outgoing); !ok || sc.SpanID != client.SpanContext.SpanID {
+		t.Fatalf("unexpected outgoing traceparent %q", outgoing)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		body    map[string]interface{}
+		headers http.Header
+	)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("invalid JSON %s: %v", b, err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	exporter := &OTLPExporter{Endpoint: collector.URL + "/v1/traces", ServiceName: "test", Headers: map[string]string{"Authorization": "token"}}
+	defer withTracer(t, exporter)()
+
+	ctx, parent := StartSpan(context.Background(), "parent")
+	_, child := Tracing.Start(ctx, "child", SpanKindClient)
+	child.SetAttribute("count", 3)
+	child.SetAttribute("ok", true)
+	child.SetError(errors.New("failed"))
+	child.End()
+	parent.End()
+
+	if err := Tracing.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if headers.Get("Authorization") != "token" || headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+
+	rs := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	service := rs["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if service["key"] != "service.name" || service["value"].(map[string]interface{})["stringValue"] != "test" {
+		t.Fatalf("unexpected resource %v", rs["resource"])
+	}
+
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	s := spans[0].(map[string]interface{})
+	if s["name"] != "child" || s["kind"] != float64(SpanKindClient) || s["parentSpanId"] != parent.SpanContext.SpanID.String() ||
+		s["traceId"] != parent.SpanContext.TraceID.String() {
+		t.Fatalf("unexpected span %v", s)
+	}
+	if _, ok := s["startTimeUnixNano"].(string); !ok {
+		t.Fatalf("timestamps must be strings %v", s)
+	}
+	if status := s["status"].(map[string]interface{}); status["code"] != float64(2) || status["message"] != "failed" {
+		t.Fatalf("unexpected status %v", status)
+	}
+
+	attr := s["attributes"].([]interface{})[0].(map[string]interface{})
+	if attr["value"].(map[string]interface{})["intValue"] != "3" {
+		t.Fatalf("unexpected attribute %v", attr)
+	}
+
+	// Collector errors are reported.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	if err := (&OTLPExporter{Endpoint: failing.URL}).Export([]*Span{parent}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer withTracer(t, NewStdoutExporter(buf))()
+
+	_, span := StartSpan(context.Background(), "work")
+	span.SetAttribute("user", "john")
+	span.End()
+	_ = Tracing.Flush()
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+	if entry["name"] != "work" || entry["kind"] != "internal" || entry["trace_id"] != span.SpanContext.TraceID.String() ||
+		entry["attributes"].(map[string]interface{})["user"] != "john" {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+}
@@ -65,3 +65,30 @@ func lookupFile(path string) (string, os.FileInfo, error) {
 
 	return "", nil, nil
 }
+
+// toStrings converts a string, []string or []interface{} config value to a []string.
+// Empty strings and values of other types are skipped.
+func toStrings(value interface{}) []string {
+	var out []string
+
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			out = append(out, v)
+		}
+	case []string:
+		for _, s := range v {
+			if s != "" {
+				out = append(out, s)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+
+	return out
+}
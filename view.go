@@ -13,6 +13,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Renderer is the interface for template rendering.
@@ -27,6 +29,18 @@ var funcMap template.FuncMap
 type View struct {
 	template.Template
 	viewDir string
+
+	// reload parses the views again when they change, see ModeProfile.ReloadTemplates.
+	reload bool
+	mu     sync.RWMutex
+	stamp  string
+	parsed []viewSource
+}
+
+// viewSource is a template added with Parse, parsed again on reload.
+type viewSource struct {
+	name string
+	data []byte
 }
 
 // AddFunc register a func in the view.
@@ -51,6 +65,15 @@ func NewView(viewDir string) (Renderer, error) {
 	// Register internal view funcs
 	funcMap = GetTemplateFuncs()
 
+	s := newView(viewDir)
+	s.reload = Profile().ReloadTemplates
+	s.stamp = viewStamp(viewDir)
+
+	return s.load(viewDir)
+}
+
+// newView returns a View with the embedded templates.
+func newView(viewDir string) *View {
 	s := &View{
 		viewDir:  viewDir,
 		Template: *template.New("").Delims(Config.String("template_left"), Config.String("template_right")).Funcs(funcMap),
@@ -59,7 +82,7 @@ func NewView(viewDir string) (Renderer, error) {
 	s.EmbedShortcodes()
 	s.EmbedTemplates()
 
-	return s.load(viewDir)
+	return s
 }
 
 // load loads the .html templates from the specified dir.
@@ -124,13 +147,82 @@ func (s *View) load(dir string) (Renderer, error) {
 }
 
 // Render executes the template by name.
+// With reload, the views are parsed again when they changed since the last Render.
 func (s *View) Render(out io.Writer, name string, data interface{}) error {
+	if s.reload {
+		if err := s.reloadChanged(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.ExecuteTemplate(out, name, data)
 }
 
 // Parse the data template.
 func (s *View) Parse(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reload {
+		s.parsed = append(s.parsed, viewSource{name: name, data: data})
+	}
+
 	t := s.New(name)
 	_, err := t.Parse(string(data))
 	return err
 }
+
+// reloadChanged parses the views again when they changed.
+// On errors the current templates are kept.
+func (s *View) reloadChanged() error {
+	stamp := viewStamp(s.viewDir)
+
+	s.mu.RLock()
+	changed := stamp != s.stamp
+	s.mu.RUnlock()
+
+	if !changed {
+		return nil
+	}
+
+	next := newView(s.viewDir)
+	if _, err := next.load(s.viewDir); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.parsed {
+		if _, err := next.New(p.name).Parse(string(p.data)); err != nil {
+			return err
+		}
+	}
+
+	s.Template, s.stamp = next.Template, stamp
+	return nil
+}
+
+// viewStamp returns the number, the size and the last modification of the .html files in dir.
+func viewStamp(dir string) string {
+	var count, size int64
+	var modified time.Time
+
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".html" {
+			return nil
+		}
+
+		count++
+		size += info.Size()
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		return nil
+	})
+
+	return fmt.Sprintf("%d:%d:%d", count, size, modified.UnixNano())
+}